@@ -0,0 +1,213 @@
+package annotations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"monitor/data"
+	"monitor/env"
+	"monitor/sync"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+	"unicode/utf8"
+)
+
+// A short note of an operator on a thing or an intersection, e.g. to explain an outage to riders.
+type Annotation struct {
+	// A unique id of the annotation. Generated if not given.
+	Id string `json:"id"`
+	// The name of the thing to which the annotation is attached, e.g. `123_4`.
+	Thing string `json:"thing,omitempty"`
+	// The intersection to which the annotation is attached, see `Thing.Intersection`.
+	Intersection string `json:"intersection,omitempty"`
+	// The text of the annotation by language, e.g. {"de": "...", "en": "..."}.
+	Text map[string]string `json:"text"`
+	// The time at which the annotation was created or last updated.
+	Created time.Time `json:"created"`
+	// The time at which the annotation expires, if it doesn't apply until it is deleted.
+	Expires *time.Time `json:"expires"`
+}
+
+// The annotations by id.
+var annotations = make(map[string]Annotation)
+
+// Whether the persisted annotations were loaded.
+var loaded = false
+
+// A lock for the annotations.
+var annotationsMutex = &gosync.Mutex{}
+
+// The file under `DATA_PATH` in which the annotations are persisted.
+const annotationsFile = "annotations.json"
+
+// The maximum number of characters of the text in each language.
+var maxTextLength = env.Int("ANNOTATION_MAX_TEXT_LENGTH", 280)
+
+// The language whose text is published if there is none in the language of the thing.
+var defaultLanguage = strings.ToLower(env.String("ANNOTATION_DEFAULT_LANGUAGE", "de"))
+
+// Load the persisted annotations, if they weren't loaded yet. The caller must hold the lock.
+func load() {
+	if loaded {
+		return
+	}
+	loaded = true
+	var persisted map[string]Annotation
+	if data.Load(annotationsFile, &persisted) {
+		annotations = persisted
+	}
+}
+
+// Check that the annotation is attached to exactly one thing or intersection and has a short text.
+func (annotation Annotation) validate(now time.Time) error {
+	if (annotation.Thing == "") == (annotation.Intersection == "") {
+		return fmt.Errorf("an annotation must be attached to either a thing or an intersection")
+	}
+	if len(annotation.Text) == 0 {
+		return fmt.Errorf("an annotation must have a text in at least one language")
+	}
+	for language, text := range annotation.Text {
+		if language == "" || strings.TrimSpace(text) == "" {
+			return fmt.Errorf("empty text or language")
+		}
+		if length := utf8.RuneCountInString(text); length > maxTextLength {
+			return fmt.Errorf("the %s text has %d characters, at most %d are allowed", language, length, maxTextLength)
+		}
+	}
+	if annotation.Expires != nil && !annotation.Expires.After(now) {
+		return fmt.Errorf("an annotation must not expire in the past")
+	}
+	return nil
+}
+
+// Check whether the annotation has expired at the given time.
+func (annotation Annotation) expiredAt(now time.Time) bool {
+	return annotation.Expires != nil && !now.Before(*annotation.Expires)
+}
+
+// Check whether the annotation is attached to the thing, directly or via its intersection.
+func (annotation Annotation) appliesTo(thing sync.Thing) bool {
+	if annotation.Thing != "" {
+		return annotation.Thing == thing.Name
+	}
+	return annotation.Intersection == thing.Intersection()
+}
+
+// Get the text of the annotation in the given language, e.g. `de` or `en-GB`.
+// Falls back to `ANNOTATION_DEFAULT_LANGUAGE` and then to any language.
+func (annotation Annotation) TextIn(language string) string {
+	language = strings.ToLower(language)
+	candidates := []string{language}
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		candidates = append(candidates, language[:i])
+	}
+	candidates = append(candidates, defaultLanguage)
+	for _, candidate := range candidates {
+		for key, text := range annotation.Text {
+			if strings.ToLower(key) == candidate {
+				return text
+			}
+		}
+	}
+	// Use the alphabetically first language, such that the fallback is stable.
+	keys := make([]string, 0, len(annotation.Text))
+	for key := range annotation.Text {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return ""
+	}
+	return annotation.Text[keys[0]]
+}
+
+// Remove the expired annotations. The caller must hold the lock.
+// Returns whether an annotation was removed.
+func prune(now time.Time) bool {
+	pruned := false
+	for id, annotation := range annotations {
+		if annotation.expiredAt(now) {
+			delete(annotations, id)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// Sort annotations by creation time, newest first.
+func sortNewestFirst(list []Annotation) {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Created.Equal(list[j].Created) {
+			return list[i].Created.After(list[j].Created)
+		}
+		return list[i].Id < list[j].Id
+	})
+}
+
+// Get all annotations that have not expired, newest first.
+func All(now time.Time) []Annotation {
+	annotationsMutex.Lock()
+	defer annotationsMutex.Unlock()
+	load()
+	list := make([]Annotation, 0, len(annotations))
+	for _, annotation := range annotations {
+		if !annotation.expiredAt(now) {
+			list = append(list, annotation)
+		}
+	}
+	sortNewestFirst(list)
+	return list
+}
+
+// Get the annotations that are attached to the thing or its intersection and have not expired, newest first.
+func For(thing sync.Thing, now time.Time) []Annotation {
+	annotationsMutex.Lock()
+	defer annotationsMutex.Unlock()
+	load()
+	list := make([]Annotation, 0)
+	for _, annotation := range annotations {
+		if !annotation.expiredAt(now) && annotation.appliesTo(thing) {
+			list = append(list, annotation)
+		}
+	}
+	sortNewestFirst(list)
+	return list
+}
+
+// Create or replace an annotation and persist all annotations.
+func Put(annotation Annotation, now time.Time) (Annotation, error) {
+	if err := annotation.validate(now); err != nil {
+		return annotation, err
+	}
+	if annotation.Id == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return annotation, err
+		}
+		annotation.Id = hex.EncodeToString(id)
+	}
+	annotation.Created = now
+
+	annotationsMutex.Lock()
+	defer annotationsMutex.Unlock()
+	load()
+	prune(now)
+	annotations[annotation.Id] = annotation
+	data.Store(annotationsFile, annotations)
+	return annotation, nil
+}
+
+// Delete an annotation and persist all annotations. Returns false if there is no such annotation.
+func Delete(id string, now time.Time) bool {
+	annotationsMutex.Lock()
+	defer annotationsMutex.Unlock()
+	load()
+	_, ok := annotations[id]
+	delete(annotations, id)
+	if ok || prune(now) {
+		data.Store(annotationsFile, annotations)
+	}
+	return ok
+}
@@ -0,0 +1,62 @@
+package annotations
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	tests := []struct {
+		name       string
+		annotation Annotation
+		ok         bool
+	}{
+		{"thing", Annotation{Thing: "1_1", Text: map[string]string{"de": "Baustelle"}}, true},
+		{"intersection", Annotation{Intersection: "1", Text: map[string]string{"de": "Baustelle", "en": "Construction"}}, true},
+		{"expires in the future", Annotation{Thing: "1_1", Text: map[string]string{"de": "Baustelle"}, Expires: &future}, true},
+		{"maximum length", Annotation{Thing: "1_1", Text: map[string]string{"de": strings.Repeat("ä", 280)}}, true},
+		{"thing and intersection", Annotation{Thing: "1_1", Intersection: "1", Text: map[string]string{"de": "Baustelle"}}, false},
+		{"neither thing nor intersection", Annotation{Text: map[string]string{"de": "Baustelle"}}, false},
+		{"no text", Annotation{Thing: "1_1"}, false},
+		{"blank text", Annotation{Thing: "1_1", Text: map[string]string{"de": " "}}, false},
+		{"empty language", Annotation{Thing: "1_1", Text: map[string]string{"": "Baustelle"}}, false},
+		{"too long", Annotation{Thing: "1_1", Text: map[string]string{"de": "Baustelle", "en": strings.Repeat("a", 281)}}, false},
+		{"expired", Annotation{Thing: "1_1", Text: map[string]string{"de": "Baustelle"}, Expires: &past}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.annotation.validate(now); (err == nil) != test.ok {
+				t.Errorf("validate = %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestTextIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     map[string]string
+		language string
+		want     string
+	}{
+		{"exact language", map[string]string{"de": "Baustelle", "en": "Construction"}, "en", "Construction"},
+		{"case insensitive", map[string]string{"DE": "Baustelle", "en": "Construction"}, "de", "Baustelle"},
+		{"language variant", map[string]string{"de": "Baustelle", "en": "Construction"}, "en-GB", "Construction"},
+		{"exact variant", map[string]string{"en": "Construction", "en-gb": "Roadworks"}, "en-GB", "Roadworks"},
+		{"default language", map[string]string{"de": "Baustelle", "en": "Construction"}, "fr", "Baustelle"},
+		{"no language", map[string]string{"de": "Baustelle", "en": "Construction"}, "", "Baustelle"},
+		{"first language", map[string]string{"fr": "Travaux", "en": "Construction"}, "it", "Construction"},
+		{"no text", map[string]string{}, "de", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (Annotation{Text: test.text}).TextIn(test.language); got != test.want {
+				t.Errorf("TextIn(%q) = %q, want %q", test.language, got, test.want)
+			}
+		})
+	}
+}
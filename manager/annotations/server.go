@@ -0,0 +1,108 @@
+package annotations
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"monitor/clock"
+	"monitor/log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Serve the admin API of the annotations on `ANNOTATIONS_ADDR`, if set. The API is protected with
+// basic auth, it is not started unless `ANNOTATIONS_BASIC_AUTH_USER` and `ANNOTATIONS_BASIC_AUTH_PASS` are set.
+func Serve() {
+	addr := os.Getenv("ANNOTATIONS_ADDR")
+	if addr == "" {
+		return
+	}
+	username := os.Getenv("ANNOTATIONS_BASIC_AUTH_USER")
+	password := os.Getenv("ANNOTATIONS_BASIC_AUTH_PASS")
+	if username == "" || password == "" {
+		log.Error.Println("ANNOTATIONS_BASIC_AUTH_USER or ANNOTATIONS_BASIC_AUTH_PASS not set, not serving the annotations API.")
+		return
+	}
+
+	log.Info.Println("Serving the annotations API on", addr)
+	if err := http.ListenAndServe(addr, newHandler(username, password)); err != nil {
+		log.Error.Println("Annotations API stopped:", err)
+	}
+}
+
+// Create the handler of the admin API, which requires basic auth with the given credentials.
+//
+//   - `GET /annotations` lists all annotations that have not expired.
+//   - `POST /annotations` creates or replaces an annotation.
+//   - `PUT /annotations/<id>` creates or replaces the annotation with the given id.
+//   - `DELETE /annotations/<id>` deletes an annotation.
+func newHandler(username string, password string) http.Handler {
+	mux := http.NewServeMux()
+	handler := func(rw http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			rw.Header().Set("WWW-Authenticate", `Basic realm="annotations"`)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/annotations"), "/")
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			writeJson(rw, http.StatusOK, All(clock.Now()))
+		case r.Method == http.MethodPost && id == "", r.Method == http.MethodPut && id != "":
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+			if err != nil {
+				writeError(rw, http.StatusBadRequest, err)
+				return
+			}
+			var annotation Annotation
+			if err := json.Unmarshal(body, &annotation); err != nil {
+				writeError(rw, http.StatusBadRequest, err)
+				return
+			}
+			if id != "" {
+				annotation.Id = id
+			}
+			annotation, err = Put(annotation, clock.Now())
+			if err != nil {
+				writeError(rw, http.StatusBadRequest, err)
+				return
+			}
+			log.Info.Printf("Annotation %s saved.\n", annotation.Id)
+			writeJson(rw, http.StatusOK, annotation)
+		case r.Method == http.MethodDelete && id != "":
+			if !Delete(id, clock.Now()) {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			log.Info.Printf("Annotation %s deleted.\n", id)
+			rw.WriteHeader(http.StatusNoContent)
+		default:
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+	mux.HandleFunc("/annotations", handler)
+	mux.HandleFunc("/annotations/", handler)
+	return mux
+}
+
+// Write a value as json with the given status code.
+func writeJson(rw http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Error.Println("Error marshalling annotations response:", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(body)
+}
+
+// Write an error message as json with the given status code.
+func writeError(rw http.ResponseWriter, status int, err error) {
+	writeJson(rw, status, map[string]string{"error": err.Error()})
+}
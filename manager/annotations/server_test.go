@@ -0,0 +1,72 @@
+package annotations
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Without credentials, the API must not be served.
+func TestServeWithoutCredentials(t *testing.T) {
+	t.Setenv("ANNOTATIONS_ADDR", "127.0.0.1:0")
+	t.Setenv("ANNOTATIONS_BASIC_AUTH_USER", "admin")
+	t.Setenv("ANNOTATIONS_BASIC_AUTH_PASS", "")
+	done := make(chan struct{})
+	go func() {
+		Serve()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Serve started without credentials")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Setenv("DATA_PATH", "")
+	server := httptest.NewServer(newHandler("admin", "secret"))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		username string
+		password string
+		status   int
+	}{
+		{"list without credentials", http.MethodGet, "/annotations", "", "", "", http.StatusUnauthorized},
+		{"create with wrong password", http.MethodPost, "/annotations", `{"thing": "1_1", "text": {"de": "Baustelle"}}`, "admin", "wrong", http.StatusUnauthorized},
+		{"list", http.MethodGet, "/annotations", "", "admin", "secret", http.StatusOK},
+		{"create", http.MethodPost, "/annotations", `{"thing": "1_1", "text": {"de": "Baustelle"}}`, "admin", "secret", http.StatusOK},
+		{"replace", http.MethodPut, "/annotations/works", `{"intersection": "1", "text": {"de": "Baustelle"}}`, "admin", "secret", http.StatusOK},
+		{"too long", http.MethodPost, "/annotations", `{"thing": "1_1", "text": {"de": "` + strings.Repeat("a", 281) + `"}}`, "admin", "secret", http.StatusBadRequest},
+		{"invalid json", http.MethodPost, "/annotations", `{`, "admin", "secret", http.StatusBadRequest},
+		{"delete", http.MethodDelete, "/annotations/works", "", "admin", "secret", http.StatusNoContent},
+		{"delete again", http.MethodDelete, "/annotations/works", "", "admin", "secret", http.StatusNotFound},
+		{"post with id", http.MethodPost, "/annotations/works", `{"thing": "1_1", "text": {"de": "Baustelle"}}`, "admin", "secret", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.username != "" {
+				request.SetBasicAuth(test.username, test.password)
+			}
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != test.status {
+				t.Errorf("%s %s = %d, want %d", test.method, test.path, response.StatusCode, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// A lock for the clock state.
+var mutex = &sync.RWMutex{}
+
+// Whether the clock is simulated, e.g. when replaying a recording.
+var simulated = false
+
+// The simulated time at which the simulation was started.
+var origin time.Time
+
+// The real time at which the simulation was started.
+var started time.Time
+
+// The factor by which the simulated time runs faster than the real time.
+var speed float64 = 1
+
+// Let the clock run from the given start time with the given speed factor.
+// A speed of 1 means real time, a speed of 10 means ten times faster.
+func Simulate(start time.Time, factor float64) {
+	if factor <= 0 {
+		factor = 1
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	simulated = true
+	origin = start
+	started = time.Now()
+	speed = factor
+}
+
+// Get the current time, which is either the real or the simulated time.
+func Now() time.Time {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if !simulated {
+		return time.Now()
+	}
+	elapsed := time.Since(started)
+	return origin.Add(time.Duration(float64(elapsed) * speed))
+}
+
+// Sleep for the given duration on the clock, i.e. shorter when the simulation is accelerated.
+func Sleep(d time.Duration) {
+	mutex.RLock()
+	factor := speed
+	isSimulated := simulated
+	mutex.RUnlock()
+	if !isSimulated {
+		time.Sleep(d)
+		return
+	}
+	time.Sleep(time.Duration(float64(d) / factor))
+}
+
+// Sleep until the clock reaches the given time.
+func SleepUntil(t time.Time) {
+	if d := t.Sub(Now()); d > 0 {
+		Sleep(d)
+	}
+}
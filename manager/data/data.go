@@ -0,0 +1,55 @@
+package data
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"monitor/log"
+	"os"
+)
+
+// Load state that was persisted with `Store` into the given value.
+// Returns false if persistence is disabled, i.e. `DATA_PATH` is not set, or nothing was stored yet.
+func Load(name string, v interface{}) bool {
+	dataPath := os.Getenv("DATA_PATH")
+	if dataPath == "" {
+		return false
+	}
+	data, err := ioutil.ReadFile(dataPath + name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning.Printf("Could not read %s: %v\n", name, err)
+		}
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Warning.Printf("Could not parse %s: %v\n", name, err)
+		return false
+	}
+	return true
+}
+
+// Persist state as json under `DATA_PATH`, such that it survives a restart.
+// If `DATA_PATH` is not set, nothing is persisted.
+func Store(name string, v interface{}) {
+	dataPath := os.Getenv("DATA_PATH")
+	if dataPath == "" {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Error.Printf("Error marshalling %s: %v\n", name, err)
+		return
+	}
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		log.Error.Println("Error creating data directory:", err)
+		return
+	}
+	// Write to a temporary file first, such that a crash doesn't leave a truncated file.
+	if err := ioutil.WriteFile(dataPath+name+".tmp", data, 0644); err != nil {
+		log.Error.Printf("Error writing %s: %v\n", name, err)
+		return
+	}
+	if err := os.Rename(dataPath+name+".tmp", dataPath+name); err != nil {
+		log.Error.Printf("Error writing %s: %v\n", name, err)
+	}
+}
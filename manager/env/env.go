@@ -0,0 +1,90 @@
+package env
+
+import (
+	"monitor/log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Get a string from the environment, or the fallback if it is not set.
+func String(name string, fallback string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// Get an integer from the environment, or the fallback if it is not set or invalid.
+func Int(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Warning.Printf("Invalid value for %s: %v, using %d\n", name, err, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// Get a float from the environment, or the fallback if it is not set or invalid.
+func Float(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Warning.Printf("Invalid value for %s: %v, using %v\n", name, err, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// Get a boolean from the environment, or the fallback if it is not set or invalid.
+func Bool(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warning.Printf("Invalid value for %s: %v, using %v\n", name, err, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// Get a duration (e.g. `90s` or `1h`) from the environment, or the fallback if it is not set or invalid.
+func Duration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Warning.Printf("Invalid value for %s: %v, using %v\n", name, err, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// Get a comma separated list from the environment, or nil if it is not set.
+func List(name string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -14,6 +14,12 @@ var (
 	Error *log.Logger
 )
 
+// Create the loggers, such that packages can log without calling `Init`, e.g. in tests.
+func init() {
+	Init()
+}
+
+// Create the loggers that write to stdout and stderr.
 func Init() {
 	Info = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
 	Warning = log.New(os.Stdout, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
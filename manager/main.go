@@ -1,26 +1,144 @@
 package main
 
 import (
+	"monitor/annotations"
+	"monitor/env"
 	"monitor/log"
+	"monitor/maintenance"
+	"monitor/observations"
 	"monitor/predictions"
+	"monitor/recording"
+	"monitor/simulate"
 	"monitor/status"
 	"monitor/sync"
+	"os"
+	"path/filepath"
 )
 
 func main() {
 	log.Init()
 
+	// The command can be given as the first argument. By default, the monitor runs normally.
+	command := "run"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "run":
+		run()
+	case "replay":
+		replay()
+	case "simulate":
+		simulate.Start()
+		run()
+	default:
+		panic("Unknown command: " + command + " (expected run, replay or simulate)")
+	}
+}
+
+// Run the monitor against the live prediction broker.
+func run() {
 	// Start the prediction listener.
 	// We run this before doing anything else to ensure the prediction broker is online.
 	// If the broker is offline, it doesn't make sense to start the sync service.
 	predictions.Listen()
 
+	// Evict the state of expired topics.
+	go predictions.Evict()
+
 	// Start the sync service.
 	go sync.Run()
 
+	// Load the planned maintenance windows.
+	go maintenance.Watch()
+
+	// Serve the admin API for the notes of the operators.
+	go annotations.Serve()
+
+	// Track the observations of the controllers, to tell their outages from prediction service failures.
+	observations.Listen()
+
 	// Monitor the status of the predictions.
 	go status.Monitor()
 
 	// Wait forever.
 	select {}
 }
+
+// Run the monitor against a recording instead of the live prediction broker.
+func replay() {
+	replayPath := os.Getenv("REPLAY_PATH")
+	if replayPath == "" {
+		panic("REPLAY_PATH not set")
+	}
+
+	// The replay must not overwrite the files and the state of the live monitor.
+	isolateReplay()
+
+	// Start the replay first, such that the monitor runs on the simulated clock.
+	if err := recording.StartReplay(replayPath, env.Float("REPLAY_SPEED", 1), predictions.Ingest); err != nil {
+		panic("Could not start replay: " + err.Error())
+	}
+
+	// Evict the state of expired topics.
+	go predictions.Evict()
+
+	// Start the sync service.
+	go sync.Run()
+
+	// Load the planned maintenance windows.
+	go maintenance.Watch()
+
+	// Serve the admin API for the notes of the operators.
+	go annotations.Serve()
+
+	// Monitor the status of the predictions.
+	go status.Monitor()
+
+	// Wait forever.
+	select {}
+}
+
+// Point the outputs of the monitor to separate paths for the replay, such that a replay
+// with the production environment doesn't overwrite the live files and persisted state.
+func isolateReplay() {
+	staticPath := os.Getenv("REPLAY_STATIC_PATH")
+	if staticPath == "" {
+		panic("REPLAY_STATIC_PATH not set")
+	}
+	if samePath(staticPath, os.Getenv("STATIC_PATH")) {
+		panic("REPLAY_STATIC_PATH must differ from STATIC_PATH")
+	}
+	os.Setenv("STATIC_PATH", staticPath)
+
+	// Without a separate data path, nothing is loaded or persisted.
+	dataPath := os.Getenv("REPLAY_DATA_PATH")
+	if dataPath != "" && samePath(dataPath, os.Getenv("DATA_PATH")) {
+		panic("REPLAY_DATA_PATH must differ from DATA_PATH")
+	}
+	if dataPath == "" {
+		os.Unsetenv("DATA_PATH")
+		log.Info.Println("Persistence is disabled during the replay.")
+	} else {
+		os.Setenv("DATA_PATH", dataPath)
+	}
+
+	if !env.Bool("REPLAY_PUSH", false) {
+		status.DisablePush()
+		log.Info.Println("Pushing to the workers is disabled during the replay.")
+	}
+}
+
+// Check whether two paths point to the same directory.
+func samePath(a string, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
@@ -0,0 +1,209 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/clock"
+	"monitor/env"
+	"monitor/log"
+	"monitor/sync"
+	"os"
+	gosync "sync"
+	"time"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// A planned outage, e.g. a construction site or a scheduled maintenance of a controller.
+// A window applies to a thing if it is global, or if any of its things, intersections or its area matches.
+type Window struct {
+	// A unique id of the window.
+	Id string `json:"id"`
+	// A description of the planned outage for operators.
+	Description string `json:"description"`
+	// The time at which the window starts, if it doesn't apply from the start.
+	Start *time.Time `json:"start"`
+	// The time at which the window ends, if it doesn't apply until further notice.
+	End *time.Time `json:"end"`
+	// Whether the window applies to all things.
+	Global bool `json:"global"`
+	// The names of the things to which the window applies, e.g. `123_4`.
+	Things []string `json:"things"`
+	// The intersections to which the window applies, see `Thing.Intersection`.
+	Intersections []string `json:"intersections"`
+	// A WGS84 Polygon or MultiPolygon. The window applies to the things whose stop lines lie within it.
+	Area *geojson.Geometry `json:"area"`
+}
+
+// The maintenance windows from the config file.
+var windows = make([]Window, 0)
+
+// A lock for the maintenance windows.
+var windowsMutex = &gosync.Mutex{}
+
+// Load the maintenance windows from the file at `MAINTENANCE_PATH`, if set, and reload them
+// whenever the file changed. The file is checked every `MAINTENANCE_WATCH_INTERVAL`.
+func Watch() {
+	path := os.Getenv("MAINTENANCE_PATH")
+	if path == "" {
+		return
+	}
+	interval := env.Duration("MAINTENANCE_WATCH_INTERVAL", 10*time.Second)
+	last := ""
+	for {
+		if current := signature(path); current != last {
+			last = current
+			load(path)
+		}
+		clock.Sleep(interval)
+	}
+}
+
+// Get a signature of the size and modification time of the file, to detect changes.
+func signature(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// Load the maintenance windows from the file. If the file is invalid, the previous windows are kept.
+func load(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Error.Println("Could not read maintenance windows:", err)
+		return
+	}
+	var loaded []Window
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		log.Error.Println("Could not parse maintenance windows, keeping the previous ones:", err)
+		return
+	}
+	valid := make([]Window, 0, len(loaded))
+	for _, window := range loaded {
+		if err := window.validate(); err != nil {
+			log.Warning.Printf("Ignoring maintenance window %s: %v\n", window.Id, err)
+			continue
+		}
+		valid = append(valid, window)
+	}
+	windowsMutex.Lock()
+	windows = valid
+	windowsMutex.Unlock()
+	log.Info.Printf("Loaded %d maintenance windows.\n", len(valid))
+}
+
+// Check that the window selects something and that its area is a polygon.
+func (window Window) validate() error {
+	if window.Id == "" {
+		return fmt.Errorf("missing id")
+	}
+	if !window.Global && len(window.Things) == 0 && len(window.Intersections) == 0 && window.Area == nil {
+		return fmt.Errorf("selects no things")
+	}
+	if window.Area != nil && !window.Area.IsPolygon() && !window.Area.IsMultiPolygon() {
+		return fmt.Errorf("area is a %s, not a Polygon or MultiPolygon", window.Area.Type)
+	}
+	if window.Start != nil && window.End != nil && !window.End.After(*window.Start) {
+		return fmt.Errorf("ends before it starts")
+	}
+	return nil
+}
+
+// Check whether the window is active at the given time.
+func (window Window) ActiveAt(now time.Time) bool {
+	if window.Start != nil && now.Before(*window.Start) {
+		return false
+	}
+	if window.End != nil && !now.Before(*window.End) {
+		return false
+	}
+	return true
+}
+
+// Check whether the window applies to the thing.
+func (window Window) AppliesTo(thing sync.Thing) bool {
+	if window.Global {
+		return true
+	}
+	for _, name := range window.Things {
+		if name == thing.Name {
+			return true
+		}
+	}
+	intersection := thing.Intersection()
+	for _, id := range window.Intersections {
+		if id == intersection {
+			return true
+		}
+	}
+	if window.Area != nil {
+		point, err := thing.StopLine()
+		if err != nil {
+			lane, err := thing.Lane()
+			if err != nil {
+				return false
+			}
+			point = lane[0]
+		}
+		if window.Area.IsPolygon() {
+			return polygonContains(window.Area.Polygon, point)
+		}
+		for _, polygon := range window.Area.MultiPolygon {
+			if polygonContains(polygon, point) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Get the first maintenance window that is active for the thing at the given time, if there is one.
+func Active(thing sync.Thing, now time.Time) *Window {
+	windowsMutex.Lock()
+	defer windowsMutex.Unlock()
+	for _, window := range windows {
+		if window.ActiveAt(now) && window.AppliesTo(thing) {
+			active := window
+			return &active
+		}
+	}
+	return nil
+}
+
+// Get all maintenance windows.
+func Windows() []Window {
+	windowsMutex.Lock()
+	defer windowsMutex.Unlock()
+	copied := make([]Window, len(windows))
+	copy(copied, windows)
+	return copied
+}
+
+// Check whether a [lng, lat] point lies within a polygon, i.e. within its outer ring and outside of its holes.
+func polygonContains(polygon [][][]float64, point []float64) bool {
+	if len(polygon) == 0 || !ringContains(polygon[0], point) {
+		return false
+	}
+	for _, hole := range polygon[1:] {
+		if ringContains(hole, point) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether a [lng, lat] point lies within a ring, by casting a ray and counting the crossed edges.
+func ringContains(ring [][]float64, point []float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > point[1]) != (b[1] > point[1]) &&
+			point[0] < (b[0]-a[0])*(point[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,187 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"monitor/sync"
+	"testing"
+	"time"
+
+	geojson "github.com/paulmach/go.geojson"
+)
+
+// A square from 0 to 10 in both directions.
+var square = [][]float64{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}
+
+// A square hole from 4 to 6 in both directions.
+var hole = [][]float64{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}}
+
+func TestRingContains(t *testing.T) {
+	// A concave ring in the shape of a U, open to the top.
+	u := [][]float64{{0, 0}, {10, 0}, {10, 10}, {7, 10}, {7, 3}, {3, 3}, {3, 10}, {0, 10}, {0, 0}}
+	// The same square without the closing point.
+	open := [][]float64{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	tests := []struct {
+		name  string
+		ring  [][]float64
+		point []float64
+		want  bool
+	}{
+		{"inside", square, []float64{5, 5}, true},
+		{"outside to the right", square, []float64{15, 5}, false},
+		{"outside to the left", square, []float64{-5, 5}, false},
+		{"outside above", square, []float64{5, 15}, false},
+		{"at the height of a vertex", square, []float64{5, 10.0000001}, false},
+		{"inside the concave part", u, []float64{1, 8}, true},
+		{"in the notch of the concave part", u, []float64{5, 8}, false},
+		{"below the notch", u, []float64{5, 1}, true},
+		{"unclosed ring", open, []float64{5, 5}, true},
+		{"empty ring", [][]float64{}, []float64{5, 5}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ringContains(test.ring, test.point); got != test.want {
+				t.Errorf("ringContains(%v) = %v, want %v", test.point, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolygonContains(t *testing.T) {
+	tests := []struct {
+		name    string
+		polygon [][][]float64
+		point   []float64
+		want    bool
+	}{
+		{"inside", [][][]float64{square}, []float64{2, 2}, true},
+		{"outside", [][][]float64{square}, []float64{12, 2}, false},
+		{"inside the hole", [][][]float64{square, hole}, []float64{5, 5}, false},
+		{"next to the hole", [][][]float64{square, hole}, []float64{2, 5}, true},
+		{"empty polygon", [][][]float64{}, []float64{5, 5}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := polygonContains(test.polygon, test.point); got != test.want {
+				t.Errorf("polygonContains(%v) = %v, want %v", test.point, got, test.want)
+			}
+		})
+	}
+}
+
+func TestActiveAt(t *testing.T) {
+	start := time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 5, 1, 16, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		window Window
+		now    time.Time
+		want   bool
+	}{
+		{"unbounded", Window{}, start, true},
+		{"before the start", Window{Start: &start, End: &end}, start.Add(-time.Second), false},
+		{"at the start", Window{Start: &start, End: &end}, start, true},
+		{"within", Window{Start: &start, End: &end}, start.Add(time.Hour), true},
+		{"at the end", Window{Start: &start, End: &end}, end, false},
+		{"until further notice", Window{Start: &start}, end.Add(24 * time.Hour), true},
+		{"from the start", Window{End: &end}, start.Add(-24 * time.Hour), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.window.ActiveAt(test.now); got != test.want {
+				t.Errorf("ActiveAt = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// Build a thing whose ingress lane ends at the given stop line.
+func thingAt(name string, stopLine []float64) sync.Thing {
+	var thing sync.Thing
+	thing.Name = name
+	location := sync.Location{}
+	location.Location.Geometry.Coordinates = [][][]float64{
+		{{stopLine[0] - 1, stopLine[1]}, stopLine},
+		{stopLine, {stopLine[0] + 1, stopLine[1]}},
+	}
+	thing.Locations = []sync.Location{location}
+	return thing
+}
+
+func TestAppliesTo(t *testing.T) {
+	area := geojson.NewPolygonGeometry([][][]float64{square, hole})
+	multiArea := geojson.NewMultiPolygonGeometry([][][]float64{hole}, [][][]float64{{{20, 20}, {30, 20}, {30, 30}, {20, 30}, {20, 20}}})
+	tests := []struct {
+		name   string
+		window Window
+		thing  sync.Thing
+		want   bool
+	}{
+		{"global", Window{Global: true}, thingAt("1_1", []float64{50, 50}), true},
+		{"listed thing", Window{Things: []string{"1_2", "1_1"}}, thingAt("1_1", []float64{50, 50}), true},
+		{"other thing", Window{Things: []string{"1_2"}}, thingAt("1_1", []float64{50, 50}), false},
+		{"listed intersection", Window{Intersections: []string{"1"}}, thingAt("1_1", []float64{50, 50}), true},
+		{"other intersection", Window{Intersections: []string{"11"}}, thingAt("1_1", []float64{50, 50}), false},
+		{"stop line in the area", Window{Area: area}, thingAt("1_1", []float64{2, 2}), true},
+		{"stop line in the hole of the area", Window{Area: area}, thingAt("1_1", []float64{5, 5}), false},
+		{"stop line outside of the area", Window{Area: area}, thingAt("1_1", []float64{50, 50}), false},
+		{"stop line in a part of a multi polygon", Window{Area: multiArea}, thingAt("1_1", []float64{25, 25}), true},
+		{"stop line outside of a multi polygon", Window{Area: multiArea}, thingAt("1_1", []float64{15, 15}), false},
+		{"thing without location", Window{Area: area}, sync.Thing{Name: "1_1"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.window.AppliesTo(test.thing); got != test.want {
+				t.Errorf("AppliesTo = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	start := time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	tests := []struct {
+		name string
+		body string
+		ids  []string
+	}{
+		{"valid windows", mustJson(t, []Window{{Id: "a", Global: true}, {Id: "b", Things: []string{"1_1"}, Start: &start, End: &end}}), []string{"a", "b"}},
+		{"invalid windows are ignored", mustJson(t, []Window{
+			{Id: "a", Global: true},
+			{Global: true},
+			{Id: "no things"},
+			{Id: "ends before it starts", Global: true, Start: &end, End: &start},
+			{Id: "point area", Area: geojson.NewPointGeometry([]float64{1, 2})},
+		}), []string{"a"}},
+		{"invalid file keeps the previous windows", "[{", []string{"a"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := t.TempDir() + "/maintenance.json"
+			if err := ioutil.WriteFile(path, []byte(test.body), 0644); err != nil {
+				t.Fatal(err)
+			}
+			load(path)
+			loaded := Windows()
+			if len(loaded) != len(test.ids) {
+				t.Fatalf("Loaded %d windows, want %v", len(loaded), test.ids)
+			}
+			for i, window := range loaded {
+				if window.Id != test.ids[i] {
+					t.Errorf("Window %d = %s, want %s", i, window.Id, test.ids[i])
+				}
+			}
+		})
+	}
+}
+
+// Marshal the value to json or fail the test.
+func mustJson(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
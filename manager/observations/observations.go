@@ -0,0 +1,241 @@
+package observations
+
+import (
+	"fmt"
+	"math/rand"
+	"monitor/clock"
+	"monitor/env"
+	"monitor/log"
+	"monitor/sync"
+	"os"
+	"sort"
+	gosync "sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// Observations are received via the MQTT extension of the SensorThings API.
+	SourceMqtt = "mqtt"
+	// The latest observations are polled from the SensorThings API.
+	SourcePoll = "poll"
+	// Observations are not tracked.
+	SourceOff = "off"
+)
+
+// The time of the latest observation of each datastream, by datastream id.
+var lastObservations = make(map[int]time.Time)
+
+// The number of received observations.
+var received = 0
+
+// The time at which the tracking of observations started, if it started.
+var started *time.Time
+
+// A lock for the observations.
+var observationsMutex = &gosync.Mutex{}
+
+// Track the observations of the source datastreams of all known things, such that outages of the
+// controllers can be told apart from outages of the prediction service. The source is configured with
+// `OBSERVATION_SOURCE`. By default, the MQTT extension is used if `SENSORTHINGS_MQTT_URL` is set.
+func Listen() {
+	source := SourceOff
+	if os.Getenv("SENSORTHINGS_MQTT_URL") != "" {
+		source = SourceMqtt
+	}
+	source = env.String("OBSERVATION_SOURCE", source)
+
+	switch source {
+	case SourceMqtt:
+		go listenMqtt()
+	case SourcePoll:
+		go poll()
+	case SourceOff:
+		log.Info.Println("Observations are not tracked.")
+		return
+	default:
+		panic("Unknown OBSERVATION_SOURCE: " + source)
+	}
+
+	now := clock.Now()
+	observationsMutex.Lock()
+	started = &now
+	observationsMutex.Unlock()
+}
+
+// Record an observation of a datastream at the given time.
+func observe(datastreamId int, t time.Time) {
+	observationsMutex.Lock()
+	defer observationsMutex.Unlock()
+	if last, ok := lastObservations[datastreamId]; !ok || t.After(last) {
+		lastObservations[datastreamId] = t
+	}
+	received++
+}
+
+// Get the time of the latest observation of any of the given datastreams, if there is one.
+func Last(datastreams []sync.Datastream) (time.Time, bool) {
+	observationsMutex.Lock()
+	defer observationsMutex.Unlock()
+	var latest time.Time
+	ok := false
+	for _, datastream := range datastreams {
+		if t, found := lastObservations[datastream.IotId]; found && (!ok || t.After(latest)) {
+			latest = t
+			ok = true
+		}
+	}
+	return latest, ok
+}
+
+// Get the time at which the tracking of observations started, if observations are tracked.
+func Started() (time.Time, bool) {
+	observationsMutex.Lock()
+	defer observationsMutex.Unlock()
+	if started == nil {
+		return time.Time{}, false
+	}
+	return *started, true
+}
+
+// Get the number of received observations and the number of datastreams with observations.
+func Counts() (int, int) {
+	observationsMutex.Lock()
+	defer observationsMutex.Unlock()
+	return received, len(lastObservations)
+}
+
+// Get the ids of the source datastreams of all known things.
+func sourceDatastreamIds() []int {
+	sync.ThingsMutex.Lock()
+	defer sync.ThingsMutex.Unlock()
+	ids := make([]int, 0, len(sync.Things))
+	for _, thing := range sync.Things {
+		for _, datastream := range thing.SourceDatastreams() {
+			ids = append(ids, datastream.IotId)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Receive the observations of the source datastreams via the MQTT extension of the SensorThings API.
+// The subscriptions are kept in sync with the known things, like the prediction subscriptions.
+func listenMqtt() {
+	mqttUrl := os.Getenv("SENSORTHINGS_MQTT_URL")
+	if mqttUrl == "" {
+		panic("SENSORTHINGS_MQTT_URL not set")
+	}
+	topicFormat := env.String("OBSERVATION_MQTT_TOPIC", "v1.1/Datastreams(%d)/Observations")
+	log.Info.Println("Connecting to SensorThings mqtt broker for observations at:", mqttUrl)
+
+	// The subscriptions are lost on a reconnect, since the session is not persisted.
+	connected := make(chan struct{}, 1)
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(mqttUrl)
+	mqttUsername := os.Getenv("SENSORTHINGS_MQTT_USERNAME")
+	mqttPassword := os.Getenv("SENSORTHINGS_MQTT_PASSWORD")
+	if mqttUsername != "" && mqttPassword != "" {
+		opts.SetUsername(mqttUsername)
+		opts.SetPassword(mqttPassword)
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetPingTimeout(10 * time.Second)
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	opts.SetClientID(fmt.Sprintf("priobike-prediction-monitor-observations-%d", random.Int()))
+	opts.SetOrderMatters(false)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Info.Println("Connected to SensorThings mqtt broker for observations.")
+		select {
+		case connected <- struct{}{}:
+		default:
+		}
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Warning.Println("Connection to SensorThings mqtt broker for observations lost, reconnecting:", err)
+	})
+	client := mqtt.NewClient(opts)
+	client.Connect()
+
+	batchSize := env.Int("MQTT_SUBSCRIBE_BATCH", 100)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	subscribed := make(map[int]bool)
+	lastVersion := -1
+	for {
+		select {
+		case <-connected:
+			subscribed = make(map[int]bool)
+			lastVersion = -1
+		default:
+		}
+		version := sync.Version()
+		if version == lastVersion || !client.IsConnectionOpen() {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		lastVersion = version
+
+		desired := make(map[int]bool)
+		for _, id := range sourceDatastreamIds() {
+			desired[id] = true
+		}
+		toSubscribe := make([]int, 0)
+		for id := range desired {
+			if !subscribed[id] {
+				toSubscribe = append(toSubscribe, id)
+			}
+		}
+		toUnsubscribe := make([]string, 0)
+		for id := range subscribed {
+			if !desired[id] {
+				toUnsubscribe = append(toUnsubscribe, fmt.Sprintf(topicFormat, id))
+				delete(subscribed, id)
+			}
+		}
+		sort.Ints(toSubscribe)
+
+		for start := 0; start < len(toSubscribe); start += batchSize {
+			end := start + batchSize
+			if end > len(toSubscribe) {
+				end = len(toSubscribe)
+			}
+			filters := make(map[string]byte, end-start)
+			for _, id := range toSubscribe[start:end] {
+				filters[fmt.Sprintf(topicFormat, id)] = 0
+			}
+			if sub := client.SubscribeMultiple(filters, onObservation(topicFormat)); sub.Wait() && sub.Error() != nil {
+				log.Error.Println("Could not subscribe to observation topics:", sub.Error())
+				lastVersion = -1 // Retry in the next round.
+				break
+			}
+			for _, id := range toSubscribe[start:end] {
+				subscribed[id] = true
+			}
+		}
+		if len(toUnsubscribe) > 0 {
+			if unsub := client.Unsubscribe(toUnsubscribe...); unsub.Wait() && unsub.Error() != nil {
+				log.Error.Println("Could not unsubscribe from observation topics:", unsub.Error())
+			}
+		}
+		if len(toSubscribe) > 0 || len(toUnsubscribe) > 0 {
+			log.Info.Printf("Subscribed to observations of %d datastreams.\n", len(subscribed))
+		}
+	}
+}
+
+// Create a callback that records an observation on a topic of the given format with its receive time.
+func onObservation(topicFormat string) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		var datastreamId int
+		if _, err := fmt.Sscanf(msg.Topic(), topicFormat, &datastreamId); err != nil {
+			log.Warning.Println("Could not parse datastream of observation topic:", msg.Topic())
+			return
+		}
+		observe(datastreamId, clock.Now())
+	}
+}
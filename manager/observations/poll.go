@@ -0,0 +1,97 @@
+package observations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/clock"
+	"monitor/env"
+	"monitor/log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// A datastream with its latest observation from the SensorThings API.
+type datastreamResponse struct {
+	IotId        int `json:"@iot.id"`
+	Observations []struct {
+		PhenomenonTime string `json:"phenomenonTime"`
+	} `json:"Observations"`
+}
+
+// Periodically poll the latest observation of each source datastream from the SensorThings API,
+// every `OBSERVATION_POLL_INTERVAL` in batches of `OBSERVATION_POLL_BATCH` datastreams.
+func poll() {
+	for {
+		batchSize := env.Int("OBSERVATION_POLL_BATCH", 50)
+		if batchSize < 1 {
+			batchSize = 1
+		}
+		ids := sourceDatastreamIds()
+		for start := 0; start < len(ids); start += batchSize {
+			end := start + batchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			if err := pollBatch(ids[start:end]); err != nil {
+				log.Warning.Println("Could not poll observations:", err)
+			}
+		}
+		clock.Sleep(env.Duration("OBSERVATION_POLL_INTERVAL", 1*time.Minute))
+	}
+}
+
+// Fetch the latest observation of each of the given datastreams.
+func pollBatch(ids []int) error {
+	baseUrl := os.Getenv("SENSORTHINGS_URL")
+	if baseUrl == "" {
+		panic("SENSORTHINGS_URL is not set")
+	}
+	filters := make([]string, 0, len(ids))
+	for _, id := range ids {
+		filters = append(filters, fmt.Sprintf("@iot.id eq %d", id))
+	}
+	pageUrl := baseUrl + "Datastreams?%24filter=" + url.QueryEscape(strings.Join(filters, " or ")) +
+		"&%24expand=" + url.QueryEscape("Observations($orderby=phenomenonTime desc;$top=1)")
+	for {
+		resp, err := http.Get(pageUrl)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		var response struct {
+			Value   []datastreamResponse `json:"value"`
+			NextUri *string              `json:"@iot.nextLink"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return err
+		}
+		for _, datastream := range response.Value {
+			if len(datastream.Observations) == 0 {
+				continue
+			}
+			// The phenomenon time can be an interval, in which case its end is used.
+			phenomenonTime := datastream.Observations[0].PhenomenonTime
+			if i := strings.Index(phenomenonTime, "/"); i >= 0 {
+				phenomenonTime = phenomenonTime[i+1:]
+			}
+			t, err := time.Parse(time.RFC3339, phenomenonTime)
+			if err != nil {
+				log.Warning.Printf("Could not parse phenomenon time of datastream %d: %v\n", datastream.IotId, err)
+				continue
+			}
+			observe(datastream.IotId, t)
+		}
+		if response.NextUri == nil {
+			return nil
+		}
+		pageUrl = *response.NextUri
+	}
+}
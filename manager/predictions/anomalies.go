@@ -0,0 +1,193 @@
+package predictions
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"monitor/env"
+	"sync"
+)
+
+// The anomalies that can be detected in the recent predictions of a topic.
+const (
+	// The identical value vector was sent over and over.
+	AnomalyStuck = "stuck"
+	// The prediction quality flaps between good and bad.
+	AnomalyFlapping = "flapping"
+	// The start time of the predictions does not advance.
+	AnomalyStartTimeStuck = "start_time_stuck"
+	// The value vectors contain no green at all.
+	AnomalyAllRed = "all_red"
+)
+
+// All anomaly types, in the order in which they are reported.
+var AnomalyTypes = []string{AnomalyStuck, AnomalyFlapping, AnomalyStartTimeStuck, AnomalyAllRed}
+
+// The minimum number of predictions in the window before anomalies are detected.
+const anomalyMinSamples = 3
+
+// The number of large quality jumps in the window that are considered flapping.
+const anomalyFlappingJumps = 3
+
+// A quality change of at least this size is considered a large jump.
+const anomalyQualityJump = 0.5
+
+// A compact summary of a received prediction, used for anomaly detection.
+type anomalySample struct {
+	// A hash of the value vector.
+	valueHash uint64
+	// The prediction quality.
+	quality float64
+	// The parsed start time, if it could be parsed.
+	startTime *int64
+	// Whether the value vector contains no green at all.
+	allRed bool
+	// Whether the value vector continues the previous one, aligned to the advanced start time.
+	shifted bool
+}
+
+// The number of predictions in the window of each topic, see `ANOMALY_WINDOW`.
+var anomalyWindowSize = env.Int("ANOMALY_WINDOW", 10)
+
+// Check whether the current prediction starts after the previous one and continues it, i.e. both
+// vectors agree on every second they cover. A fixed-time program that is republished after a whole
+// number of cycles yields an identical vector that is shifted like this. If the vectors don't overlap,
+// they can't be compared and the current one is assumed to continue the previous one.
+func isShifted(previous Prediction, previousStartTime int64, current Prediction, startTime int64) bool {
+	shift := startTime - previousStartTime
+	if shift <= 0 {
+		return false
+	}
+	for i := 0; int64(i)+shift < int64(len(previous.Value)) && i < len(current.Value); i++ {
+		if current.Value[i] != previous.Value[int64(i)+shift] {
+			return false
+		}
+	}
+	return true
+}
+
+// A map that contains the window of recent predictions for each mqtt topic.
+var anomalyWindows = make(map[string][]anomalySample)
+
+// A map that contains the currently detected anomalies for each mqtt topic.
+var anomalies = make(map[string][]string)
+
+// A map that counts how often each anomaly type was newly detected since startup.
+var anomalyDetections = make(map[string]int)
+
+// A lock for the anomaly maps.
+var anomaliesMutex = &sync.Mutex{}
+
+// Add the prediction to the window of the topic and update the detected anomalies.
+// Shifted tells whether the prediction continues the previous one of the topic, see `isShifted`.
+func detectAnomalies(topic string, prediction Prediction, startTime *int64, shifted bool) {
+	hash := fnv.New64a()
+	buf := make([]byte, 8)
+	allRed := true
+	for _, value := range prediction.Value {
+		binary.LittleEndian.PutUint64(buf, uint64(value))
+		hash.Write(buf)
+		if value >= prediction.GreentimeThreshold {
+			allRed = false
+		}
+	}
+	sample := anomalySample{
+		valueHash: hash.Sum64(),
+		quality:   prediction.PredictionQuality,
+		startTime: startTime,
+		allRed:    allRed,
+		shifted:   shifted,
+	}
+
+	windowSize := anomalyWindowSize
+	if windowSize < anomalyMinSamples {
+		windowSize = anomalyMinSamples
+	}
+
+	anomaliesMutex.Lock()
+	defer anomaliesMutex.Unlock()
+	window := append(anomalyWindows[topic], sample)
+	if len(window) > windowSize {
+		window = window[len(window)-windowSize:]
+	}
+	anomalyWindows[topic] = window
+
+	detected := make([]string, 0)
+	if len(window) >= anomalyMinSamples {
+		stuck, startTimeStuck, allRed := true, true, true
+		jumps := 0
+		for i, s := range window {
+			// An identical vector is only stuck if it isn't explained by an advancing start time.
+			if s.valueHash != window[0].valueHash || (i > 0 && s.shifted) {
+				stuck = false
+			}
+			if !s.allRed {
+				allRed = false
+			}
+			if s.startTime == nil || window[0].startTime == nil || *s.startTime > *window[0].startTime {
+				startTimeStuck = false
+			}
+			if i > 0 && math.Abs(s.quality-window[i-1].quality) >= anomalyQualityJump {
+				jumps++
+			}
+		}
+		if stuck {
+			detected = append(detected, AnomalyStuck)
+		}
+		if jumps >= anomalyFlappingJumps {
+			detected = append(detected, AnomalyFlapping)
+		}
+		if startTimeStuck {
+			detected = append(detected, AnomalyStartTimeStuck)
+		}
+		if allRed {
+			detected = append(detected, AnomalyAllRed)
+		}
+	}
+
+	// Count anomalies that were not detected for this topic before.
+	for _, anomaly := range detected {
+		if !contains(anomalies[topic], anomaly) {
+			anomalyDetections[anomaly]++
+		}
+	}
+	anomalies[topic] = detected
+}
+
+// Get the currently detected anomalies of the topic.
+func Anomalies(topic string) []string {
+	anomaliesMutex.Lock()
+	defer anomaliesMutex.Unlock()
+	detected := make([]string, len(anomalies[topic]))
+	copy(detected, anomalies[topic])
+	return detected
+}
+
+// Get the number of topics that currently show each anomaly type,
+// and how often each anomaly type was newly detected since startup.
+func AnomalyCounts() (map[string]int, map[string]int) {
+	anomaliesMutex.Lock()
+	defer anomaliesMutex.Unlock()
+	current := make(map[string]int)
+	detections := make(map[string]int)
+	for _, anomaly := range AnomalyTypes {
+		current[anomaly] = 0
+		detections[anomaly] = anomalyDetections[anomaly]
+	}
+	for _, detected := range anomalies {
+		for _, anomaly := range detected {
+			current[anomaly]++
+		}
+	}
+	return current, detections
+}
+
+// Check whether the list contains the value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
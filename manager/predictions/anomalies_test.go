@@ -0,0 +1,122 @@
+package predictions
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A prediction message of a test sequence.
+type testMessage struct {
+	// The offset of the start time from the start of the sequence in seconds.
+	offset int
+	// The value vector.
+	values []int64
+	// The prediction quality.
+	quality float64
+}
+
+// Ingest the messages on the topic and return the detected anomalies.
+func ingestSequence(t *testing.T, topic string, messages []testMessage) []string {
+	t.Helper()
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, message := range messages {
+		startTime := start.Add(time.Duration(message.offset) * time.Second)
+		payload, err := json.Marshal(map[string]interface{}{
+			"greentimeThreshold": 50,
+			"predictionQuality":  message.quality,
+			"signalGroupId":      topic,
+			"startTime":          startTime.Format(time.RFC3339),
+			"timestamp":          startTime.Format(time.RFC3339),
+			"value":              message.values,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		Ingest(topic, payload, startTime)
+	}
+	return Anomalies(topic)
+}
+
+// Build a sequence of messages that are published every `interval` seconds with the given values.
+func sequence(count int, interval int, values func(offset int) []int64, quality func(i int) float64) []testMessage {
+	messages := make([]testMessage, count)
+	for i := range messages {
+		messages[i] = testMessage{offset: i * interval, values: values(i * interval), quality: quality(i)}
+	}
+	return messages
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	// A non-periodic vector with a single green phase.
+	irregular := make([]int64, 300)
+	for i := 40; i < 70; i++ {
+		irregular[i] = 100
+	}
+	same := func(values []int64) func(int) []int64 {
+		return func(int) []int64 { return values }
+	}
+	// The vector of a fixed-time program, generated for the given start offset.
+	program := func(offset int) []int64 {
+		return programVector(300, 60, 20, (60-offset%60)%60)
+	}
+	good := func(int) float64 { return 0.9 }
+	// New vectors that all claim the same start time.
+	startTimeStuck := make([]testMessage, 10)
+	for i := range startTimeStuck {
+		startTimeStuck[i] = testMessage{values: programVector(300, 60, 20+i, 0), quality: 0.9}
+	}
+	flapping := func(i int) float64 { return float64(i%2)*0.8 + 0.1 }
+
+	tests := []struct {
+		name      string
+		messages  []testMessage
+		anomalies []string
+	}{
+		{"too few samples", sequence(2, 10, same(irregular), good), []string{}},
+		{"regular updates", sequence(10, 10, program, good), []string{}},
+		{"identical vector with advancing start time", sequence(10, 10, same(irregular), good), []string{AnomalyStuck}},
+		{"fixed-time program republished after whole cycles", sequence(10, 60, same(programVector(300, 60, 20, 0)), good), []string{}},
+		{"fixed-time program republished within a cycle", sequence(10, 10, same(programVector(300, 60, 20, 0)), good), []string{AnomalyStuck}},
+		{"identical vector without overlap", sequence(10, 400, same(irregular), good), []string{}},
+		{"republished prediction", sequence(10, 0, same(irregular), good), []string{AnomalyStuck, AnomalyStartTimeStuck}},
+		{"start time not advancing", startTimeStuck, []string{AnomalyStartTimeStuck}},
+		{"flapping quality", sequence(10, 10, program, flapping), []string{AnomalyFlapping}},
+		{"all red", sequence(10, 10, func(offset int) []int64 { return make([]int64, 300-offset%7) }, good), []string{AnomalyAllRed}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			detected := ingestSequence(t, "test/anomalies/"+test.name, test.messages)
+			if !reflect.DeepEqual(detected, test.anomalies) {
+				t.Errorf("Anomalies = %v, want %v", detected, test.anomalies)
+			}
+		})
+	}
+}
+
+func TestIsShifted(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous          []int64
+		previousStartTime int64
+		current           []int64
+		startTime         int64
+		shifted           bool
+	}{
+		{"same start time", []int64{0, 100, 0}, 10, []int64{0, 100, 0}, 10, false},
+		{"earlier start time", []int64{0, 100, 0}, 10, []int64{100, 0, 0}, 9, false},
+		{"continues", []int64{0, 0, 100, 100, 0}, 10, []int64{100, 100, 0, 0}, 12, true},
+		{"differs", []int64{0, 0, 100, 100, 0}, 10, []int64{100, 0, 0, 0}, 12, false},
+		{"no overlap", []int64{0, 100}, 10, []int64{0, 0}, 20, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := Prediction{Value: test.previous}
+			current := Prediction{Value: test.current}
+			if got := isShifted(previous, test.previousStartTime, current, test.startTime); got != test.shifted {
+				t.Errorf("isShifted = %v, want %v", got, test.shifted)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package predictions
+
+import (
+	"monitor/env"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The publishing cadence of a topic, learned from the recent inter-arrival gaps.
+type Cadence struct {
+	// The number of messages received since startup.
+	Messages int
+	// The number of messages per minute in the recent window.
+	Rate float64
+	// The median gap between two messages in seconds.
+	MedianGap float64
+	// The 95th percentile gap between two messages in seconds.
+	P95Gap float64
+	// The mean message size in bytes.
+	MessageSize float64
+	// The seconds since the last message.
+	Gap float64
+	// Whether the current gap far exceeds the learned cadence.
+	Silent bool
+}
+
+// The recent message history of a topic.
+type cadenceHistory struct {
+	// The number of messages received since startup.
+	messages int
+	// The time of the last message.
+	lastReceived time.Time
+	// The recent gaps between two messages in seconds.
+	gaps []float64
+	// The recent message sizes in bytes.
+	sizes []int
+}
+
+// The number of recent gaps and message sizes kept per topic, see `CADENCE_WINDOW`.
+var cadenceWindowSize = env.Int("CADENCE_WINDOW", 50)
+
+// The number of gaps before a topic can be silent, see `CADENCE_MIN_SAMPLES`.
+var cadenceMinSamples = env.Int("CADENCE_MIN_SAMPLES", 10)
+
+// The factor of the 95th percentile gap above which a topic is silent, see `CADENCE_SILENCE_FACTOR`.
+var cadenceSilenceFactor = env.Float("CADENCE_SILENCE_FACTOR", 3)
+
+// The gap in seconds below which a topic is never silent, see `CADENCE_MIN_SILENCE`.
+var cadenceMinSilence = env.Duration("CADENCE_MIN_SILENCE", 30*time.Second).Seconds()
+
+// A map that contains the recent message history for each mqtt topic.
+var cadences = make(map[string]*cadenceHistory)
+
+// A lock for the cadences map.
+var cadencesMutex = &sync.Mutex{}
+
+// Record a message of the given size that was received on the topic.
+func trackCadence(topic string, size int, receivedAt time.Time) {
+	cadencesMutex.Lock()
+	defer cadencesMutex.Unlock()
+	history, ok := cadences[topic]
+	if !ok {
+		history = &cadenceHistory{}
+		cadences[topic] = history
+	}
+	if history.messages > 0 {
+		gap := receivedAt.Sub(history.lastReceived).Seconds()
+		if gap >= 0 {
+			history.gaps = appendWindow(history.gaps, gap, cadenceWindowSize)
+		}
+	}
+	history.sizes = appendWindowInt(history.sizes, size, cadenceWindowSize)
+	history.lastReceived = receivedAt
+	history.messages++
+}
+
+// Get the cadence of the topic at the given time, if a message was received on it.
+// A topic is silent if its current gap exceeds `CADENCE_SILENCE_FACTOR` times its 95th percentile gap,
+// once at least `CADENCE_MIN_SAMPLES` gaps were observed. Gaps below `CADENCE_MIN_SILENCE` are never silent.
+func GetCadence(topic string, now time.Time) (Cadence, bool) {
+	cadencesMutex.Lock()
+	defer cadencesMutex.Unlock()
+	history, ok := cadences[topic]
+	if !ok {
+		return Cadence{}, false
+	}
+	return history.cadence(now), true
+}
+
+// Count the topics that are currently silent.
+func CountSilentTopics(now time.Time) int {
+	cadencesMutex.Lock()
+	defer cadencesMutex.Unlock()
+	count := 0
+	for _, history := range cadences {
+		if history.cadence(now).Silent {
+			count++
+		}
+	}
+	return count
+}
+
+// Calculate the cadence from the history.
+func (history *cadenceHistory) cadence(now time.Time) Cadence {
+	cadence := Cadence{
+		Messages: history.messages,
+		Gap:      now.Sub(history.lastReceived).Seconds(),
+	}
+	if len(history.sizes) > 0 {
+		sum := 0
+		for _, size := range history.sizes {
+			sum += size
+		}
+		cadence.MessageSize = float64(sum) / float64(len(history.sizes))
+	}
+	if len(history.gaps) == 0 {
+		return cadence
+	}
+
+	sorted := make([]float64, len(history.gaps))
+	copy(sorted, history.gaps)
+	sort.Float64s(sorted)
+	cadence.MedianGap = percentile(sorted, 0.5)
+	cadence.P95Gap = percentile(sorted, 0.95)
+	var total float64 = 0
+	for _, gap := range sorted {
+		total += gap
+	}
+	if total > 0 {
+		cadence.Rate = float64(len(sorted)) / total * 60
+	}
+
+	if len(sorted) >= cadenceMinSamples && cadence.Gap > cadenceMinSilence && cadence.Gap > cadenceSilenceFactor*cadence.P95Gap {
+		cadence.Silent = true
+	}
+	return cadence
+}
+
+// Get the value at the given percentile (0-1) of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(p*float64(len(sorted)-1) + 0.5)
+	return sorted[index]
+}
+
+// Append the value and drop the oldest values that exceed the window size.
+func appendWindow(window []float64, value float64, size int) []float64 {
+	window = append(window, value)
+	if size > 0 && len(window) > size {
+		window = window[len(window)-size:]
+	}
+	return window
+}
+
+// Append the value and drop the oldest values that exceed the window size.
+func appendWindowInt(window []int, value int, size int) []int {
+	window = append(window, value)
+	if size > 0 && len(window) > size {
+		window = window[len(window)-size:]
+	}
+	return window
+}
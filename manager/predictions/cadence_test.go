@@ -0,0 +1,65 @@
+package predictions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCadence(t *testing.T) {
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		gaps      []int
+		size      int
+		after     time.Duration
+		rate      float64
+		medianGap float64
+		p95Gap    float64
+		silent    bool
+	}{
+		{"single message", []int{}, 100, 10 * time.Second, 0, 0, 0, false},
+		{"regular", repeatGap(20, 10), 100, 10 * time.Second, 6, 10, 10, false},
+		{"regular and silent", repeatGap(20, 10), 100, 40 * time.Second, 6, 10, 10, true},
+		{"too few gaps to be silent", repeatGap(5, 10), 100, 5 * time.Minute, 6, 10, 10, false},
+		{"slow topic is not silent below the minimum silence", repeatGap(20, 1), 100, 20 * time.Second, 60, 1, 1, false},
+		{"slow topic", repeatGap(20, 60), 100, 2 * time.Minute, 1, 60, 60, false},
+		{"slow topic and silent", repeatGap(20, 60), 100, 4 * time.Minute, 1, 60, 60, true},
+		{"irregular", append(repeatGap(19, 10), 100), 100, 1 * time.Minute, 60. / 14.5, 10, 10, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topic := "test/cadence/" + test.name
+			receivedAt := start
+			trackCadence(topic, test.size, receivedAt)
+			for _, gap := range test.gaps {
+				receivedAt = receivedAt.Add(time.Duration(gap) * time.Second)
+				trackCadence(topic, test.size, receivedAt)
+			}
+			cadence, ok := GetCadence(topic, receivedAt.Add(test.after))
+			if !ok {
+				t.Fatal("No cadence")
+			}
+			if cadence.Messages != len(test.gaps)+1 || cadence.MessageSize != float64(test.size) {
+				t.Errorf("Messages = %d, size = %f", cadence.Messages, cadence.MessageSize)
+			}
+			if diff := cadence.Rate - test.rate; diff > 0.01 || diff < -0.01 {
+				t.Errorf("Rate = %f, want %f", cadence.Rate, test.rate)
+			}
+			if cadence.MedianGap != test.medianGap || cadence.P95Gap != test.p95Gap {
+				t.Errorf("Gaps = %f, %f, want %f, %f", cadence.MedianGap, cadence.P95Gap, test.medianGap, test.p95Gap)
+			}
+			if cadence.Silent != test.silent {
+				t.Errorf("Silent = %v, want %v", cadence.Silent, test.silent)
+			}
+		})
+	}
+}
+
+// Get the given number of gaps of the given length in seconds.
+func repeatGap(count int, gap int) []int {
+	gaps := make([]int, count)
+	for i := range gaps {
+		gaps[i] = gap
+	}
+	return gaps
+}
@@ -0,0 +1,69 @@
+package predictions
+
+import (
+	"monitor/log"
+	"sync"
+)
+
+// The parts of a message that can fail to parse.
+const (
+	// The payload is no valid prediction json. The message is rejected.
+	ParseFailurePayload = "payload"
+	// The start time can't be parsed. The message is rejected.
+	ParseFailureStartTime = "start_time"
+	// The generation timestamp can't be parsed. The prediction is kept without latency measurement.
+	ParseFailureTimestamp = "timestamp"
+)
+
+// All parse failure types, in the order in which they are reported.
+var ParseFailureTypes = []string{ParseFailurePayload, ParseFailureStartTime, ParseFailureTimestamp}
+
+// A map that counts the parse failures by type for each mqtt topic.
+var parseFailures = make(map[string]map[string]int)
+
+// A lock for the parse failures map.
+var parseFailuresMutex = &sync.Mutex{}
+
+// Count a parse failure of the given type on the topic.
+// Only the first failure of each type per topic is logged, to avoid flooding the log.
+func countParseFailure(topic string, failureType string, err error) {
+	parseFailuresMutex.Lock()
+	defer parseFailuresMutex.Unlock()
+	counts, ok := parseFailures[topic]
+	if !ok {
+		counts = make(map[string]int)
+		parseFailures[topic] = counts
+	}
+	if counts[failureType] == 0 {
+		log.Warning.Printf("Could not parse %s of prediction on topic %s: %v\n", failureType, topic, err)
+	}
+	counts[failureType]++
+}
+
+// Get the number of parse failures by type on the topic.
+func ParseFailures(topic string) map[string]int {
+	parseFailuresMutex.Lock()
+	defer parseFailuresMutex.Unlock()
+	counts := make(map[string]int)
+	for _, failureType := range ParseFailureTypes {
+		counts[failureType] = parseFailures[topic][failureType]
+	}
+	return counts
+}
+
+// Get the total number of parse failures by type over all topics,
+// and the number of topics with at least one parse failure.
+func TotalParseFailures() (map[string]int, int) {
+	parseFailuresMutex.Lock()
+	defer parseFailuresMutex.Unlock()
+	totals := make(map[string]int)
+	for _, failureType := range ParseFailureTypes {
+		totals[failureType] = 0
+	}
+	for _, counts := range parseFailures {
+		for failureType, count := range counts {
+			totals[failureType] += count
+		}
+	}
+	return totals, len(parseFailures)
+}
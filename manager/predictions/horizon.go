@@ -0,0 +1,46 @@
+package predictions
+
+import (
+	"monitor/env"
+	"time"
+)
+
+// The classification of the remaining forward horizon of a prediction.
+const (
+	// The prediction covers enough seconds ahead.
+	HorizonOk = "ok"
+	// The prediction covers some seconds ahead, but fewer than the configured minimum.
+	HorizonShort = "short"
+	// The prediction ends in the past.
+	HorizonExpired = "expired"
+)
+
+// The minimum time a prediction must still cover ahead, see `PREDICTION_MIN_HORIZON`.
+var minHorizon = env.Duration("PREDICTION_MIN_HORIZON", 30*time.Second)
+
+// Get the number of seconds covered by the prediction, including truncated values.
+func (p Prediction) Length() int {
+	if p.valueLength > len(p.Value) {
+		return p.valueLength
+	}
+	return len(p.Value)
+}
+
+// Get the remaining forward horizon of the prediction in seconds at the given unix time.
+// The prediction starts at the given unix time and contains one value per second.
+func (p Prediction) Horizon(startTime int64, now int64) int64 {
+	return startTime + int64(p.Length()) - now
+}
+
+// Classify the remaining forward horizon of the prediction at the given unix time.
+// The minimum horizon can be configured with `PREDICTION_MIN_HORIZON`.
+func (p Prediction) HorizonState(startTime int64, now int64) (int64, string) {
+	horizon := p.Horizon(startTime, now)
+	if horizon <= 0 {
+		return horizon, HorizonExpired
+	}
+	if horizon < int64(minHorizon.Seconds()) {
+		return horizon, HorizonShort
+	}
+	return horizon, HorizonOk
+}
@@ -0,0 +1,33 @@
+package predictions
+
+import "testing"
+
+func TestHorizonState(t *testing.T) {
+	tests := []struct {
+		name      string
+		length    int
+		truncated int
+		startTime int64
+		now       int64
+		horizon   int64
+		state     string
+	}{
+		{"covers enough", 300, 0, 1000, 1000, 300, HorizonOk},
+		{"exactly the minimum", 300, 0, 1000, 1270, 30, HorizonOk},
+		{"short", 300, 0, 1000, 1280, 20, HorizonShort},
+		{"ends now", 300, 0, 1000, 1300, 0, HorizonExpired},
+		{"ended", 300, 0, 1000, 1400, -100, HorizonExpired},
+		{"starts in the future", 60, 0, 1100, 1000, 160, HorizonOk},
+		{"empty", 0, 0, 1000, 1000, 0, HorizonExpired},
+		{"truncated values still count", 100, 600, 1000, 1200, 400, HorizonOk},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prediction := Prediction{Value: make([]int64, test.length), valueLength: test.truncated}
+			horizon, state := prediction.HorizonState(test.startTime, test.now)
+			if horizon != test.horizon || state != test.state {
+				t.Errorf("HorizonState = %d, %s, want %d, %s", horizon, state, test.horizon, test.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package predictions
+
+// Signal-phase insights derived from the value vector of a prediction.
+type Insights struct {
+	// Whether the vector contains any value above the greentime threshold.
+	HasGreen bool
+	// The seconds from now until the next green phase starts (0 if it is green now), if there is one.
+	NextGreenStart *int64
+	// The seconds from now until the next green phase ends, if it ends within the vector.
+	NextGreenEnd *int64
+	// The share of seconds in the vector that are green.
+	GreenShare float64
+	// The detected cycle length of the signal program in seconds, if the vector is periodic.
+	CycleLength *int64
+}
+
+// The shortest cycle length that is detected.
+const minCycleLength = 20
+
+// The share of seconds that must repeat after a cycle to accept it as the cycle length.
+const minCycleAgreement = 0.95
+
+// Analyse the value vector of the prediction. The vector starts at the given unix time
+// and contains one value per second. The next green phase is computed relative to now.
+func (p Prediction) Analyse(startTime int64, now int64) Insights {
+	insights := Insights{}
+	if len(p.Value) == 0 {
+		return insights
+	}
+
+	green := make([]bool, len(p.Value))
+	numGreen := 0
+	for i, value := range p.Value {
+		green[i] = value >= p.GreentimeThreshold
+		if green[i] {
+			numGreen++
+		}
+	}
+	insights.HasGreen = numGreen > 0
+	insights.GreenShare = float64(numGreen) / float64(len(green))
+
+	// Find the next green phase from now on.
+	index := now - startTime
+	if index < 0 {
+		index = 0
+	}
+	for i := index; i < int64(len(green)); i++ {
+		if !green[i] {
+			continue
+		}
+		start := startTime + i - now
+		if start < 0 {
+			start = 0
+		}
+		insights.NextGreenStart = &start
+		for j := i; j < int64(len(green)); j++ {
+			if !green[j] {
+				end := startTime + j - now
+				insights.NextGreenEnd = &end
+				break
+			}
+		}
+		break
+	}
+
+	// Detect the cycle length as the shortest shift under which the vector repeats itself.
+	// Constant vectors have no cycle, and at least two cycles must be contained in the vector.
+	if numGreen > 0 && numGreen < len(green) {
+		bestLag, bestAgreement := 0, 0.0
+		for lag := minCycleLength; lag <= len(green)/2; lag++ {
+			// Once a repetition is found, only look at the neighbouring shifts for a better match.
+			if bestLag > 0 && lag >= bestLag+minCycleLength {
+				break
+			}
+			matches := 0
+			for i := lag; i < len(green); i++ {
+				if green[i] == green[i-lag] {
+					matches++
+				}
+			}
+			agreement := float64(matches) / float64(len(green)-lag)
+			if agreement >= minCycleAgreement && agreement > bestAgreement {
+				bestLag, bestAgreement = lag, agreement
+			}
+		}
+		if bestLag > 0 {
+			cycleLength := int64(bestLag)
+			insights.CycleLength = &cycleLength
+		}
+	}
+
+	return insights
+}
@@ -0,0 +1,80 @@
+package predictions
+
+import "testing"
+
+// Build a value vector of the given length with a fixed-time program: green for `green` seconds
+// of each cycle, starting at `offset` seconds into the cycle.
+func programVector(length int, cycle int, green int, offset int) []int64 {
+	values := make([]int64, length)
+	for i := range values {
+		if (i+cycle-offset)%cycle < green {
+			values[i] = 100
+		}
+	}
+	return values
+}
+
+// Get the value of an optional integer for test messages, or -1 if it is not set.
+func orMinusOne(value *int64) int64 {
+	if value == nil {
+		return -1
+	}
+	return *value
+}
+
+func TestAnalyse(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     []int64
+		startTime  int64
+		now        int64
+		hasGreen   bool
+		greenStart int64
+		greenEnd   int64
+		greenShare float64
+		cycle      int64
+	}{
+		{"empty", []int64{}, 0, 0, false, -1, -1, 0, -1},
+		{"all red", make([]int64, 120), 0, 0, false, -1, -1, 0, -1},
+		{"all green", programVector(120, 60, 60, 0), 0, 0, true, 0, -1, 1, -1},
+		{"green now", programVector(300, 60, 20, 0), 0, 0, true, 0, 20, 1. / 3, 60},
+		{"green later", programVector(300, 90, 30, 40), 0, 0, true, 40, 70, 0.3, 90},
+		{"evaluated later", programVector(300, 60, 20, 0), 0, 30, true, 30, 50, 1. / 3, 60},
+		{"started before now and green", programVector(300, 60, 20, 0), 100, 110, true, 0, 10, 1. / 3, 60},
+		{"started after now", programVector(300, 60, 20, 10), 100, 90, true, 20, 40, 1. / 3, 60},
+		{"single cycle is not detected", programVector(100, 70, 20, 0), 0, 0, true, 0, 20, 0.4, -1},
+		{"short cycle is detected as a multiple", programVector(120, 10, 5, 0), 0, 0, true, 0, 5, 0.5, 20},
+		{"green ends after the vector", programVector(50, 100, 20, 30), 0, 0, true, 30, -1, 0.4, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prediction := Prediction{GreentimeThreshold: 50, Value: test.values}
+			insights := prediction.Analyse(test.startTime, test.now)
+			if insights.HasGreen != test.hasGreen {
+				t.Errorf("HasGreen = %v, want %v", insights.HasGreen, test.hasGreen)
+			}
+			if got := orMinusOne(insights.NextGreenStart); got != test.greenStart {
+				t.Errorf("NextGreenStart = %d, want %d", got, test.greenStart)
+			}
+			if got := orMinusOne(insights.NextGreenEnd); got != test.greenEnd {
+				t.Errorf("NextGreenEnd = %d, want %d", got, test.greenEnd)
+			}
+			if diff := insights.GreenShare - test.greenShare; diff > 0.01 || diff < -0.01 {
+				t.Errorf("GreenShare = %f, want %f", insights.GreenShare, test.greenShare)
+			}
+			if got := orMinusOne(insights.CycleLength); got != test.cycle {
+				t.Errorf("CycleLength = %d, want %d", got, test.cycle)
+			}
+		})
+	}
+}
+
+// A vector with a few deviating seconds, e.g. an extended green phase, still has a cycle.
+func TestAnalyseNoisyCycle(t *testing.T) {
+	values := programVector(600, 80, 25, 0)
+	values[100], values[101], values[400] = 100, 100, 0
+	insights := Prediction{GreentimeThreshold: 50, Value: values}.Analyse(0, 0)
+	if got := orMinusOne(insights.CycleLength); got != 80 {
+		t.Errorf("CycleLength = %d, want 80", got)
+	}
+}
@@ -0,0 +1,154 @@
+package predictions
+
+import (
+	"monitor/env"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The times of the last message received on a topic.
+type Timing struct {
+	// The time at which the message was received.
+	ReceivedAt time.Time
+	// The time at which the prediction was generated, if it could be parsed.
+	Timestamp *time.Time
+	// The time at which the prediction starts, if it could be parsed.
+	StartTime *time.Time
+	// Whether the timestamp or start time lies in the future.
+	InFuture bool
+}
+
+// A distribution of values in seconds.
+type Distribution struct {
+	// The number of values.
+	Count int `json:"count"`
+	// The smallest value.
+	Min float64 `json:"min"`
+	// The median value.
+	Median float64 `json:"median"`
+	// The 95th percentile value.
+	P95 float64 `json:"p95"`
+	// The largest value.
+	Max float64 `json:"max"`
+}
+
+// The number of values kept for the overall distributions.
+const overallWindowSize = 1000
+
+// A map that contains the times of the last message for each mqtt topic.
+var timings = make(map[string]Timing)
+
+// A map that contains the recent generation-to-receive latencies for each mqtt topic.
+var latencies = make(map[string][]float64)
+
+// A map that contains the recent clock skews (start time minus receive time) for each mqtt topic.
+var skews = make(map[string][]float64)
+
+// The recent latencies of all topics.
+var overallLatencies = make([]float64, 0)
+
+// The recent clock skews of all topics.
+var overallSkews = make([]float64, 0)
+
+// A map that counts the predictions with timestamps in the future for each mqtt topic.
+var futureCounts = make(map[string]int)
+
+// A lock for the latency maps.
+var latencyMutex = &sync.Mutex{}
+
+// The number of latencies and skews that are kept per topic.
+var latencyWindowSize = env.Int("LATENCY_WINDOW", 50)
+
+// How far a timestamp may lie after the receive time before it is considered in the future.
+var latencyFutureTolerance = env.Duration("LATENCY_FUTURE_TOLERANCE", 2*time.Second)
+
+// Record the receive time, timestamp and start time of a prediction.
+// The latency is the time between generation and receive,
+// the skew is the offset of the start time from the receive time.
+// A timestamp more than `LATENCY_FUTURE_TOLERANCE` after the receive time is considered in the future.
+func trackLatency(topic string, receivedAt time.Time, timestamp *time.Time, startTime *time.Time) {
+	timing := Timing{ReceivedAt: receivedAt, Timestamp: timestamp, StartTime: startTime}
+
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+	if timestamp != nil {
+		latency := receivedAt.Sub(*timestamp).Seconds()
+		latencies[topic] = appendWindow(latencies[topic], latency, latencyWindowSize)
+		overallLatencies = appendWindow(overallLatencies, latency, overallWindowSize)
+		if timestamp.Sub(receivedAt) > latencyFutureTolerance {
+			timing.InFuture = true
+		}
+	}
+	if startTime != nil {
+		skew := startTime.Sub(receivedAt).Seconds()
+		skews[topic] = appendWindow(skews[topic], skew, latencyWindowSize)
+		overallSkews = appendWindow(overallSkews, skew, overallWindowSize)
+		if startTime.Sub(receivedAt) > latencyFutureTolerance {
+			timing.InFuture = true
+		}
+	}
+	if timing.InFuture {
+		futureCounts[topic]++
+	}
+	timings[topic] = timing
+}
+
+// Get the times of the last message received on the topic.
+func GetTiming(topic string) (Timing, bool) {
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+	timing, ok := timings[topic]
+	return timing, ok
+}
+
+// Get the latency and skew distributions of the topic.
+func TopicLatency(topic string) (Distribution, Distribution) {
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+	return distribution(latencies[topic]), distribution(skews[topic])
+}
+
+// Get the latency and skew distributions of all topics.
+func OverallLatency() (Distribution, Distribution) {
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+	return distribution(overallLatencies), distribution(overallSkews)
+}
+
+// Get how often the topic sent predictions with timestamps in the future.
+func FutureCount(topic string) int {
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+	return futureCounts[topic]
+}
+
+// Count the topics whose last prediction has timestamps in the future.
+func CountFuturePredictions() int {
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+	count := 0
+	for _, timing := range timings {
+		if timing.InFuture {
+			count++
+		}
+	}
+	return count
+}
+
+// Calculate the distribution of the values.
+func distribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	return Distribution{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Median: percentile(sorted, 0.5),
+		P95:    percentile(sorted, 0.95),
+		Max:    sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,76 @@
+package predictions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDistribution(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   Distribution
+	}{
+		{"empty", []float64{}, Distribution{}},
+		{"single", []float64{2}, Distribution{Count: 1, Min: 2, Median: 2, P95: 2, Max: 2}},
+		{"unsorted", []float64{5, 1, 3, 2, 4}, Distribution{Count: 5, Min: 1, Median: 3, P95: 5, Max: 5}},
+		{"negative skews", []float64{-2, 0, -1}, Distribution{Count: 3, Min: -2, Median: -1, P95: 0, Max: 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := distribution(test.values); got != test.want {
+				t.Errorf("distribution = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrackLatency(t *testing.T) {
+	received := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) *time.Time {
+		t := received.Add(offset)
+		return &t
+	}
+	tests := []struct {
+		name      string
+		timestamp *time.Time
+		startTime *time.Time
+		latency   float64
+		skew      float64
+		inFuture  bool
+	}{
+		{"regular", at(-3 * time.Second), at(-time.Second), 3, -1, false},
+		{"start time ahead within the tolerance", at(-time.Second), at(2 * time.Second), 1, 2, false},
+		{"timestamp in the future", at(5 * time.Second), at(0), -5, 0, true},
+		{"start time in the future", at(0), at(10 * time.Second), 0, 10, true},
+	}
+	defer func(size int, tolerance time.Duration) {
+		latencyWindowSize, latencyFutureTolerance = size, tolerance
+	}(latencyWindowSize, latencyFutureTolerance)
+	latencyWindowSize, latencyFutureTolerance = 3, 2*time.Second
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topic := "test/latency/" + test.name
+			trackLatency(topic, received, test.timestamp, test.startTime)
+			timing, ok := GetTiming(topic)
+			if !ok || timing.InFuture != test.inFuture {
+				t.Errorf("InFuture = %v, want %v", timing.InFuture, test.inFuture)
+			}
+			latency, skew := TopicLatency(topic)
+			if latency.Max != test.latency || skew.Max != test.skew {
+				t.Errorf("Latency = %f, skew = %f, want %f and %f", latency.Max, skew.Max, test.latency, test.skew)
+			}
+			if want := map[bool]int{true: 1, false: 0}[test.inFuture]; FutureCount(topic) != want {
+				t.Errorf("FutureCount = %d, want %d", FutureCount(topic), want)
+			}
+		})
+	}
+
+	// Only the last `LATENCY_WINDOW` values are kept.
+	for i := 1; i <= 5; i++ {
+		trackLatency("test/latency/window", received, at(-time.Duration(i)*time.Second), nil)
+	}
+	if latency, _ := TopicLatency("test/latency/window"); latency.Count != 3 || latency.Min != 3 || latency.Max != 5 {
+		t.Errorf("Latency window = %+v, want the last 3 values", latency)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"monitor/clock"
+	"monitor/env"
 	"monitor/log"
+	"monitor/recording"
 	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -15,34 +17,25 @@ import (
 
 // The prediction model.
 type Prediction struct {
-	GreentimeThreshold int64   `json:"greentimeThreshold"`
-	PredictionQuality  float64 `json:"predictionQuality"`
-	SignalGroupId      string  `json:"signalGroupId"`
-	StartTime          string  `json:"startTime"`
-	Value              []int64 `json:"value"`
-	Timestamp          string  `json:"timestamp"`
+	GreentimeThreshold int64     `json:"greentimeThreshold"`
+	PredictionQuality  float64   `json:"predictionQuality"`
+	SignalGroupId      string    `json:"signalGroupId"`
+	StartTime          Timestamp `json:"startTime"`
+	Value              []int64   `json:"value"`
+	Timestamp          Timestamp `json:"timestamp"`
+
+	// The length of the value vector before it was truncated, if it was.
+	valueLength int
 }
 
-// Parse the timestamp to unix time.
-func (p *Prediction) parseTimestamp() (int64, error) {
-	timestamp := strings.ReplaceAll(p.StartTime, "[UTC]", "")
-	parsed, err := time.Parse(time.RFC3339, timestamp)
-	if err != nil {
-		// try to insert seconds
-		parts := strings.Split(timestamp, "Z")
-		if len(parts) != 2 {
-			log.Warning.Println("Could not parse timestamp:", err)
-			return 0, err
-		}
-		timestamp = fmt.Sprintf("%s:00Z%s", parts[0], parts[1])
-		parsed, err = time.Parse(time.RFC3339, timestamp)
-		if err != nil {
-			log.Warning.Println("Could not parse timestamp:", err)
-			return 0, err
-		}
-	}
-	unix := parsed.Unix()
-	return unix, nil
+// Parse the start time of the prediction.
+func (p *Prediction) parseStartTime() (time.Time, error) {
+	return ParseTimestamp(string(p.StartTime))
+}
+
+// Parse the time at which the prediction was generated.
+func (p *Prediction) parseTimestamp() (time.Time, error) {
+	return ParseTimestamp(string(p.Timestamp))
 }
 
 // A mutex that protects writes to the current map.
@@ -54,31 +47,76 @@ var Current = make(map[string]Prediction)
 // A mutex that protects writes to the timestamps map.
 var TimestampsMutex = &sync.Mutex{}
 
-// A map that contains timestamps of the last prediction for each mqtt topic.
+// A map that contains the unix start time of the last prediction for each mqtt topic.
 var Timestamps = make(map[string]int64)
 
+// A map that contains the time of the first prediction since startup for each mqtt topic.
+var FirstReceived = make(map[string]time.Time)
+
 // An integer that represents the number of messages received.
 var received = 0
 
+// Whether all topics are subscribed with a wildcard, instead of only the topics of known things.
+var wildcard = false
+
 // A callback that is executed when new messages arrive on the mqtt topic.
 func onMessageReceived(client mqtt.Client, msg mqtt.Message) {
+	receivedAt := clock.Now()
+	recording.Record(msg.Topic(), receivedAt, msg.Payload())
+	// In wildcard mode, messages on topics of unknown things are only counted.
+	if wildcard && !isKnownTopic(msg.Topic()) {
+		countUnknownTopic(msg.Topic())
+		return
+	}
+	Ingest(msg.Topic(), msg.Payload(), receivedAt)
+}
+
+// Ingest a raw prediction message that was received on the given topic.
+// This is the common path for live messages and replayed recordings.
+func Ingest(topic string, payload []byte, receivedAt time.Time) {
+	// Track the publishing cadence of the topic, regardless of whether the message is valid.
+	trackCadence(topic, len(payload), receivedAt)
 	// Parse the prediction from the message.
 	var prediction Prediction
-	if err := json.Unmarshal(msg.Payload(), &prediction); err != nil {
-		log.Warning.Println("Could not parse prediction:", err)
+	if err := json.Unmarshal(payload, &prediction); err != nil {
+		countParseFailure(topic, ParseFailurePayload, err)
+		return
+	}
+	// Parse the start time of the prediction. Without it, the prediction can't be evaluated,
+	// so the message is rejected as a whole instead of storing a prediction without timestamp.
+	parsedStartTime, err := prediction.parseStartTime()
+	if err != nil {
+		countParseFailure(topic, ParseFailureStartTime, err)
 		return
 	}
-	// Update the prediction for the connection.
+	startTime := parsedStartTime.Unix()
+	// The generation time is only used for latency measurements, so the prediction is kept without it.
+	var timestamp *time.Time
+	if parsed, err := prediction.parseTimestamp(); err == nil {
+		timestamp = &parsed
+	} else {
+		countParseFailure(topic, ParseFailureTimestamp, err)
+	}
+	// Limit the memory that is retained for the prediction.
+	prediction.truncate()
+	// Update the prediction and its unix start time for the connection together.
+	// The time of the first prediction is protected by the same locks.
 	CurrentMutex.Lock()
-	Current[msg.Topic()] = prediction
-	CurrentMutex.Unlock()
-	// Update the timestamp for the connection with the current unix timestamp.
-	unixtime, err := prediction.parseTimestamp()
-	if err == nil {
-		TimestampsMutex.Lock()
-		Timestamps[msg.Topic()] = unixtime
-		TimestampsMutex.Unlock()
+	TimestampsMutex.Lock()
+	previous, previousOk := Current[topic]
+	previousStartTime, previousStartTimeOk := Timestamps[topic]
+	Current[topic] = prediction
+	Timestamps[topic] = startTime
+	if _, ok := FirstReceived[topic]; !ok {
+		FirstReceived[topic] = receivedAt
 	}
+	TimestampsMutex.Unlock()
+	CurrentMutex.Unlock()
+	// Record the generation time separately from the start time and the receive time.
+	trackLatency(topic, receivedAt, timestamp, &parsedStartTime)
+	// A repeated vector is expected if the program is periodic and the start time advanced by whole cycles.
+	shifted := previousOk && previousStartTimeOk && isShifted(previous, previousStartTime, prediction, startTime)
+	detectAnomalies(topic, prediction, &startTime, shifted)
 	// Increment the number of received messages.
 	received++
 }
@@ -93,7 +131,7 @@ func Print() {
 
 // Listen for new predictions via mqtt.
 func Listen() {
-	// Start a mqtt client that listens to all messages on the prediction
+	// Start a mqtt client that listens to the messages of the known things on the prediction
 	// service mqtt. The mqtt broker is secured with a username and password.
 	// The credentials and the mqtt url are loaded from environment variables.
 	mqttUrl := os.Getenv("MQTT_URL")
@@ -120,6 +158,7 @@ func Listen() {
 	})
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
 		log.Warning.Println("Connection to prediction mqtt broker lost:", err)
+		recording.Close()
 		panic("Intentionally crashing. The docker setup should handle a restart such that a new connection to the mqtt broker can be established.")
 	})
 	randSource := rand.NewSource(time.Now().UnixNano())
@@ -132,13 +171,23 @@ func Listen() {
 		log.Warning.Println("Received unexpected message on topic:", msg.Topic())
 	})
 
+	// Record all received messages if configured.
+	recording.Init()
+
 	client := mqtt.NewClient(opts)
 	if conn := client.Connect(); conn.Wait() && conn.Error() != nil {
 		panic(conn.Error())
 	}
 
-	if sub := client.Subscribe("#", 1, onMessageReceived); sub.Wait() && sub.Error() != nil {
-		panic(sub.Error())
+	// Subscribe only to the topics of known things, unless the wildcard mode is enabled.
+	// In wildcard mode, traffic on topics of unknown things is counted.
+	wildcard = env.Bool("MQTT_WILDCARD", false)
+	if wildcard {
+		if sub := client.Subscribe("#", 1, onMessageReceived); sub.Wait() && sub.Error() != nil {
+			panic(sub.Error())
+		}
+	} else {
+		go manageSubscriptions(client)
 	}
 
 	// Print the number of received messages periodically.
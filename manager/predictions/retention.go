@@ -0,0 +1,192 @@
+package predictions
+
+import (
+	"fmt"
+	"monitor/clock"
+	"monitor/env"
+	"monitor/log"
+	"monitor/sync"
+	"runtime"
+	gosync "sync"
+	"time"
+)
+
+// A list of handlers that are called with each evicted topic,
+// such that other packages can drop their state of the topic as well.
+var evictionHandlers = make([]func(topic string), 0)
+
+// A lock for the eviction handlers.
+var evictionHandlersMutex = &gosync.Mutex{}
+
+// Register a handler that is called with each evicted topic.
+func OnEvict(handler func(topic string)) {
+	evictionHandlersMutex.Lock()
+	defer evictionHandlersMutex.Unlock()
+	evictionHandlers = append(evictionHandlers, handler)
+}
+
+// The maximum number of stored values of a prediction, or 0 to store all.
+var maxValueLength = env.Int("PREDICTION_MAX_VALUE_LENGTH", 3600)
+
+// Truncate the value vector to `PREDICTION_MAX_VALUE_LENGTH` values, keeping the original length.
+func (p *Prediction) truncate() {
+	maxLength := maxValueLength
+	if maxLength <= 0 || len(p.Value) <= maxLength {
+		return
+	}
+	p.valueLength = len(p.Value)
+	truncated := make([]int64, maxLength)
+	copy(truncated, p.Value)
+	p.Value = truncated
+}
+
+// The time after the last message after which the state of a topic is evicted.
+var predictionTTL = env.Duration("PREDICTION_TTL", 24*time.Hour)
+
+// The time after the last message after which the state of a topic without known thing is evicted.
+var predictionUnknownTTL = env.Duration("PREDICTION_UNKNOWN_TTL", 10*time.Minute)
+
+// Periodically evict the state of topics that received no message for `PREDICTION_TTL`,
+// or that don't belong to a known thing and received no message for `PREDICTION_UNKNOWN_TTL`.
+func Evict() {
+	for {
+		clock.Sleep(1 * time.Minute)
+		now := clock.Now()
+
+		// Fetch the known topics. Before the first sync, no topic is evicted as unknown.
+		sync.ThingsMutex.Lock()
+		known := make(map[string]bool, len(sync.Things))
+		for topic := range sync.Things {
+			known[topic] = true
+		}
+		synced := len(sync.Things) > 0
+		sync.ThingsMutex.Unlock()
+
+		// Find the expired topics by the time of their last message.
+		expired := make([]string, 0)
+		cadencesMutex.Lock()
+		for topic, history := range cadences {
+			age := now.Sub(history.lastReceived)
+			if age > predictionTTL || (synced && !known[topic] && age > predictionUnknownTTL) {
+				expired = append(expired, topic)
+			}
+		}
+		cadencesMutex.Unlock()
+
+		for _, topic := range expired {
+			forget(topic, known[topic])
+		}
+		if len(expired) > 0 {
+			log.Info.Printf("Evicted the state of %d expired topics.\n", len(expired))
+		}
+	}
+}
+
+// Drop all state of the topic. For known things, the time of the first
+// prediction is kept, such that the thing is not reported as never received.
+func forget(topic string, known bool) {
+	CurrentMutex.Lock()
+	TimestampsMutex.Lock()
+	delete(Current, topic)
+	delete(Timestamps, topic)
+	if !known {
+		delete(FirstReceived, topic)
+	}
+	TimestampsMutex.Unlock()
+	CurrentMutex.Unlock()
+
+	cadencesMutex.Lock()
+	delete(cadences, topic)
+	cadencesMutex.Unlock()
+
+	anomaliesMutex.Lock()
+	delete(anomalyWindows, topic)
+	delete(anomalies, topic)
+	anomaliesMutex.Unlock()
+
+	latencyMutex.Lock()
+	delete(timings, topic)
+	delete(latencies, topic)
+	delete(skews, topic)
+	delete(futureCounts, topic)
+	latencyMutex.Unlock()
+
+	parseFailuresMutex.Lock()
+	delete(parseFailures, topic)
+	parseFailuresMutex.Unlock()
+
+	// Call the handlers without holding the lock, such that they can register further handlers.
+	evictionHandlersMutex.Lock()
+	handlers := append(make([]func(topic string), 0, len(evictionHandlers)), evictionHandlers...)
+	evictionHandlersMutex.Unlock()
+	for _, handler := range handlers {
+		handler(topic)
+	}
+}
+
+// Create Prometheus metrics with the number of entries and the estimated size of the state maps,
+// as well as the heap size of the service.
+func MemoryMetrics() []string {
+	// The estimated size of a map entry without its variable-length data, in bytes.
+	const entryOverhead = 64
+
+	CurrentMutex.Lock()
+	TimestampsMutex.Lock()
+	var currentBytes = 0
+	for topic, prediction := range Current {
+		currentBytes += entryOverhead + len(topic) + 8*len(prediction.Value) +
+			len(prediction.SignalGroupId) + len(prediction.StartTime) + len(prediction.Timestamp)
+	}
+	numCurrent := len(Current)
+	numTimestamps := len(Timestamps)
+	numFirstReceived := len(FirstReceived)
+	TimestampsMutex.Unlock()
+	CurrentMutex.Unlock()
+
+	cadencesMutex.Lock()
+	numCadences := len(cadences)
+	cadenceBytes := 0
+	for topic, history := range cadences {
+		cadenceBytes += entryOverhead + len(topic) + 8*len(history.gaps) + 8*len(history.sizes)
+	}
+	cadencesMutex.Unlock()
+
+	anomaliesMutex.Lock()
+	numAnomalies := len(anomalyWindows)
+	anomalyBytes := 0
+	for topic, window := range anomalyWindows {
+		anomalyBytes += entryOverhead + len(topic) + 40*len(window)
+	}
+	anomaliesMutex.Unlock()
+
+	latencyMutex.Lock()
+	numTimings := len(timings)
+	latencyBytes := 0
+	for topic := range timings {
+		latencyBytes += entryOverhead + len(topic) + 8*len(latencies[topic]) + 8*len(skews[topic])
+	}
+	latencyMutex.Unlock()
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	entries := []struct {
+		name    string
+		entries int
+		bytes   int
+	}{
+		{"current", numCurrent, currentBytes},
+		{"timestamps", numTimestamps, numTimestamps * entryOverhead},
+		{"first_received", numFirstReceived, numFirstReceived * entryOverhead},
+		{"cadences", numCadences, cadenceBytes},
+		{"anomalies", numAnomalies, anomalyBytes},
+		{"latencies", numTimings, latencyBytes},
+	}
+	metrics := make([]string, 0, 2*len(entries)+1)
+	for _, entry := range entries {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_state_entries{map=\"%s\"} %d", entry.name, entry.entries))
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_state_bytes{map=\"%s\"} %d", entry.name, entry.bytes))
+	}
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_heap_bytes %d", memStats.HeapAlloc))
+	return metrics
+}
@@ -0,0 +1,66 @@
+package predictions
+
+import (
+	gosync "sync"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxLength   int
+		length      int
+		stored      int
+		valueLength int
+	}{
+		{"shorter than the maximum", 10, 5, 5, 0},
+		{"maximum", 10, 10, 10, 0},
+		{"longer than the maximum", 10, 25, 10, 25},
+		{"unlimited", 0, 25, 25, 0},
+	}
+	defer func(previous int) { maxValueLength = previous }(maxValueLength)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maxValueLength = test.maxLength
+			prediction := Prediction{Value: make([]int64, test.length)}
+			prediction.truncate()
+			if len(prediction.Value) != test.stored || prediction.valueLength != test.valueLength {
+				t.Errorf("truncate = %d values with length %d, want %d with length %d",
+					len(prediction.Value), prediction.valueLength, test.stored, test.valueLength)
+			}
+		})
+	}
+}
+
+// Handlers may be registered while topics are evicted. Run with `-race` to detect unguarded access.
+func TestOnEvictConcurrently(t *testing.T) {
+	var mutex gosync.Mutex
+	evicted := make(map[string]int)
+	OnEvict(func(topic string) {
+		mutex.Lock()
+		evicted[topic]++
+		mutex.Unlock()
+	})
+
+	var wg gosync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			OnEvict(func(topic string) {})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			forget("test/retention/concurrent", false)
+		}
+	}()
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if evicted["test/retention/concurrent"] != 100 {
+		t.Errorf("Handler was called %d times, want 100", evicted["test/retention/concurrent"])
+	}
+}
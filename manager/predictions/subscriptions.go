@@ -0,0 +1,163 @@
+package predictions
+
+import (
+	"monitor/env"
+	"monitor/log"
+	"monitor/sync"
+	"sort"
+	gosync "sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// The topics that are currently subscribed.
+var subscribed = make(map[string]bool)
+
+// A lock for the subscribed map.
+var subscribedMutex = &gosync.Mutex{}
+
+// A map that counts the messages on each topic that doesn't belong to a known thing.
+var unknownTopics = make(map[string]int)
+
+// The number of messages on topics that don't belong to a known thing.
+var unknownMessages = 0
+
+// A lock for the unknown topics map and counter.
+var unknownMutex = &gosync.Mutex{}
+
+// The maximum number of distinct unknown topics that are tracked.
+var maxUnknownTopics = env.Int("MQTT_MAX_UNKNOWN_TOPICS", 10000)
+
+// Keep the subscriptions in sync with the topics of the known things.
+// New topics are subscribed and vanished topics are unsubscribed in batches
+// of `MQTT_SUBSCRIBE_BATCH` topics, to respect the limits of the broker.
+func manageSubscriptions(client mqtt.Client) {
+	batchSize := env.Int("MQTT_SUBSCRIBE_BATCH", 100)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	lastVersion := -1
+	for {
+		// Wait until the things changed.
+		version := sync.Version()
+		if version == lastVersion {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		lastVersion = version
+
+		// Find the topics that need to be (un)subscribed.
+		sync.ThingsMutex.Lock()
+		desired := make(map[string]bool, len(sync.Things))
+		for topic := range sync.Things {
+			desired[topic] = true
+		}
+		sync.ThingsMutex.Unlock()
+
+		subscribedMutex.Lock()
+		toSubscribe := make([]string, 0)
+		for topic := range desired {
+			if !subscribed[topic] {
+				toSubscribe = append(toSubscribe, topic)
+			}
+		}
+		toUnsubscribe := make([]string, 0)
+		for topic := range subscribed {
+			if !desired[topic] {
+				toUnsubscribe = append(toUnsubscribe, topic)
+			}
+		}
+		subscribedMutex.Unlock()
+		sort.Strings(toSubscribe)
+		sort.Strings(toUnsubscribe)
+
+		for start := 0; start < len(toSubscribe); start += batchSize {
+			batch := toSubscribe[start:minInt(start+batchSize, len(toSubscribe))]
+			filters := make(map[string]byte, len(batch))
+			for _, topic := range batch {
+				filters[topic] = 1
+			}
+			if sub := client.SubscribeMultiple(filters, onMessageReceived); sub.Wait() && sub.Error() != nil {
+				log.Error.Println("Could not subscribe to prediction topics:", sub.Error())
+				lastVersion = -1 // Retry in the next round.
+				break
+			}
+			subscribedMutex.Lock()
+			for _, topic := range batch {
+				subscribed[topic] = true
+			}
+			subscribedMutex.Unlock()
+		}
+
+		for start := 0; start < len(toUnsubscribe); start += batchSize {
+			batch := toUnsubscribe[start:minInt(start+batchSize, len(toUnsubscribe))]
+			if unsub := client.Unsubscribe(batch...); unsub.Wait() && unsub.Error() != nil {
+				log.Error.Println("Could not unsubscribe from prediction topics:", unsub.Error())
+				lastVersion = -1 // Retry in the next round.
+				break
+			}
+			subscribedMutex.Lock()
+			for _, topic := range batch {
+				delete(subscribed, topic)
+			}
+			subscribedMutex.Unlock()
+		}
+
+		if len(toSubscribe) > 0 || len(toUnsubscribe) > 0 {
+			log.Info.Printf("Subscribed to %d and unsubscribed from %d prediction topics.\n", len(toSubscribe), len(toUnsubscribe))
+		}
+	}
+}
+
+// Check whether the topic belongs to a known thing.
+func isKnownTopic(topic string) bool {
+	sync.ThingsMutex.Lock()
+	defer sync.ThingsMutex.Unlock()
+	_, ok := sync.Things[topic]
+	return ok
+}
+
+// Count a message on a topic that doesn't belong to a known thing.
+// At most `MQTT_MAX_UNKNOWN_TOPICS` distinct topics are tracked, further topics are only counted in total.
+func countUnknownTopic(topic string) {
+	unknownMutex.Lock()
+	defer unknownMutex.Unlock()
+	unknownMessages++
+	if _, ok := unknownTopics[topic]; ok || len(unknownTopics) < maxUnknownTopics {
+		unknownTopics[topic]++
+	}
+}
+
+// Get the number of messages on each tracked topic that doesn't belong to a known thing.
+func UnknownTopics() map[string]int {
+	unknownMutex.Lock()
+	defer unknownMutex.Unlock()
+	topics := make(map[string]int, len(unknownTopics))
+	for topic, count := range unknownTopics {
+		topics[topic] = count
+	}
+	return topics
+}
+
+// Get the total number of messages on topics that don't belong to a known thing.
+func UnknownMessages() int {
+	unknownMutex.Lock()
+	defer unknownMutex.Unlock()
+	return unknownMessages
+}
+
+// Get the number of currently subscribed topics.
+func NumSubscriptions() int {
+	subscribedMutex.Lock()
+	defer subscribedMutex.Unlock()
+	return len(subscribed)
+}
+
+// Get the smaller of two integers.
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
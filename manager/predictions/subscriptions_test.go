@@ -0,0 +1,43 @@
+package predictions
+
+import "testing"
+
+func TestCountUnknownTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxTopic int
+		topics   []string
+		tracked  map[string]int
+		messages int
+	}{
+		{"below the limit", 3, []string{"a", "b", "a"}, map[string]int{"a": 2, "b": 1}, 3},
+		{"at the limit", 2, []string{"a", "b", "c", "a", "c"}, map[string]int{"a": 2, "b": 1}, 5},
+		{"no topics tracked", 0, []string{"a", "b"}, map[string]int{}, 2},
+	}
+	defer func(previous int) { maxUnknownTopics = previous }(maxUnknownTopics)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unknownMutex.Lock()
+			unknownTopics = make(map[string]int)
+			unknownMessages = 0
+			unknownMutex.Unlock()
+			maxUnknownTopics = test.maxTopic
+
+			for _, topic := range test.topics {
+				countUnknownTopic(topic)
+			}
+			tracked := UnknownTopics()
+			if len(tracked) != len(test.tracked) {
+				t.Errorf("UnknownTopics = %v, want %v", tracked, test.tracked)
+			}
+			for topic, count := range test.tracked {
+				if tracked[topic] != count {
+					t.Errorf("UnknownTopics[%s] = %d, want %d", topic, tracked[topic], count)
+				}
+			}
+			if got := UnknownMessages(); got != test.messages {
+				t.Errorf("UnknownMessages = %d, want %d", got, test.messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package predictions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Zone ids of Java ZonedDateTime timestamps must resolve without system tzdata.
+)
+
+// The timestamp layouts that are tried in order.
+// Fractional seconds are accepted after the seconds field even if the layout doesn't contain them.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",        // Java omits zero seconds, e.g. `2023-03-01T12:00Z`.
+	"2006-01-02T15:04:05Z0700",      // Offsets without colon, e.g. `+0100`.
+	"2006-01-02T15:04Z0700",         // Without seconds and colon.
+	"2006-01-02 15:04:05Z07:00",     // Space instead of `T`.
+	"2006-01-02T15:04:05Z07",        // Offsets with hours only, e.g. `+01`.
+	"2006-01-02T15:04:05.999999999", // Without offset, in the zone of the suffix or UTC.
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// A timestamp as it is sent by a prediction service, either a json string or a json number.
+// Numbers like epoch milliseconds are kept as their literal text and parsed by `ParseTimestamp`.
+type Timestamp string
+
+// Accept both quoted and unquoted timestamps.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*t = Timestamp(value)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("timestamp must be a string or a number: %s", data)
+	}
+	*t = Timestamp(number)
+	return nil
+}
+
+// Epoch timestamps above this value are interpreted as milliseconds.
+const epochMillisThreshold = 100000000000
+
+// Epoch milliseconds above this value (the end of the year 9999) are rejected.
+const maxEpochMillis = 253402300799999
+
+// Check whether the value looks like an epoch timestamp, i.e. only digits with an optional fraction.
+// Signs, exponents and words like `NaN` or `Inf` that `strconv.ParseFloat` accepts are excluded.
+func isEpoch(value string) bool {
+	digits, dots := 0, 0
+	for _, c := range value {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.':
+			dots++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && dots <= 1
+}
+
+// Parse a timestamp in one of the formats that are used by prediction services:
+// ISO 8601 with or without seconds, fractional seconds and offsets, Java `ZonedDateTime`
+// with a zone id suffix like `[UTC]` or `[Europe/Berlin]`, and epoch seconds or milliseconds.
+// Timestamps without offset are interpreted in the zone of the suffix, or in UTC.
+func ParseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+
+	// Epoch seconds or milliseconds, optionally with fractions.
+	if isEpoch(value) {
+		epoch, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(epoch) || math.IsInf(epoch, 0) || epoch <= 0 || epoch > maxEpochMillis {
+			return time.Time{}, fmt.Errorf("invalid epoch timestamp: %q", value)
+		}
+		if epoch > epochMillisThreshold {
+			return time.UnixMilli(int64(epoch)).UTC(), nil
+		}
+		seconds := int64(epoch)
+		return time.Unix(seconds, int64((epoch-float64(seconds))*1e9)).UTC(), nil
+	}
+
+	// Strip the zone id suffix of Java ZonedDateTime, e.g. `[Europe/Berlin]`.
+	location := time.UTC
+	if open := strings.Index(value, "["); open >= 0 && strings.HasSuffix(value, "]") {
+		zone := value[open+1 : len(value)-1]
+		value = value[:open]
+		loaded, err := time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown zone %q in timestamp: %v", zone, err)
+		}
+		location = loaded
+	}
+
+	for _, layout := range timestampLayouts {
+		// Layouts without offset are parsed in the zone of the suffix. Otherwise the offset wins.
+		if parsed, err := time.ParseInLocation(layout, value, location); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported timestamp format: %q", value)
+}
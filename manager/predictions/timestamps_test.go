@@ -0,0 +1,163 @@
+package predictions
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day int, hour int, minute int, second int, nanos int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, nanos, time.UTC)
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		// ISO 8601 / RFC 3339.
+		{"rfc3339 utc", "2023-05-01T10:00:00Z", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"rfc3339 offset", "2023-05-01T12:00:00+02:00", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"rfc3339 negative offset", "2023-05-01T07:00:00-03:00", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"fractional seconds", "2023-05-01T10:00:00.123Z", utc(2023, 5, 1, 10, 0, 0, 123000000)},
+		{"nanoseconds", "2023-05-01T10:00:00.123456789Z", utc(2023, 5, 1, 10, 0, 0, 123456789)},
+		{"without seconds", "2023-05-01T10:00Z", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"offset without colon", "2023-05-01T12:00:00+0200", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"without seconds and colon", "2023-05-01T12:00+0200", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"space separator", "2023-05-01 12:00:00+02:00", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"offset hours only", "2023-05-01T12:00:00+02", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"without offset", "2023-05-01T10:00:00", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"without offset with fraction", "2023-05-01T10:00:00.5", utc(2023, 5, 1, 10, 0, 0, 500000000)},
+		{"without offset and seconds", "2023-05-01T10:00", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"space without offset", "2023-05-01 10:00:00", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"surrounding whitespace", "  2023-05-01T10:00:00Z\n", utc(2023, 5, 1, 10, 0, 0, 0)},
+		// Java ZonedDateTime.
+		{"zoned utc", "2023-05-01T10:00:00Z[UTC]", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"zoned without seconds", "2023-05-01T10:00Z[UTC]", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"zoned with offset", "2023-05-01T12:00:00+02:00[Europe/Berlin]", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"zoned fraction", "2023-05-01T12:00:00.250+02:00[Europe/Berlin]", utc(2023, 5, 1, 10, 0, 0, 250000000)},
+		{"zone without offset", "2023-05-01T12:00:00[Europe/Berlin]", time.Date(2023, 5, 1, 12, 0, 0, 0, berlin)},
+		{"zone without offset in winter", "2023-01-01T11:00:00[Europe/Berlin]", utc(2023, 1, 1, 10, 0, 0, 0)},
+		// Epoch seconds and milliseconds.
+		{"epoch seconds", "1682935200", utc(2023, 5, 1, 10, 0, 0, 0)},
+		{"epoch seconds with fraction", "1682935200.5", utc(2023, 5, 1, 10, 0, 0, 500000000)},
+		{"epoch milliseconds", "1682935200123", utc(2023, 5, 1, 10, 0, 0, 123000000)},
+		{"epoch milliseconds at the maximum", "253402300799999", utc(9999, 12, 31, 23, 59, 59, 999000000)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseTimestamp(test.value)
+			if err != nil {
+				t.Fatalf("ParseTimestamp(%q) failed: %v", test.value, err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("ParseTimestamp(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestampInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"NaN",
+		"nan",
+		"Inf",
+		"+Inf",
+		"-Inf",
+		"Infinity",
+		"0",
+		"0.0",
+		"-1682935200",
+		"+1682935200",
+		"1.6829352e9",
+		"0x1p30",
+		"1682935200.1.2",
+		".",
+		"253402300800000",
+		"99999999999999999999999999",
+		"2023-05-01",
+		"2023-05-01T25:00:00Z",
+		"2023-05-01T10:00:00Z[Mars/Olympus]",
+		"01.05.2023 10:00",
+		"yesterday",
+	}
+	for _, value := range tests {
+		t.Run(value, func(t *testing.T) {
+			if got, err := ParseTimestamp(value); err == nil {
+				t.Errorf("ParseTimestamp(%q) = %v, want an error", value, got)
+			}
+		})
+	}
+}
+
+func TestTimestampUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Timestamp
+	}{
+		{"string", `"2023-05-11T10:13:20Z"`, "2023-05-11T10:13:20Z"},
+		{"quoted epoch", `"1683800000000"`, "1683800000000"},
+		{"epoch milliseconds", `1683800000000`, "1683800000000"},
+		{"epoch seconds with fraction", `1683800000.5`, "1683800000.5"},
+		{"null", `null`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got Timestamp
+			if err := json.Unmarshal([]byte(test.json), &got); err != nil {
+				t.Fatalf("Unmarshal(%s) failed: %v", test.json, err)
+			}
+			if got != test.want {
+				t.Errorf("Unmarshal(%s) = %q, want %q", test.json, got, test.want)
+			}
+		})
+	}
+	for _, invalid := range []string{`true`, `{}`, `[1683800000000]`} {
+		t.Run(invalid, func(t *testing.T) {
+			var got Timestamp
+			if err := json.Unmarshal([]byte(invalid), &got); err == nil {
+				t.Errorf("Unmarshal(%s) = %q, want an error", invalid, got)
+			}
+		})
+	}
+}
+
+func TestIngestUnquotedEpoch(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+		want    time.Time
+	}{
+		{
+			"epoch milliseconds",
+			"hamburg/epoch-millis",
+			`{"signalGroupId":"1","startTime":1683800000000,"timestamp":1683800000000,"value":[0,100]}`,
+			time.Date(2023, 5, 11, 10, 13, 20, 0, time.UTC),
+		},
+		{
+			"epoch seconds",
+			"hamburg/epoch-seconds",
+			`{"signalGroupId":"1","startTime":1683800000,"timestamp":"2023-05-11T10:13:20Z","value":[0,100]}`,
+			time.Date(2023, 5, 11, 10, 13, 20, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Ingest(test.topic, []byte(test.payload), test.want)
+			TimestampsMutex.Lock()
+			got, ok := Timestamps[test.topic]
+			TimestampsMutex.Unlock()
+			if !ok || got != test.want.Unix() {
+				t.Errorf("start time = %d (stored: %v), want %d", got, ok, test.want.Unix())
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package recording
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/env"
+	"monitor/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A single recorded mqtt message.
+type Entry struct {
+	// The mqtt topic on which the message was received.
+	Topic string `json:"topic"`
+	// The time at which the message was received.
+	ReceivedAt time.Time `json:"received_at"`
+	// The raw payload of the message.
+	Payload []byte `json:"-"`
+}
+
+// The recorded form of an entry.
+type recordedEntry struct {
+	Topic      string    `json:"topic"`
+	ReceivedAt time.Time `json:"received_at"`
+	// The payload as is, if it is valid json, such that the recording stays readable.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// The base64 encoded payload, if it is not valid json.
+	PayloadBase64 []byte `json:"payload_base64,omitempty"`
+}
+
+// Record the payload as json if possible, and base64 encoded otherwise.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	recorded := recordedEntry{Topic: e.Topic, ReceivedAt: e.ReceivedAt}
+	if json.Valid(e.Payload) {
+		recorded.Payload = e.Payload
+	} else {
+		recorded.PayloadBase64 = e.Payload
+	}
+	return json.Marshal(recorded)
+}
+
+// Read an entry that was recorded with `MarshalJSON`.
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var recorded recordedEntry
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		return err
+	}
+	e.Topic = recorded.Topic
+	e.ReceivedAt = recorded.ReceivedAt
+	if recorded.Payload != nil {
+		e.Payload = recorded.Payload
+	} else {
+		e.Payload = recorded.PayloadBase64
+	}
+	return nil
+}
+
+// The prefix and suffix of all recording files.
+const (
+	filePrefix = "predictions-"
+	fileSuffix = ".ndjson.gz"
+)
+
+// A recorder that writes messages to rotating compressed ndjson files.
+type recorder struct {
+	// The directory in which the recordings are stored.
+	path string
+	// The maximum number of uncompressed bytes written to a single file.
+	maxFileSize int64
+	// The maximum time span covered by a single file.
+	rotateInterval time.Duration
+	// The maximum number of files to keep. Older files are deleted.
+	maxFiles int
+
+	// The currently opened file, if any.
+	file *os.File
+	// The gzip writer of the currently opened file.
+	writer *gzip.Writer
+	// The number of uncompressed bytes written to the current file.
+	written int64
+	// The time at which the current file was opened.
+	opened time.Time
+}
+
+// The active recorder, if recording is enabled.
+var active *recorder
+
+// A lock for the active recorder.
+var recorderMutex = &sync.Mutex{}
+
+// Start recording all received messages if `RECORD_PATH` is set.
+func Init() {
+	path := os.Getenv("RECORD_PATH")
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		log.Error.Println("Could not create recording directory, recording is disabled:", err)
+		return
+	}
+	recorderMutex.Lock()
+	active = &recorder{
+		path:           path,
+		maxFileSize:    int64(env.Int("RECORD_MAX_FILE_SIZE_MB", 100)) * 1024 * 1024,
+		rotateInterval: env.Duration("RECORD_ROTATE_INTERVAL", 1*time.Hour),
+		maxFiles:       env.Int("RECORD_MAX_FILES", 168),
+	}
+	recorderMutex.Unlock()
+	log.Info.Println("Recording received messages to:", path)
+
+	// Flush the recording periodically, such that a crash loses only a few seconds.
+	go func() {
+		for {
+			time.Sleep(5 * time.Second)
+			recorderMutex.Lock()
+			if active != nil && active.writer != nil {
+				if err := active.writer.Flush(); err != nil {
+					log.Warning.Println("Could not flush recording:", err)
+				}
+			}
+			recorderMutex.Unlock()
+		}
+	}()
+}
+
+// Record a received message. Does nothing if recording is disabled.
+func Record(topic string, receivedAt time.Time, payload []byte) {
+	recorderMutex.Lock()
+	defer recorderMutex.Unlock()
+	if active == nil {
+		return
+	}
+	line, err := json.Marshal(Entry{Topic: topic, ReceivedAt: receivedAt, Payload: payload})
+	if err != nil {
+		log.Warning.Println("Could not record message:", err)
+		return
+	}
+	line = append(line, '\n')
+	if err := active.write(line, receivedAt); err != nil {
+		log.Warning.Println("Could not record message:", err)
+	}
+}
+
+// Close the current recording file, e.g. before the service exits.
+func Close() {
+	recorderMutex.Lock()
+	defer recorderMutex.Unlock()
+	if active == nil {
+		return
+	}
+	if err := active.close(); err != nil {
+		log.Warning.Println("Could not close recording:", err)
+	}
+}
+
+// Write a line to the current file, rotating it if necessary.
+func (r *recorder) write(line []byte, now time.Time) error {
+	if r.writer != nil && (r.written+int64(len(line)) > r.maxFileSize || now.Sub(r.opened) > r.rotateInterval) {
+		if err := r.close(); err != nil {
+			return err
+		}
+	}
+	if r.writer == nil {
+		if err := r.open(now); err != nil {
+			return err
+		}
+	}
+	n, err := r.writer.Write(line)
+	r.written += int64(n)
+	return err
+}
+
+// Open a new recording file and delete old files that exceed the retention.
+func (r *recorder) open(now time.Time) error {
+	name := fmt.Sprintf("%s%s%s", filePrefix, now.UTC().Format("20060102T150405.000"), fileSuffix)
+	file, err := os.OpenFile(filepath.Join(r.path, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.writer = gzip.NewWriter(file)
+	r.written = 0
+	r.opened = now
+	r.prune()
+	return nil
+}
+
+// Close the current recording file.
+func (r *recorder) close() error {
+	if r.writer == nil {
+		return nil
+	}
+	writerErr := r.writer.Close()
+	fileErr := r.file.Close()
+	r.writer = nil
+	r.file = nil
+	if writerErr != nil {
+		return writerErr
+	}
+	return fileErr
+}
+
+// Delete the oldest recording files if there are more than allowed.
+func (r *recorder) prune() {
+	if r.maxFiles <= 0 {
+		return
+	}
+	files, err := Files(r.path)
+	if err != nil {
+		log.Warning.Println("Could not list recordings:", err)
+		return
+	}
+	for len(files) > r.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			log.Warning.Println("Could not delete old recording:", err)
+		}
+		files = files[1:]
+	}
+}
+
+// List the recording files at the given path in chronological order.
+// The path can either be a directory or a single recording file.
+func Files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), filePrefix) || !strings.HasSuffix(entry.Name(), fileSuffix) {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	// The file names contain the opening time, thus they sort chronologically.
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,217 @@
+package recording
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Record the given entries with a fresh recorder in a temporary directory and return the directory.
+func record(t *testing.T, r *recorder, entries []Entry) string {
+	t.Helper()
+	r.path = t.TempDir()
+	recorderMutex.Lock()
+	active = r
+	recorderMutex.Unlock()
+	defer func() {
+		Close()
+		recorderMutex.Lock()
+		active = nil
+		recorderMutex.Unlock()
+	}()
+	for _, entry := range entries {
+		Record(entry.Topic, entry.ReceivedAt, entry.Payload)
+	}
+	return r.path
+}
+
+// Read all entries of the recording files at the given path.
+func readAll(t *testing.T, path string) []Entry {
+	t.Helper()
+	files, err := Files(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make([]Entry, 0)
+	for _, file := range files {
+		err := readFile(file, func(entry Entry) bool {
+			entries = append(entries, entry)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return entries
+}
+
+func TestEntryJSON(t *testing.T) {
+	receivedAt := time.Date(2023, 5, 11, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		payload  []byte
+		contains string
+	}{
+		{"json object", []byte(`{"value":[1,2,3]}`), `"payload":{"value":[1,2,3]}`},
+		{"json number", []byte(`42`), `"payload":42`},
+		{"invalid json", []byte(`{"value":`), `"payload_base64":"eyJ2YWx1ZSI6"`},
+		{"binary", []byte{0x00, 0xff}, `"payload_base64":"AP8="`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line, err := Entry{Topic: "hamburg/1", ReceivedAt: receivedAt, Payload: test.payload}.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(line), test.contains) {
+				t.Errorf("MarshalJSON = %s, want it to contain %s", line, test.contains)
+			}
+			var entry Entry
+			if err := entry.UnmarshalJSON(line); err != nil {
+				t.Fatal(err)
+			}
+			if entry.Topic != "hamburg/1" || !entry.ReceivedAt.Equal(receivedAt) || !bytes.Equal(entry.Payload, test.payload) {
+				t.Errorf("UnmarshalJSON = %v, want the recorded entry", entry)
+			}
+		})
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	start := time.Date(2023, 5, 11, 10, 0, 0, 123000000, time.UTC)
+	entries := []Entry{
+		{Topic: "hamburg/1", ReceivedAt: start, Payload: []byte(`{"greentimeThreshold":50}`)},
+		{Topic: "hamburg/2", ReceivedAt: start.Add(1500 * time.Millisecond), Payload: []byte(`not json`)},
+		{Topic: "hamburg/1", ReceivedAt: start.Add(3 * time.Second), Payload: []byte(`{"value":[0,100]}`)},
+	}
+	path := record(t, &recorder{maxFileSize: 1024 * 1024, rotateInterval: time.Hour, maxFiles: 10}, entries)
+
+	got := readAll(t, path)
+	if len(got) != len(entries) {
+		t.Fatalf("read %d entries, want %d", len(got), len(entries))
+	}
+	for i, entry := range entries {
+		if got[i].Topic != entry.Topic || !got[i].ReceivedAt.Equal(entry.ReceivedAt) || !bytes.Equal(got[i].Payload, entry.Payload) {
+			t.Errorf("entry %d = %v, want %v", i, got[i], entry)
+		}
+	}
+}
+
+func TestRecordIsReadable(t *testing.T) {
+	start := time.Date(2023, 5, 11, 10, 0, 0, 0, time.UTC)
+	path := record(t, &recorder{maxFileSize: 1024 * 1024, rotateInterval: time.Hour, maxFiles: 10}, []Entry{
+		{Topic: "hamburg/1", ReceivedAt: start, Payload: []byte(`{"signalGroupId":"hamburg/1"}`)},
+	})
+	files, err := Files(path)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Files = %v, %v, want a single file", files, err)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"payload":{"signalGroupId":"hamburg/1"}`) {
+		t.Errorf("recording = %s, want the payload as json", content)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	start := time.Date(2023, 5, 11, 10, 0, 0, 0, time.UTC)
+	payload := []byte(`{"value":[` + strings.Repeat("1,", 100) + `1]}`)
+	tests := []struct {
+		name           string
+		maxFileSize    int64
+		rotateInterval time.Duration
+		maxFiles       int
+		step           time.Duration
+		count          int
+		files          int
+	}{
+		{"single file", 1024 * 1024, time.Hour, 10, time.Second, 10, 1},
+		{"rotated by size", 700, time.Hour, 10, time.Second, 10, 5},
+		{"rotated by interval", 1024 * 1024, time.Hour, 10, 40 * time.Minute, 10, 5},
+		{"pruned", 700, time.Hour, 3, time.Second, 10, 3},
+		{"unlimited files", 700, time.Hour, 0, time.Second, 10, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := make([]Entry, test.count)
+			for i := range entries {
+				entries[i] = Entry{Topic: "hamburg/1", ReceivedAt: start.Add(time.Duration(i) * test.step), Payload: payload}
+			}
+			path := record(t, &recorder{maxFileSize: test.maxFileSize, rotateInterval: test.rotateInterval, maxFiles: test.maxFiles}, entries)
+
+			files, err := Files(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != test.files {
+				t.Fatalf("%d files, want %d", len(files), test.files)
+			}
+			// The oldest files are pruned, thus the newest entries remain.
+			got := readAll(t, path)
+			if len(got) == 0 || !got[len(got)-1].ReceivedAt.Equal(entries[len(entries)-1].ReceivedAt) {
+				t.Errorf("the newest entry is missing")
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].ReceivedAt.Before(got[i-1].ReceivedAt) {
+					t.Errorf("entries are not in chronological order")
+				}
+			}
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"predictions-20230511T120000.000.ndjson.gz",
+		"predictions-20230511T100000.000.ndjson.gz",
+		"other.ndjson.gz",
+		"predictions-20230511T110000.000.json",
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{"directory", dir, []string{
+			filepath.Join(dir, "predictions-20230511T100000.000.ndjson.gz"),
+			filepath.Join(dir, "predictions-20230511T120000.000.ndjson.gz"),
+		}},
+		{"single file", filepath.Join(dir, "other.ndjson.gz"), []string{filepath.Join(dir, "other.ndjson.gz")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := Files(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(files, ",") != strings.Join(test.want, ",") {
+				t.Errorf("Files = %v, want %v", files, test.want)
+			}
+		})
+	}
+	if _, err := Files(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("Files of a missing path succeeded")
+	}
+}
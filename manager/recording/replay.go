@@ -0,0 +1,95 @@
+package recording
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"monitor/clock"
+	"monitor/log"
+	"os"
+	"time"
+)
+
+// Start replaying all messages of the recording at the given path through the handler.
+// The clock is simulated from the time of the first message with the given speed,
+// and each message is handed over when the simulated clock reaches its receive time.
+// The clock is already running when this function returns, the replay continues in the background.
+func StartReplay(path string, speed float64, handler func(topic string, payload []byte, receivedAt time.Time)) error {
+	files, err := Files(path)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no recordings found at " + path)
+	}
+
+	// Start the simulated clock at the time of the first message.
+	var first *Entry
+	err = readFile(files[0], func(entry Entry) bool {
+		first = &entry
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if first == nil {
+		return errors.New("the first recording is empty: " + files[0])
+	}
+	clock.Simulate(first.ReceivedAt, speed)
+	log.Info.Printf("Replaying %d recording files from %v with speed %v...\n", len(files), first.ReceivedAt, speed)
+
+	go func() {
+		replayed := 0
+		for _, file := range files {
+			err := readFile(file, func(entry Entry) bool {
+				clock.SleepUntil(entry.ReceivedAt)
+				handler(entry.Topic, entry.Payload, entry.ReceivedAt)
+				replayed++
+				return true
+			})
+			if err != nil {
+				log.Error.Printf("Could not replay recording %s: %v\n", file, err)
+			}
+		}
+		log.Info.Printf("Replay finished after %d messages.\n", replayed)
+	}()
+	return nil
+}
+
+// Read the entries of a single recording file until the callback returns false.
+func readFile(path string, fn func(entry Entry) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Warning.Printf("Skipping invalid line in recording %s: %v\n", path, err)
+			continue
+		}
+		if !fn(entry) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// Files of a crashed recorder end without a proper gzip footer.
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Warning.Printf("Recording %s ends unexpectedly, it was probably not closed properly.\n", path)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
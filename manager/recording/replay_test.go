@@ -0,0 +1,96 @@
+package recording
+
+import (
+	"bytes"
+	"monitor/clock"
+	"testing"
+	"time"
+)
+
+// A message handed over by the replay.
+type replayed struct {
+	topic      string
+	payload    []byte
+	receivedAt time.Time
+	clock      time.Time
+}
+
+// Replay the recording at the given path and collect the handed over messages.
+func replay(t *testing.T, path string, speed float64, count int) ([]replayed, time.Duration) {
+	t.Helper()
+	messages := make(chan replayed, count)
+	started := time.Now()
+	err := StartReplay(path, speed, func(topic string, payload []byte, receivedAt time.Time) {
+		messages <- replayed{topic, payload, receivedAt, clock.Now()}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]replayed, 0, count)
+	for len(got) < count {
+		select {
+		case message := <-messages:
+			got = append(got, message)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("replayed %d messages, want %d", len(got), count)
+		}
+	}
+	return got, time.Since(started)
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	start := time.Date(2023, 5, 11, 10, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Topic: "hamburg/1", ReceivedAt: start, Payload: []byte(`{"greentimeThreshold":50}`)},
+		{Topic: "hamburg/2", ReceivedAt: start.Add(2 * time.Second), Payload: []byte{0x00, 0x01}},
+		{Topic: "hamburg/1", ReceivedAt: start.Add(2 * time.Hour), Payload: []byte(`{"value":[0,100]}`)},
+	}
+	// Rotate after each hour, such that the replay spans multiple files.
+	path := record(t, &recorder{maxFileSize: 1024 * 1024, rotateInterval: time.Hour, maxFiles: 10}, entries)
+
+	got, _ := replay(t, path, 100000, len(entries))
+	for i, entry := range entries {
+		if got[i].topic != entry.Topic || !got[i].receivedAt.Equal(entry.ReceivedAt) || !bytes.Equal(got[i].payload, entry.Payload) {
+			t.Errorf("message %d = %s %v %s, want %s %v %s", i,
+				got[i].topic, got[i].receivedAt, got[i].payload, entry.Topic, entry.ReceivedAt, entry.Payload)
+		}
+		// Each message is handed over when the simulated clock reaches its receive time.
+		if got[i].clock.Before(entry.ReceivedAt) {
+			t.Errorf("message %d handed over at %v, before it was received at %v", i, got[i].clock, entry.ReceivedAt)
+		}
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	start := time.Date(2023, 5, 11, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		span  time.Duration
+		speed float64
+		want  time.Duration
+	}{
+		{"ten times faster", 2 * time.Second, 10, 200 * time.Millisecond},
+		{"hundred times faster", 20 * time.Second, 100, 200 * time.Millisecond},
+		{"thousand times faster", 5 * time.Minute, 1000, 300 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := []Entry{
+				{Topic: "hamburg/1", ReceivedAt: start, Payload: []byte(`{}`)},
+				{Topic: "hamburg/1", ReceivedAt: start.Add(test.span), Payload: []byte(`{}`)},
+			}
+			path := record(t, &recorder{maxFileSize: 1024 * 1024, rotateInterval: time.Hour, maxFiles: 10}, entries)
+
+			_, elapsed := replay(t, path, test.speed, len(entries))
+			if elapsed < test.want*9/10 || elapsed > test.want+time.Second {
+				t.Errorf("replay took %v, want about %v", elapsed, test.want)
+			}
+		})
+	}
+}
+
+func TestReplayWithoutRecordings(t *testing.T) {
+	if err := StartReplay(t.TempDir(), 1, func(string, []byte, time.Time) {}); err == nil {
+		t.Errorf("StartReplay without recordings succeeded")
+	}
+}
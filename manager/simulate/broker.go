@@ -0,0 +1,311 @@
+package simulate
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"monitor/log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// MQTT control packet types, see the MQTT 3.1.1 specification.
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// A minimal in-process MQTT 3.1.1 broker. It supports everything the monitor needs:
+// connecting, (un)subscribing with wildcards, pings and publishing with QoS 0.
+// Messages are always delivered with QoS 0, regardless of the requested QoS.
+type Broker struct {
+	// The listener of the broker.
+	listener net.Listener
+	// A lock for the clients.
+	mutex sync.Mutex
+	// The connected clients and their subscriptions.
+	clients map[*brokerClient]struct{}
+}
+
+// A client connected to the broker.
+type brokerClient struct {
+	// The network connection of the client.
+	conn net.Conn
+	// A lock for writes to the connection.
+	writeMutex sync.Mutex
+	// The topic filters the client subscribed to. Protected by the broker mutex.
+	filters map[string]struct{}
+}
+
+// Start a broker on the given address, e.g. `127.0.0.1:0`.
+func StartBroker(address string) (*Broker, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	broker := &Broker{
+		listener: listener,
+		clients:  make(map[*brokerClient]struct{}),
+	}
+	go broker.accept()
+	return broker, nil
+}
+
+// The url under which the broker can be reached by mqtt clients.
+func (b *Broker) Url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// Stop accepting connections and disconnect all clients.
+func (b *Broker) Close() error {
+	err := b.listener.Close()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for client := range b.clients {
+		client.conn.Close()
+	}
+	return err
+}
+
+// Publish a message to all clients with a matching subscription.
+func (b *Broker) Publish(topic string, payload []byte) {
+	packet := encodePublish(topic, payload)
+	b.mutex.Lock()
+	receivers := make([]*brokerClient, 0)
+	for client := range b.clients {
+		for filter := range client.filters {
+			if topicMatches(filter, topic) {
+				receivers = append(receivers, client)
+				break
+			}
+		}
+	}
+	b.mutex.Unlock()
+	for _, client := range receivers {
+		if err := client.write(packet); err != nil {
+			client.conn.Close()
+		}
+	}
+}
+
+// Accept new client connections.
+func (b *Broker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Warning.Println("Simulated mqtt broker stopped accepting connections:", err)
+			}
+			return
+		}
+		client := &brokerClient{conn: conn, filters: make(map[string]struct{})}
+		b.mutex.Lock()
+		b.clients[client] = struct{}{}
+		b.mutex.Unlock()
+		go b.serve(client)
+	}
+}
+
+// Handle the packets of a single client until it disconnects.
+func (b *Broker) serve(client *brokerClient) {
+	defer func() {
+		b.mutex.Lock()
+		delete(b.clients, client)
+		b.mutex.Unlock()
+		client.conn.Close()
+	}()
+	reader := bufio.NewReader(client.conn)
+	for {
+		header, body, err := readPacket(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Warning.Println("Simulated mqtt broker dropped client:", err)
+			}
+			return
+		}
+		switch header >> 4 {
+		case packetConnect:
+			err = client.write([]byte{packetConnack << 4, 2, 0, 0})
+		case packetSubscribe:
+			err = b.subscribe(client, body)
+		case packetUnsubscribe:
+			err = b.unsubscribe(client, body)
+		case packetPublish:
+			err = b.forward(client, header, body)
+		case packetPingreq:
+			err = client.write([]byte{packetPingresp << 4, 0})
+		case packetDisconnect:
+			return
+		}
+		if err != nil {
+			log.Warning.Println("Simulated mqtt broker dropped client:", err)
+			return
+		}
+	}
+}
+
+// Handle a subscribe packet and acknowledge all filters with QoS 0.
+func (b *Broker) subscribe(client *brokerClient, body []byte) error {
+	if len(body) < 2 {
+		return errors.New("malformed subscribe packet")
+	}
+	packetId, rest := body[:2], body[2:]
+	codes := make([]byte, 0)
+	b.mutex.Lock()
+	for len(rest) > 0 {
+		filter, remaining, err := readString(rest)
+		if err != nil || len(remaining) < 1 {
+			b.mutex.Unlock()
+			return errors.New("malformed subscribe packet")
+		}
+		client.filters[filter] = struct{}{}
+		codes = append(codes, 0)
+		rest = remaining[1:] // Skip the requested QoS.
+	}
+	b.mutex.Unlock()
+	return client.write(encodePacket(packetSuback<<4, append(append([]byte{}, packetId...), codes...)))
+}
+
+// Handle an unsubscribe packet.
+func (b *Broker) unsubscribe(client *brokerClient, body []byte) error {
+	if len(body) < 2 {
+		return errors.New("malformed unsubscribe packet")
+	}
+	packetId, rest := body[:2], body[2:]
+	b.mutex.Lock()
+	for len(rest) > 0 {
+		filter, remaining, err := readString(rest)
+		if err != nil {
+			b.mutex.Unlock()
+			return errors.New("malformed unsubscribe packet")
+		}
+		delete(client.filters, filter)
+		rest = remaining
+	}
+	b.mutex.Unlock()
+	return client.write(encodePacket(packetUnsuback<<4, packetId))
+}
+
+// Forward a message published by a client to all subscribers.
+func (b *Broker) forward(client *brokerClient, header byte, body []byte) error {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return errors.New("malformed publish packet")
+	}
+	qos := (header >> 1) & 3
+	if qos > 0 {
+		if len(rest) < 2 {
+			return errors.New("malformed publish packet")
+		}
+		if err := client.write(encodePacket(packetPuback<<4, rest[:2])); err != nil {
+			return err
+		}
+		rest = rest[2:]
+	}
+	b.Publish(topic, rest)
+	return nil
+}
+
+// Write a packet to the client.
+func (c *brokerClient) write(packet []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// Read a packet and return its fixed header byte and its body.
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	// The remaining length is encoded as a variable length integer.
+	length := 0
+	for multiplier := 1; ; multiplier *= 128 {
+		digit, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&127) * multiplier
+		if digit&128 == 0 {
+			break
+		}
+		if multiplier > 128*128*128 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// Read a length prefixed utf-8 string and return it with the remaining bytes.
+func readString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, errors.New("missing string length")
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+length {
+		return "", nil, errors.New("string exceeds packet")
+	}
+	return string(data[2 : 2+length]), data[2+length:], nil
+}
+
+// Encode a packet with the given fixed header byte and body.
+func encodePacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 128
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// Encode a publish packet with QoS 0.
+func encodePublish(topic string, payload []byte) []byte {
+	body := make([]byte, 2, 2+len(topic)+len(payload))
+	binary.BigEndian.PutUint16(body, uint16(len(topic)))
+	body = append(body, topic...)
+	body = append(body, payload...)
+	return encodePacket(packetPublish<<4, body)
+}
+
+// Check whether a topic matches a subscription filter with `+` and `#` wildcards.
+func topicMatches(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
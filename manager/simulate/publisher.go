@@ -0,0 +1,113 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"monitor/clock"
+	"monitor/log"
+	"time"
+)
+
+// The configuration of the synthetic prediction publisher.
+type publisherConfig struct {
+	// The interval in which predictions are published.
+	Interval time.Duration
+	// The probability that a signal group drops out in a publishing round.
+	Dropout float64
+	// How long a dropped out signal group stays silent.
+	DropoutDuration time.Duration
+	// The share of dropouts in which the controller stops sending observations as well.
+	UpstreamShare float64
+	// The mean prediction quality.
+	Quality float64
+	// The offset added to all timestamps, to simulate a skewed clock of the prediction service.
+	ClockSkew time.Duration
+	// The number of seconds covered by each prediction.
+	Horizon int
+}
+
+// The timestamp format of the prediction service (Java ZonedDateTime).
+const predictionTimeFormat = "2006-01-02T15:04:05Z07:00[UTC]"
+
+// Periodically publish synthetic predictions and primary signal observations for all signal groups,
+// until the stop channel is closed.
+func publishPredictions(broker *Broker, signalGroups []signalGroup, config publisherConfig, stop <-chan struct{}) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	silentUntil := make(map[string]time.Time)
+	upstreamSilentUntil := make(map[string]time.Time)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		now := clock.Now()
+		published := 0
+		for _, sg := range signalGroups {
+			if now.Before(silentUntil[sg.Name]) {
+				continue
+			}
+			if random.Float64() < config.Dropout {
+				silentUntil[sg.Name] = now.Add(config.DropoutDuration)
+				if random.Float64() < config.UpstreamShare {
+					upstreamSilentUntil[sg.Name] = now.Add(config.DropoutDuration)
+				}
+				continue
+			}
+			payload, err := json.Marshal(sg.prediction(now, config, random))
+			if err != nil {
+				log.Warning.Println("Could not marshal simulated prediction:", err)
+				continue
+			}
+			broker.Publish("hamburg/"+sg.Name, payload)
+			published++
+		}
+		for _, sg := range signalGroups {
+			if now.Before(upstreamSilentUntil[sg.Name]) {
+				continue
+			}
+			observation := map[string]interface{}{
+				"phenomenonTime": now.UTC().Format(time.RFC3339),
+				"resultTime":     now.UTC().Format(time.RFC3339),
+				"result":         3,
+			}
+			payload, err := json.Marshal(observation)
+			if err != nil {
+				log.Warning.Println("Could not marshal simulated observation:", err)
+				continue
+			}
+			broker.Publish(fmt.Sprintf("v1.1/Datastreams(%d)/Observations", sg.DatastreamId), payload)
+		}
+		log.Info.Printf("Published %d simulated predictions.\n", published)
+		clock.Sleep(config.Interval)
+	}
+}
+
+// Build a synthetic prediction of the signal group starting at the given time.
+func (sg signalGroup) prediction(now time.Time, config publisherConfig, random *rand.Rand) map[string]interface{} {
+	start := now.Truncate(time.Second)
+	values := make([]int64, config.Horizon)
+	for i := range values {
+		second := (int(start.Unix()) + i + sg.Offset) % sg.CycleLength
+		if second < sg.GreenLength {
+			values[i] = 100
+		}
+	}
+	quality := config.Quality + (random.Float64()-0.5)*0.2
+	if quality > 1 {
+		quality = 1
+	}
+	if quality < 0 {
+		quality = 0
+	}
+	skewed := start.Add(config.ClockSkew).UTC()
+	return map[string]interface{}{
+		"greentimeThreshold": 50,
+		"predictionQuality":  quality,
+		"signalGroupId":      sg.Name,
+		"startTime":          skewed.Format(predictionTimeFormat),
+		"value":              values,
+		"timestamp":          now.Add(config.ClockSkew).UTC().Format(predictionTimeFormat),
+	}
+}
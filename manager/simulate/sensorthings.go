@@ -0,0 +1,165 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"monitor/clock"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A synthetic signal group with its location and signal program.
+type signalGroup struct {
+	// The name of the thing, e.g. `1000_1`.
+	Name string
+	// The id of the simulated intersection.
+	Intersection int
+	// The coordinates of the ingress, connection and egress lane as [lng, lat].
+	Lanes [][][]float64
+	// The cycle length of the signal program in seconds.
+	CycleLength int
+	// The length of the green phase in seconds.
+	GreenLength int
+	// The offset of the green phase within the cycle in seconds.
+	Offset int
+	// The id of the datastream with the primary signal observations of the signal group.
+	DatastreamId int
+}
+
+// The approach directions of a simulated intersection as bearings in degrees.
+var approaches = []float64{0, 90, 180, 270}
+
+// Generate the given number of signal groups on a grid of intersections around Hamburg.
+func generateSignalGroups(count int) []signalGroup {
+	const (
+		centerLat = 53.5511
+		centerLng = 9.9937
+		spacing   = 0.004 // Roughly 300-450 metres between intersections.
+	)
+	signalGroups := make([]signalGroup, 0, count)
+	columns := int(math.Ceil(math.Sqrt(float64(count) / float64(len(approaches)))))
+	for i := 0; i < count; i++ {
+		intersection := i / len(approaches)
+		approach := approaches[i%len(approaches)]
+		lat := centerLat + float64(intersection/columns)*spacing
+		lng := centerLng + float64(intersection%columns)*spacing*1.6
+		cycleLength := 60 + 10*(intersection%7)
+		signalGroups = append(signalGroups, signalGroup{
+			Name:         fmt.Sprintf("%d_%d", 1000+intersection, i%len(approaches)+1),
+			Intersection: 1000 + intersection,
+			Lanes:        approachLanes(lat, lng, approach),
+			CycleLength:  cycleLength,
+			GreenLength:  cycleLength / 3,
+			Offset:       (i % len(approaches)) * cycleLength / 4,
+			DatastreamId: i + 1,
+		})
+	}
+	return signalGroups
+}
+
+// Build the ingress, connection and egress lane of an approach to an intersection.
+// The ingress lane ends at the stop line, 10 metres before the intersection center.
+func approachLanes(lat float64, lng float64, bearing float64) [][][]float64 {
+	point := func(distance float64, bearing float64) []float64 {
+		const earthRadius = 6371000.0
+		rad := bearing * math.Pi / 180
+		dLat := distance * math.Cos(rad) / earthRadius * 180 / math.Pi
+		dLng := distance * math.Sin(rad) / (earthRadius * math.Cos(lat*math.Pi/180)) * 180 / math.Pi
+		return []float64{lng + dLng, lat + dLat}
+	}
+	// The traffic comes from the opposite direction of the bearing.
+	from := bearing + 180
+	ingress := [][]float64{point(80, from), point(10, from)}
+	connection := [][]float64{point(10, from), point(10, bearing)}
+	egress := [][]float64{point(10, bearing), point(80, bearing)}
+	return [][][]float64{ingress, connection, egress}
+}
+
+// The SensorThings representation of a signal group.
+func (sg signalGroup) thing(baseUrl string, iotId int) map[string]interface{} {
+	selfLink := fmt.Sprintf("%sThings(%d)", baseUrl, iotId)
+	return map[string]interface{}{
+		"@iot.id":       iotId,
+		"@iot.selfLink": selfLink,
+		"name":          sg.Name,
+		"description":   "Simulated signal group " + sg.Name,
+		"properties": map[string]interface{}{
+			"topic":           "hamburg/" + sg.Name,
+			"assetID":         fmt.Sprintf("SIM-%d", sg.Intersection),
+			"keywords":        []string{"simulation"},
+			"laneType":        "Radfahrer",
+			"language":        "de",
+			"ownerThing":      fmt.Sprintf("SIM-Controller-%d", sg.Intersection),
+			"connectionID":    fmt.Sprintf("%d", iotId),
+			"egressLaneID":    fmt.Sprintf("%d", 3*iotId+2),
+			"ingressLaneID":   fmt.Sprintf("%d", 3*iotId),
+			"infoLastUpdated": clock.Now().UTC().Add(-24 * time.Hour).Format(time.RFC3339),
+			"trafficLightsID": fmt.Sprintf("%d", sg.Intersection),
+		},
+		"Datastreams": []interface{}{
+			map[string]interface{}{
+				"@iot.id": sg.DatastreamId,
+				"name":    "Primary signal of " + sg.Name,
+				"properties": map[string]interface{}{
+					"layerName": "primary_signal",
+				},
+			},
+		},
+		"Locations": []interface{}{
+			map[string]interface{}{
+				"@iot.id":      iotId,
+				"description":  "Lanes of " + sg.Name,
+				"encodingType": "application/geo+json",
+				"location": map[string]interface{}{
+					"type": "Feature",
+					"geometry": map[string]interface{}{
+						"type":        "MultiLineString",
+						"coordinates": sg.Lanes,
+					},
+					"name":          sg.Name,
+					"@iot.selfLink": fmt.Sprintf("%sLocations(%d)", baseUrl, iotId),
+				},
+			},
+		},
+	}
+}
+
+// Start a fake SensorThings API that serves the given signal groups as paged things.
+// Returns the base url of the API, including the trailing slash, and a function that stops it.
+func startSensorThings(signalGroups []signalGroup) (string, func() error, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	baseUrl := "http://" + listener.Addr().String() + "/v1.1/"
+
+	const pageSize = 100
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.1/Things", func(w http.ResponseWriter, r *http.Request) {
+		// The filter query is ignored, all simulated things match.
+		skip, _ := strconv.Atoi(r.URL.Query().Get("$skip"))
+		if skip < 0 || skip > len(signalGroups) {
+			skip = len(signalGroups)
+		}
+		end := skip + pageSize
+		if end > len(signalGroups) {
+			end = len(signalGroups)
+		}
+		things := make([]interface{}, 0, end-skip)
+		for i := skip; i < end; i++ {
+			things = append(things, signalGroups[i].thing(baseUrl, i+1))
+		}
+		response := map[string]interface{}{"value": things}
+		if end < len(signalGroups) {
+			response["@iot.nextLink"] = fmt.Sprintf("%sThings?$skip=%d", baseUrl, end)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	return baseUrl, server.Close, nil
+}
@@ -0,0 +1,158 @@
+package simulate
+
+import (
+	"io/ioutil"
+	"monitor/env"
+	"monitor/log"
+	"os"
+	"time"
+)
+
+// The configuration of a simulation environment.
+type Config struct {
+	// The number of simulated signal groups.
+	NumThings int
+	// The username for the basic auth of the fake worker.
+	WorkerUser string
+	// The password for the basic auth of the fake worker.
+	WorkerPass string
+	// The interval in which predictions are published.
+	Interval time.Duration
+	// The probability that a signal group drops out in a publishing round.
+	Dropout float64
+	// How long a dropped out signal group stays silent.
+	DropoutDuration time.Duration
+	// The share of dropouts in which the controller stops sending observations as well.
+	UpstreamShare float64
+	// The mean prediction quality.
+	Quality float64
+	// The offset added to all timestamps, to simulate a skewed clock of the prediction service.
+	ClockSkew time.Duration
+	// The number of seconds covered by each prediction.
+	Horizon int
+}
+
+// Get the configuration of the simulation from the `SIMULATION_*` environment variables.
+func ConfigFromEnv() Config {
+	return Config{
+		NumThings:       env.Int("SIMULATION_THINGS", 200),
+		WorkerUser:      env.String("WORKER_BASIC_AUTH_USER", "simulation"),
+		WorkerPass:      env.String("WORKER_BASIC_AUTH_PASS", "simulation"),
+		Interval:        env.Duration("SIMULATION_INTERVAL", 10*time.Second),
+		Dropout:         env.Float("SIMULATION_DROPOUT", 0.01),
+		DropoutDuration: env.Duration("SIMULATION_DROPOUT_DURATION", 5*time.Minute),
+		UpstreamShare:   env.Float("SIMULATION_UPSTREAM_SHARE", 0.5),
+		Quality:         env.Float("SIMULATION_QUALITY", 0.9),
+		ClockSkew:       env.Duration("SIMULATION_CLOCK_SKEW", 0),
+		Horizon:         env.Int("SIMULATION_HORIZON", 300),
+	}
+}
+
+// A running simulation environment: a fake SensorThings API, an embedded mqtt broker
+// publishing synthetic predictions and observations, and a fake worker that records uploads.
+type Simulation struct {
+	// The configuration of the simulation.
+	Config Config
+	// The base url of the fake SensorThings API, including the trailing slash.
+	SensorThingsUrl string
+	// The embedded mqtt broker. It also serves the MQTT extension of the fake SensorThings API.
+	Broker *Broker
+	// The fake worker.
+	Worker *Worker
+
+	// Stops the fake SensorThings API.
+	closeSensorThings func() error
+	// Closed to stop the publisher.
+	stop chan struct{}
+}
+
+// Start a simulation environment with the given configuration.
+func New(config Config) (*Simulation, error) {
+	signalGroups := generateSignalGroups(config.NumThings)
+	sim := &Simulation{Config: config, stop: make(chan struct{})}
+
+	var err error
+	sim.SensorThingsUrl, sim.closeSensorThings, err = startSensorThings(signalGroups)
+	if err != nil {
+		return nil, err
+	}
+	sim.Broker, err = StartBroker("127.0.0.1:0")
+	if err != nil {
+		sim.closeSensorThings()
+		return nil, err
+	}
+	sim.Worker, err = StartWorker(config.WorkerUser, config.WorkerPass)
+	if err != nil {
+		sim.closeSensorThings()
+		sim.Broker.Close()
+		return nil, err
+	}
+
+	go publishPredictions(sim.Broker, signalGroups, publisherConfig{
+		Interval:        config.Interval,
+		Dropout:         config.Dropout,
+		DropoutDuration: config.DropoutDuration,
+		UpstreamShare:   config.UpstreamShare,
+		Quality:         config.Quality,
+		ClockSkew:       config.ClockSkew,
+		Horizon:         config.Horizon,
+	}, sim.stop)
+	return sim, nil
+}
+
+// Get the environment variables that point the monitor to the simulated services.
+func (sim *Simulation) Env() map[string]string {
+	return map[string]string{
+		"SENSORTHINGS_URL":   sim.SensorThingsUrl,
+		"SENSORTHINGS_QUERY": "properties/laneType eq 'Radfahrer'",
+		"MQTT_URL":           sim.Broker.Url(),
+		// The broker also serves the MQTT extension of the simulated SensorThings API.
+		"SENSORTHINGS_MQTT_URL":      sim.Broker.Url(),
+		"SENSORTHINGS_MQTT_USERNAME": "",
+		"SENSORTHINGS_MQTT_PASSWORD": "",
+		"MQTT_USERNAME":              "",
+		"MQTT_PASSWORD":              "",
+		"WORKER_HOST":                sim.Worker.Host,
+		"WORKER_PORT":                sim.Worker.Port,
+		"WORKER_BASIC_AUTH_USER":     sim.Config.WorkerUser,
+		"WORKER_BASIC_AUTH_PASS":     sim.Config.WorkerPass,
+	}
+}
+
+// Stop the publisher and all simulated services.
+func (sim *Simulation) Close() {
+	close(sim.stop)
+	sim.closeSensorThings()
+	sim.Broker.Close()
+	sim.Worker.Close()
+}
+
+// Start a self-contained simulation environment configured with the `SIMULATION_*` environment
+// variables and point the environment variables of the monitor to it, such that the full
+// pipeline can run without any external service.
+func Start() {
+	sim, err := New(ConfigFromEnv())
+	if err != nil {
+		panic("Could not start simulation: " + err.Error())
+	}
+	for name, value := range sim.Env() {
+		if value == "" {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, value)
+		}
+	}
+	log.Info.Println("Simulated SensorThings API running at:", sim.SensorThingsUrl)
+	log.Info.Println("Simulated mqtt broker running at:", sim.Broker.Url())
+	log.Info.Printf("Simulated worker running at: %s:%s\n", sim.Worker.Host, sim.Worker.Port)
+
+	if os.Getenv("STATIC_PATH") == "" {
+		staticPath, err := ioutil.TempDir("", "prediction-monitor-")
+		if err != nil {
+			panic("Could not create static directory: " + err.Error())
+		}
+		os.Setenv("STATIC_PATH", staticPath+"/")
+		log.Info.Println("Writing static files to:", staticPath)
+	}
+	go sim.Worker.print()
+}
@@ -0,0 +1,119 @@
+package simulate
+
+import (
+	"encoding/json"
+	"math/rand"
+	"monitor/clock"
+	"monitor/predictions"
+	"monitor/status"
+	"monitor/sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Wait until the condition holds or fail the test after the timeout.
+func waitFor(t *testing.T, timeout time.Duration, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Run the pipeline against the simulation: sync the things from the fake SensorThings API,
+// ingest the predictions from the embedded broker, evaluate them and push the summary to the fake worker.
+func TestEndToEnd(t *testing.T) {
+	config := ConfigFromEnv()
+	config.NumThings = 8
+	config.Interval = 100 * time.Millisecond
+	config.Dropout = 0
+	sim, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	for name, value := range sim.Env() {
+		t.Setenv(name, value)
+	}
+	t.Setenv("STATIC_PATH", t.TempDir()+"/")
+
+	go sync.Run()
+	waitFor(t, 10*time.Second, "the things to be synced", func() bool {
+		sync.ThingsMutex.Lock()
+		defer sync.ThingsMutex.Unlock()
+		return len(sync.Things) == config.NumThings
+	})
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(sim.Broker.Url())
+	opts.SetClientID("simulation-test")
+	client := mqtt.NewClient(opts)
+	if conn := client.Connect(); conn.Wait() && conn.Error() != nil {
+		t.Fatal(conn.Error())
+	}
+	defer client.Disconnect(0)
+	onMessage := func(client mqtt.Client, msg mqtt.Message) {
+		predictions.Ingest(msg.Topic(), msg.Payload(), clock.Now())
+	}
+	if sub := client.Subscribe("hamburg/#", 0, onMessage); sub.Wait() && sub.Error() != nil {
+		t.Fatal(sub.Error())
+	}
+	waitFor(t, 10*time.Second, "a prediction of each thing", func() bool {
+		predictions.CurrentMutex.Lock()
+		defer predictions.CurrentMutex.Unlock()
+		return len(predictions.Current) == config.NumThings
+	})
+
+	status.EvaluateHealth()
+	sync.ThingsMutex.Lock()
+	topics := make([]string, 0, len(sync.Things))
+	for topic := range sync.Things {
+		topics = append(topics, topic)
+	}
+	sync.ThingsMutex.Unlock()
+	for _, topic := range topics {
+		health, ok := status.GetHealth(topic)
+		if !ok || !health.Healthy {
+			t.Errorf("Expected %s to be healthy, got %+v", topic, health)
+		}
+	}
+
+	status.WriteSummary()
+	body, ok := sim.Worker.File("status.json")
+	if !ok {
+		t.Fatal("Expected the summary to be uploaded to the worker")
+	}
+	var summary status.StatusSummary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.NumThings != config.NumThings || summary.NumPredictions != config.NumThings {
+		t.Errorf("Expected %d things and predictions, got %d things and %d predictions",
+			config.NumThings, summary.NumThings, summary.NumPredictions)
+	}
+}
+
+// Measure the throughput of the ingest path with synthetic predictions.
+func BenchmarkIngest(b *testing.B) {
+	config := ConfigFromEnv()
+	signalGroups := generateSignalGroups(config.NumThings)
+	random := rand.New(rand.NewSource(1))
+	payloads := make([][]byte, len(signalGroups))
+	for i, sg := range signalGroups {
+		payload, err := json.Marshal(sg.prediction(time.Now(), publisherConfig{Quality: config.Quality, Horizon: config.Horizon}, random))
+		if err != nil {
+			b.Fatal(err)
+		}
+		payloads[i] = payload
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sg := signalGroups[i%len(signalGroups)]
+		predictions.Ingest("hamburg/"+sg.Name, payloads[i%len(payloads)], time.Now())
+	}
+}
@@ -0,0 +1,102 @@
+package simulate
+
+import (
+	"io"
+	"monitor/log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A fake worker that records all uploaded files and serves them like the nginx worker.
+type Worker struct {
+	// The host on which the worker listens.
+	Host string
+	// The port on which the worker listens.
+	Port string
+
+	// The server of the worker.
+	server *http.Server
+	// A lock for the files.
+	mutex sync.Mutex
+	// The uploaded files by their path.
+	files map[string][]byte
+	// The total number of uploads.
+	uploads int
+}
+
+// Start a fake worker on a free local port that accepts uploads with the given credentials.
+func StartWorker(username string, password string) (*Worker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	w := &Worker{files: make(map[string][]byte)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/upload/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		user, pass, _ := r.BasicAuth()
+		if user != username || pass != password {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.mutex.Lock()
+		w.files[strings.TrimPrefix(r.URL.Path, "/upload/")] = body
+		w.uploads++
+		w.mutex.Unlock()
+		rw.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		body, ok := w.File(strings.TrimPrefix(r.URL.Path, "/"))
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write(body)
+	})
+	w.server = &http.Server{Handler: mux}
+	go w.server.Serve(listener)
+
+	w.Host, w.Port, err = net.SplitHostPort(listener.Addr().String())
+	return w, err
+}
+
+// Get the last uploaded content of a file, e.g. `status.json`.
+func (w *Worker) File(path string) ([]byte, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	body, ok := w.files[path]
+	return body, ok
+}
+
+// Get the total number of uploads.
+func (w *Worker) Uploads() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.uploads
+}
+
+// Stop the worker.
+func (w *Worker) Close() error {
+	return w.server.Close()
+}
+
+// Print out the number of uploads periodically.
+func (w *Worker) print() {
+	for {
+		time.Sleep(60 * time.Second)
+		w.mutex.Lock()
+		log.Info.Printf("Simulated worker received %d uploads of %d distinct files.", w.uploads, len(w.files))
+		w.mutex.Unlock()
+	}
+}
@@ -0,0 +1,18 @@
+package status
+
+import (
+	"fmt"
+	"monitor/predictions"
+)
+
+// Create Prometheus metrics with the number of topics that currently show each anomaly type
+// and how often each anomaly type was detected since startup.
+func anomalyMetrics() []string {
+	current, detections := predictions.AnomalyCounts()
+	metrics := make([]string, 0, 2*len(predictions.AnomalyTypes))
+	for _, anomaly := range predictions.AnomalyTypes {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_anomalies{anomaly=\"%s\"} %d", anomaly, current[anomaly]))
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_anomalies_detected_total{anomaly=\"%s\"} %d", anomaly, detections[anomaly]))
+	}
+	return metrics
+}
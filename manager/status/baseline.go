@@ -0,0 +1,163 @@
+package status
+
+import (
+	"fmt"
+	"monitor/data"
+	"monitor/env"
+	gosync "sync"
+	"time"
+)
+
+const (
+	// The thing is healthy.
+	ClassificationOk = "ok"
+	// The thing is unhealthy, but usually is at this hour of the week, e.g. switched off at night.
+	ClassificationExpectedOff = "expected_off"
+	// The thing is unhealthy, but usually isn't at this hour of the week, or there is no baseline yet.
+	ClassificationUnexpectedOutage = "unexpected_outage"
+	// The thing is in a planned maintenance window, regardless of its health.
+	ClassificationMaintenance = "maintenance"
+)
+
+// All classifications.
+var Classifications = []string{ClassificationOk, ClassificationExpectedOff, ClassificationUnexpectedOutage, ClassificationMaintenance}
+
+// The learned availability and quality of a thing in an hour of the week.
+type baselineBucket struct {
+	// The number of observed monitor runs.
+	Samples int `json:"samples"`
+	// The moving average share of monitor runs in which the thing was healthy.
+	Availability float64 `json:"availability"`
+	// The number of observed fresh predictions.
+	QualitySamples int `json:"quality_samples"`
+	// The moving average quality of the fresh predictions.
+	Quality float64 `json:"quality"`
+}
+
+// The baselines of each thing for each hour of the week, starting on Monday, by topic.
+var baselines = make(map[string]*[7 * 24]baselineBucket)
+
+// Whether the persisted baselines were loaded.
+var baselinesLoaded = false
+
+// The time at which the baselines were last persisted.
+var lastBaselinesStore time.Time
+
+// A lock for the baselines.
+var baselinesMutex = &gosync.Mutex{}
+
+// The file under `DATA_PATH` in which the baselines are persisted.
+const baselinesFile = "baselines.json"
+
+// The number of samples of an hour of the week from which on its baseline is used.
+var baselineMinSamples = env.Int("BASELINE_MIN_SAMPLES", 60)
+
+// The number of samples over which the baseline is averaged.
+var baselineWindow = env.Int("BASELINE_WINDOW", 240)
+
+// The baseline availability up to which unhealthy things are expected to be off.
+var baselineOffThreshold = env.Float("BASELINE_OFF_THRESHOLD", 0.1)
+
+// How often the baselines are persisted.
+var baselinePersistInterval = env.Duration("BASELINE_PERSIST_INTERVAL", 15*time.Minute)
+
+// Get the local hour of the week of the given time, starting with 0 on Monday.
+func hourOfWeek(t time.Time) int {
+	local := t.In(availabilityLocation())
+	return ((int(local.Weekday())+6)%7)*24 + local.Hour()
+}
+
+// Add a sample to a moving average. The average is exact for the first `window` samples
+// and decays exponentially afterwards, such that the baseline follows changed programs.
+func movingAverage(average float64, samples int, value float64, window int) float64 {
+	n := samples + 1
+	if n > window {
+		n = window
+	}
+	return average + (value-average)/float64(n)
+}
+
+// Classify the health of each thing relative to its baseline at the given time,
+// and learn the health into the baseline afterwards.
+func classifyHealth(health map[string]ThingHealth, now time.Time) {
+	baselinesMutex.Lock()
+	defer baselinesMutex.Unlock()
+
+	if !baselinesLoaded {
+		loaded := make(map[string]*[7 * 24]baselineBucket)
+		if data.Load(baselinesFile, &loaded) {
+			baselines = loaded
+		}
+		baselinesLoaded = true
+	}
+
+	hour := hourOfWeek(now)
+	for topic, thingHealth := range health {
+		buckets, ok := baselines[topic]
+		if !ok {
+			buckets = &[7 * 24]baselineBucket{}
+			baselines[topic] = buckets
+		}
+		bucket := &buckets[hour]
+
+		if bucket.Samples >= baselineMinSamples {
+			availability := bucket.Availability
+			thingHealth.BaselineAvailability = &availability
+		}
+		if bucket.QualitySamples >= baselineMinSamples {
+			quality := bucket.Quality
+			thingHealth.BaselineQuality = &quality
+		}
+		if thingHealth.Maintenance != nil {
+			thingHealth.Classification = ClassificationMaintenance
+		} else if thingHealth.Healthy {
+			thingHealth.Classification = ClassificationOk
+		} else if thingHealth.BaselineAvailability != nil && *thingHealth.BaselineAvailability <= baselineOffThreshold {
+			thingHealth.Classification = ClassificationExpectedOff
+		} else {
+			thingHealth.Classification = ClassificationUnexpectedOutage
+		}
+		health[topic] = thingHealth
+
+		// Learn the current state after it was classified against the past.
+		// Planned outages are not learned, such that they don't distort the baseline.
+		if thingHealth.Maintenance != nil {
+			continue
+		}
+		var available float64 = 0
+		if thingHealth.Healthy {
+			available = 1
+		}
+		bucket.Availability = movingAverage(bucket.Availability, bucket.Samples, available, baselineWindow)
+		bucket.Samples++
+		if thingHealth.Quality != nil {
+			bucket.Quality = movingAverage(bucket.Quality, bucket.QualitySamples, *thingHealth.Quality, baselineWindow)
+			bucket.QualitySamples++
+		}
+	}
+
+	// Drop the baselines of things that no longer exist. Before the first sync, all baselines are kept.
+	for topic := range baselines {
+		if _, ok := health[topic]; !ok && len(health) > 0 {
+			delete(baselines, topic)
+		}
+	}
+
+	if now.Sub(lastBaselinesStore) >= baselinePersistInterval {
+		data.Store(baselinesFile, baselines)
+		lastBaselinesStore = now
+	}
+}
+
+// Create Prometheus metrics with the number of things by classification.
+func classificationMetrics() []string {
+	counts := make(map[string]int)
+	for _, health := range healthList() {
+		counts[health.Classification]++
+	}
+	metrics := make([]string, 0, len(Classifications))
+	for _, classification := range Classifications {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_classification{classification=\"%s\"} %d", classification, counts[classification]))
+	}
+	return metrics
+}
@@ -0,0 +1,79 @@
+package status
+
+import (
+	"monitor/maintenance"
+	"testing"
+	"time"
+)
+
+func TestMovingAverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		average float64
+		samples int
+		value   float64
+		window  int
+		want    float64
+	}{
+		{"first sample", 0, 0, 1, 4, 1},
+		{"exact within the window", 0.5, 1, 0, 4, 0.25},
+		{"decays after the window", 1, 10, 0, 4, 0.75},
+		{"unchanged value", 0.5, 10, 0.5, 4, 0.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := movingAverage(test.average, test.samples, test.value, test.window); got != test.want {
+				t.Errorf("movingAverage = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClassifyHealth(t *testing.T) {
+	defer func(minSamples int, window int, offThreshold float64) {
+		baselineMinSamples, baselineWindow, baselineOffThreshold = minSamples, window, offThreshold
+	}(baselineMinSamples, baselineWindow, baselineOffThreshold)
+	baselineMinSamples, baselineWindow, baselineOffThreshold = 3, 10, 0.1
+	t.Setenv("DATA_PATH", "")
+
+	now := time.Date(2023, 5, 11, 2, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// The health of the thing in the previous runs at the same hour of the week.
+		history     []bool
+		healthy     bool
+		maintenance bool
+		want        string
+	}{
+		{"healthy", []bool{true, true, true}, true, false, ClassificationOk},
+		{"usually off", []bool{false, false, false}, false, false, ClassificationExpectedOff},
+		{"usually on", []bool{true, true, true}, false, false, ClassificationUnexpectedOutage},
+		{"too few samples", []bool{false, false}, false, false, ClassificationUnexpectedOutage},
+		{"sometimes on", []bool{false, true, false}, false, false, ClassificationUnexpectedOutage},
+		{"maintenance", []bool{false, false, false}, false, true, ClassificationMaintenance},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			baselinesMutex.Lock()
+			baselines = make(map[string]*[7 * 24]baselineBucket)
+			baselinesLoaded = true
+			baselinesMutex.Unlock()
+
+			topic := "hamburg/1_1"
+			for i, healthy := range test.history {
+				// The previous weeks at the same hour.
+				at := now.Add(-time.Duration(len(test.history)-i) * 7 * 24 * time.Hour)
+				classifyHealth(map[string]ThingHealth{topic: {Topic: topic, Healthy: healthy}}, at)
+			}
+			current := ThingHealth{Topic: topic, Healthy: test.healthy}
+			if test.maintenance {
+				current.Maintenance = &maintenance.Window{}
+			}
+			health := map[string]ThingHealth{topic: current}
+			classifyHealth(health, now)
+			if got := health[topic].Classification; got != test.want {
+				t.Errorf("Classification = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
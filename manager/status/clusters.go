@@ -0,0 +1,324 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/clock"
+	"monitor/env"
+	"monitor/log"
+	"monitor/sync"
+	"os"
+	"sort"
+	gosync "sync"
+)
+
+const (
+	// All affected things share a traffic lights controller.
+	ClusterKindController = "controller"
+	// All affected things share a data connection.
+	ClusterKindConnection = "connection"
+	// All affected things share an owner.
+	ClusterKindOwner = "owner"
+	// The stop lines of the affected things lie within `CLUSTER_DISTANCE` of each other.
+	ClusterKindArea = "area"
+	// A single thing is affected.
+	ClusterKindThing = "thing"
+)
+
+// All cluster kinds.
+var ClusterKinds = []string{ClusterKindController, ClusterKindConnection, ClusterKindOwner, ClusterKindArea, ClusterKindThing}
+
+// The subjects of the cluster messages by cluster kind, formatted with the cluster key.
+var clusterSubjects = map[string]string{
+	ClusterKindController: "controller %s",
+	ClusterKindConnection: "connection %s",
+	ClusterKindOwner:      "owner %s",
+	ClusterKindArea:       "area around %s",
+	ClusterKindThing:      "signal group %s",
+}
+
+// A group of concurrent outages that likely have a common cause.
+type OutageCluster struct {
+	// A stable id of the cluster, e.g. "controller:123".
+	Id string `json:"id"`
+	// Whether the affected things share a "controller", a "connection", an "owner",
+	// lie in the same "area", or a single "thing" is affected.
+	Kind string `json:"kind"`
+	// The shared controller, connection or owner, or the name of the first affected thing.
+	Key string `json:"key"`
+	// A human-readable description of the event, e.g. "controller 123 down, 14 signal groups affected".
+	Message string `json:"message"`
+	// The most common root cause of the affected things.
+	RootCause string `json:"root_cause"`
+	// The number of affected things.
+	NumAffected int `json:"num_affected"`
+	// The names of the affected things.
+	AffectedThings []string `json:"affected_things"`
+	// The latitude of the center of the stop lines of the affected things.
+	Lat *float64 `json:"lat"`
+	// The longitude of the center of the stop lines of the affected things.
+	Lng *float64 `json:"lng"`
+}
+
+// The outage clusters that are written to json.
+type OutageClusterReport struct {
+	// The time of the report.
+	UpdateTime int64 `json:"update_time"`
+	// The clusters of at least `CLUSTER_MIN_SIZE` things, largest first.
+	Clusters []OutageCluster `json:"clusters"`
+	// The outages of things that don't belong to a cluster.
+	Isolated []OutageCluster `json:"isolated"`
+	// The number of things in clusters.
+	NumClusteredThings int `json:"num_clustered_things"`
+}
+
+// The outage clusters of the last monitor run.
+var Clusters = OutageClusterReport{Clusters: make([]OutageCluster, 0), Isolated: make([]OutageCluster, 0)}
+
+// A lock for the outage clusters.
+var ClustersMutex = &gosync.Mutex{}
+
+// An attribute by which unhealthy things are grouped, with the kind of the resulting cluster.
+type clusterAttribute struct {
+	kind  string
+	value func(sync.Thing) string
+}
+
+// The attributes by which unhealthy things are grouped, from the most to the least specific.
+var clusterAttributes = []clusterAttribute{
+	{ClusterKindController, func(thing sync.Thing) string { return thing.Properties.TrafficLightsID }},
+	{ClusterKindConnection, func(thing sync.Thing) string { return thing.Properties.ConnectionID }},
+	{ClusterKindOwner, func(thing sync.Thing) string { return thing.Properties.OwnerThing }},
+}
+
+// A group of unhealthy things by their indices, with the kind and the key of the cluster.
+type thingGroup struct {
+	kind    string
+	key     string
+	indices []int
+}
+
+// Group the things by the most specific attribute that they share with another thing. Each thing
+// belongs to a single group, such that groups are not chained via different attributes.
+// The remaining things are grouped by the distance of their stop lines, see `groupByArea`.
+func groupThings(things []sync.Thing, stopLines [][]float64, maxDistance float64) []thingGroup {
+	grouped := make([]bool, len(things))
+	groups := make([]thingGroup, 0)
+	for _, attribute := range clusterAttributes {
+		byValue := make(map[string][]int)
+		values := make([]string, 0)
+		for i, thing := range things {
+			value := attribute.value(thing)
+			if grouped[i] || value == "" {
+				continue
+			}
+			if _, ok := byValue[value]; !ok {
+				values = append(values, value)
+			}
+			byValue[value] = append(byValue[value], i)
+		}
+		for _, value := range values {
+			indices := byValue[value]
+			if len(indices) < 2 {
+				continue
+			}
+			for _, i := range indices {
+				grouped[i] = true
+			}
+			groups = append(groups, thingGroup{kind: attribute.kind, key: value, indices: indices})
+		}
+	}
+	remaining := make([]int, 0)
+	for i := range things {
+		if !grouped[i] {
+			remaining = append(remaining, i)
+		}
+	}
+	return append(groups, groupByArea(things, stopLines, remaining, maxDistance)...)
+}
+
+// Group the given things by area. A thing joins the first area in which the stop lines of all things
+// lie within `maxDistance` of its own, which bounds the diameter of an area instead of chaining
+// close things across a whole district. Things without a stop line form their own group.
+func groupByArea(things []sync.Thing, stopLines [][]float64, indices []int, maxDistance float64) []thingGroup {
+	areas := make([]thingGroup, 0)
+	for _, i := range indices {
+		joined := false
+		for a := range areas {
+			if stopLines[i] == nil || maxDistance <= 0 {
+				break
+			}
+			near := true
+			for _, j := range areas[a].indices {
+				if stopLines[j] == nil || sync.Distance(stopLines[i], stopLines[j]) > maxDistance {
+					near = false
+					break
+				}
+			}
+			if near {
+				areas[a].indices = append(areas[a].indices, i)
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			areas = append(areas, thingGroup{kind: ClusterKindArea, key: things[i].Name, indices: []int{i}})
+		}
+	}
+	for a := range areas {
+		if len(areas[a].indices) == 1 {
+			areas[a].kind = ClusterKindThing
+		}
+	}
+	return areas
+}
+
+// Group the things with an unexpected outage by shared controller (`TrafficLightsID`), data connection
+// (`ConnectionID`) or owner (`OwnerThing`), and the remaining things by stop lines within `CLUSTER_DISTANCE` metres.
+// Things that are expected to be off are not clustered.
+func clusterOutages() OutageClusterReport {
+	maxDistance := env.Float("CLUSTER_DISTANCE", 50)
+	minSize := env.Int("CLUSTER_MIN_SIZE", 2)
+
+	healthByTopic := make(map[string]ThingHealth)
+	for _, health := range healthList() {
+		if health.Classification == ClassificationUnexpectedOutage {
+			healthByTopic[health.Topic] = health
+		}
+	}
+
+	// Collect the unhealthy things in a stable order.
+	sync.ThingsMutex.Lock()
+	things := make([]sync.Thing, 0, len(healthByTopic))
+	for topic := range healthByTopic {
+		if thing, ok := sync.Things[topic]; ok {
+			things = append(things, thing)
+		}
+	}
+	sync.ThingsMutex.Unlock()
+	sort.Slice(things, func(i, j int) bool {
+		return things[i].Name < things[j].Name
+	})
+	stopLines := make([][]float64, len(things))
+	for i, thing := range things {
+		if stopLine, err := thing.StopLine(); err == nil {
+			stopLines[i] = stopLine
+		}
+	}
+
+	// Describe each group of things as a cluster.
+	report := OutageClusterReport{
+		UpdateTime: clock.Now().Unix(),
+		Clusters:   make([]OutageCluster, 0),
+		Isolated:   make([]OutageCluster, 0),
+	}
+	for _, group := range groupThings(things, stopLines, maxDistance) {
+		healths := make([]ThingHealth, 0, len(group.indices))
+		cluster := OutageCluster{Kind: group.kind, Key: group.key, AffectedThings: make([]string, 0, len(group.indices))}
+		var latSum, lngSum float64
+		numLocated := 0
+		for _, i := range group.indices {
+			healths = append(healths, healthByTopic[things[i].Topic()])
+			cluster.AffectedThings = append(cluster.AffectedThings, things[i].Name)
+			if stopLines[i] != nil {
+				lngSum += stopLines[i][0]
+				latSum += stopLines[i][1]
+				numLocated++
+			}
+		}
+		sort.Strings(cluster.AffectedThings)
+		cluster.NumAffected = len(group.indices)
+		_, cluster.RootCause = mostCommonReason(healths)
+		if numLocated > 0 {
+			lat, lng := latSum/float64(numLocated), lngSum/float64(numLocated)
+			cluster.Lat, cluster.Lng = &lat, &lng
+		}
+		cluster.Id = cluster.Kind + ":" + cluster.Key
+		cluster.Message = fmt.Sprintf(clusterSubjects[cluster.Kind]+" down", cluster.Key)
+		if cluster.NumAffected > 1 {
+			cluster.Message += fmt.Sprintf(", %d signal groups affected", cluster.NumAffected)
+		}
+
+		if cluster.NumAffected >= minSize && cluster.NumAffected > 1 {
+			report.Clusters = append(report.Clusters, cluster)
+			report.NumClusteredThings += cluster.NumAffected
+		} else {
+			report.Isolated = append(report.Isolated, cluster)
+		}
+	}
+	for _, clusters := range [][]OutageCluster{report.Clusters, report.Isolated} {
+		sort.Slice(clusters, func(i, j int) bool {
+			if clusters[i].NumAffected != clusters[j].NumAffected {
+				return clusters[i].NumAffected > clusters[j].NumAffected
+			}
+			return clusters[i].Id < clusters[j].Id
+		})
+	}
+	return report
+}
+
+// Cluster the concurrent outages of the last monitor run and write them to json.
+func WriteOutageClusters() {
+	// Fetch the path under which we will save the json files.
+	staticPath := os.Getenv("STATIC_PATH")
+	if staticPath == "" {
+		panic("STATIC_PATH not set")
+	}
+
+	report := clusterOutages()
+	ClustersMutex.Lock()
+	Clusters = report
+	ClustersMutex.Unlock()
+
+	for _, cluster := range report.Clusters {
+		log.Warning.Printf("Outage cluster: %s (root cause: %s).\n", cluster.Message, cluster.RootCause)
+	}
+
+	reportJson, err := json.Marshal(report)
+	if err != nil {
+		log.Error.Println("Error marshalling outage clusters:", err)
+		return
+	}
+	ioutil.WriteFile(staticPath+"outage-clusters.json", reportJson, 0644)
+	PushFile(reportJson, "outage-clusters.json")
+}
+
+// Create Prometheus metrics with the number of outage events by kind, and the number of clusters and
+// clustered things by kind and root cause. The clusters themselves are not labelled, since their ids change with each outage.
+func clusterMetrics() []string {
+	ClustersMutex.Lock()
+	defer ClustersMutex.Unlock()
+	counts := make(map[string]int)
+	for _, clusters := range [][]OutageCluster{Clusters.Clusters, Clusters.Isolated} {
+		for _, cluster := range clusters {
+			counts[cluster.Kind]++
+		}
+	}
+	numClusters := make(map[[2]string]int)
+	numClusteredThings := make(map[[2]string]int)
+	labels := make([][2]string, 0)
+	for _, cluster := range Clusters.Clusters {
+		label := [2]string{cluster.Kind, cluster.RootCause}
+		if _, ok := numClusters[label]; !ok {
+			labels = append(labels, label)
+		}
+		numClusters[label]++
+		numClusteredThings[label] += cluster.NumAffected
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i][0] != labels[j][0] {
+			return labels[i][0] < labels[j][0]
+		}
+		return labels[i][1] < labels[j][1]
+	})
+	metrics := make([]string, 0, len(ClusterKinds)+2*len(labels))
+	for _, kind := range ClusterKinds {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_outage_events{kind=\"%s\"} %d", kind, counts[kind]))
+	}
+	for _, label := range labels {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_outage_clusters{kind=\"%s\",root_cause=\"%s\"} %d", label[0], label[1], numClusters[label]))
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_clustered_things{kind=\"%s\",root_cause=\"%s\"} %d", label[0], label[1], numClusteredThings[label]))
+	}
+	return metrics
+}
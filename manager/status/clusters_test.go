@@ -0,0 +1,128 @@
+package status
+
+import (
+	"monitor/sync"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Build an unhealthy thing with the given controller, connection and owner.
+func clusterThing(name string, controller string, connection string, owner string) sync.Thing {
+	var thing sync.Thing
+	thing.Name = name
+	thing.Properties.TrafficLightsID = controller
+	thing.Properties.ConnectionID = connection
+	thing.Properties.OwnerThing = owner
+	return thing
+}
+
+// Get a point the given number of metres east of a reference point in Hamburg.
+func metresEast(metres float64) []float64 {
+	// At 53.55°N, one degree of longitude is about 66.2km.
+	return []float64{10 + metres/66200, 53.55}
+}
+
+func TestGroupThings(t *testing.T) {
+	tests := []struct {
+		name      string
+		things    []sync.Thing
+		stopLines [][]float64
+		groups    []string
+	}{
+		{
+			"shared controller",
+			[]sync.Thing{clusterThing("1_1", "1", "", ""), clusterThing("1_2", "1", "", ""), clusterThing("2_1", "2", "", "")},
+			[][]float64{nil, nil, nil},
+			[]string{"controller:1 [1_1 1_2]", "thing:2_1 [2_1]"},
+		},
+		{
+			"controller before connection",
+			[]sync.Thing{clusterThing("1_1", "1", "a", ""), clusterThing("1_2", "1", "a", ""), clusterThing("2_1", "2", "a", ""), clusterThing("3_1", "3", "a", "")},
+			[][]float64{nil, nil, nil, nil},
+			[]string{"connection:a [2_1 3_1]", "controller:1 [1_1 1_2]"},
+		},
+		{
+			"no chaining via different attributes",
+			[]sync.Thing{clusterThing("1_1", "1", "a", "x"), clusterThing("1_2", "1", "", ""), clusterThing("2_1", "2", "b", "x"), clusterThing("3_1", "3", "b", "")},
+			[][]float64{nil, nil, nil, nil},
+			[]string{"connection:b [2_1 3_1]", "controller:1 [1_1 1_2]"},
+		},
+		{
+			"shared owner",
+			[]sync.Thing{clusterThing("1_1", "1", "", "x"), clusterThing("2_1", "2", "", "x"), clusterThing("3_1", "3", "", "y")},
+			[][]float64{nil, nil, nil},
+			[]string{"owner:x [1_1 2_1]", "thing:3_1 [3_1]"},
+		},
+		{
+			"close stop lines",
+			[]sync.Thing{clusterThing("1_1", "1", "", ""), clusterThing("2_1", "2", "", ""), clusterThing("3_1", "3", "", "")},
+			[][]float64{metresEast(0), metresEast(30), metresEast(500)},
+			[]string{"area:1_1 [1_1 2_1]", "thing:3_1 [3_1]"},
+		},
+		{
+			"bounded area diameter",
+			[]sync.Thing{clusterThing("1_1", "1", "", ""), clusterThing("2_1", "2", "", ""), clusterThing("3_1", "3", "", ""), clusterThing("4_1", "4", "", "")},
+			[][]float64{metresEast(0), metresEast(40), metresEast(80), metresEast(120)},
+			[]string{"area:1_1 [1_1 2_1]", "area:3_1 [3_1 4_1]"},
+		},
+		{
+			"things without stop lines",
+			[]sync.Thing{clusterThing("1_1", "1", "", ""), clusterThing("2_1", "2", "", "")},
+			[][]float64{nil, metresEast(0)},
+			[]string{"thing:1_1 [1_1]", "thing:2_1 [2_1]"},
+		},
+		{
+			"grouped things are not grouped by area",
+			[]sync.Thing{clusterThing("1_1", "1", "", ""), clusterThing("1_2", "1", "", ""), clusterThing("2_1", "2", "", "")},
+			[][]float64{metresEast(0), metresEast(10), metresEast(20)},
+			[]string{"controller:1 [1_1 1_2]", "thing:2_1 [2_1]"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups := make([]string, 0)
+			for _, group := range groupThings(test.things, test.stopLines, 50) {
+				names := make([]string, 0, len(group.indices))
+				for _, i := range group.indices {
+					names = append(names, test.things[i].Name)
+				}
+				sort.Strings(names)
+				groups = append(groups, group.kind+":"+group.key+" ["+strings.Join(names, " ")+"]")
+			}
+			sort.Strings(groups)
+			if !reflect.DeepEqual(groups, test.groups) {
+				t.Errorf("groupThings = %v, want %v", groups, test.groups)
+			}
+		})
+	}
+}
+
+func TestClusterMetrics(t *testing.T) {
+	ClustersMutex.Lock()
+	Clusters = OutageClusterReport{
+		Clusters: []OutageCluster{
+			{Id: "controller:1", Kind: ClusterKindController, RootCause: "upstream_data", NumAffected: 4},
+			{Id: "controller:2", Kind: ClusterKindController, RootCause: "upstream_data", NumAffected: 3},
+			{Id: "area:3_1", Kind: ClusterKindArea, RootCause: "prediction_service", NumAffected: 2},
+		},
+		Isolated: []OutageCluster{{Id: "thing:4_1", Kind: ClusterKindThing, NumAffected: 1}},
+	}
+	ClustersMutex.Unlock()
+
+	want := []string{
+		`prediction_monitor_outage_events{kind="controller"} 2`,
+		`prediction_monitor_outage_events{kind="connection"} 0`,
+		`prediction_monitor_outage_events{kind="owner"} 0`,
+		`prediction_monitor_outage_events{kind="area"} 1`,
+		`prediction_monitor_outage_events{kind="thing"} 1`,
+		`prediction_monitor_outage_clusters{kind="area",root_cause="prediction_service"} 1`,
+		`prediction_monitor_clustered_things{kind="area",root_cause="prediction_service"} 2`,
+		`prediction_monitor_outage_clusters{kind="controller",root_cause="upstream_data"} 2`,
+		`prediction_monitor_clustered_things{kind="controller",root_cause="upstream_data"} 7`,
+	}
+	if got := clusterMetrics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("clusterMetrics = %v, want %v", got, want)
+	}
+}
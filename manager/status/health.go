@@ -0,0 +1,144 @@
+package status
+
+import (
+	"monitor/clock"
+	"monitor/maintenance"
+	"monitor/predictions"
+	"monitor/sync"
+	"sort"
+	gosync "sync"
+)
+
+const (
+	// The thing has a fresh, usable prediction of good quality.
+	HealthOk = "ok"
+	// The thing never received a prediction.
+	HealthNoPrediction = "no_prediction"
+	// The last prediction of the thing is older than 3 minutes.
+	HealthStale = "stale"
+	// The forward horizon of the prediction is expired or too short.
+	HealthUnusable = "unusable"
+	// The prediction quality is 0.5 or below.
+	HealthBadQuality = "bad_quality"
+)
+
+// The health of a thing in a monitor run.
+type ThingHealth struct {
+	// The mqtt topic of the thing.
+	Topic string `json:"topic"`
+	// The name of the thing.
+	ThingName string `json:"thing_name"`
+	// The intersection of the thing.
+	Intersection string `json:"intersection"`
+	// The lane type of the thing, e.g. "Radfahrer".
+	LaneType string `json:"lane_type"`
+	// Whether the thing has a fresh, usable prediction of good quality.
+	Healthy bool `json:"healthy"`
+	// Why the thing is unhealthy, or "ok".
+	Reason string `json:"reason"`
+	// The quality of the fresh prediction, if there is one.
+	Quality *float64 `json:"quality"`
+	// Whether the state is "ok", "expected_off", an "unexpected_outage" compared to the baseline, or "maintenance".
+	Classification string `json:"classification"`
+	// The usual availability of the thing at this hour of the week, if enough runs were observed.
+	BaselineAvailability *float64 `json:"baseline_availability"`
+	// The usual prediction quality of the thing at this hour of the week, if enough predictions were observed.
+	BaselineQuality *float64 `json:"baseline_quality"`
+	// Whether the controller stopped sending data ("upstream_data"), the prediction service failed
+	// ("prediction_service") or the cause is "unknown". Empty if the thing is healthy.
+	RootCause string `json:"root_cause"`
+	// The unix time of the latest observation of the source datastreams, if there is one.
+	LastObservationTime *int64 `json:"last_observation_time"`
+	// The active maintenance window of the thing, if there is one.
+	Maintenance *maintenance.Window `json:"maintenance"`
+}
+
+// The health of each thing in the last monitor run, by topic.
+var Health = make(map[string]ThingHealth)
+
+// A lock for the health map.
+var HealthMutex = &gosync.Mutex{}
+
+// Evaluate the health of each thing, such that all outputs of a monitor run share the same view.
+func EvaluateHealth() {
+	// Lock resources.
+	sync.ThingsMutex.Lock()
+	predictions.CurrentMutex.Lock()
+	predictions.TimestampsMutex.Lock()
+
+	now := clock.Now().Unix()
+	health := make(map[string]ThingHealth, len(sync.Things))
+	datastreams := make(map[string][]sync.Datastream, len(sync.Things))
+	for topic, thing := range sync.Things {
+		datastreams[topic] = thing.SourceDatastreams()
+		thingHealth := ThingHealth{
+			Topic:        topic,
+			ThingName:    thing.Name,
+			Intersection: thing.Intersection(),
+			LaneType:     thing.Properties.LaneType,
+			Reason:       HealthOk,
+			Maintenance:  maintenance.Active(thing, clock.Now()),
+		}
+		prediction, predictionOk := predictions.Current[topic]
+		timestamp, timestampOk := predictions.Timestamps[topic]
+		if !predictionOk || !timestampOk {
+			thingHealth.Reason = HealthNoPrediction
+		} else if now-timestamp > 3*60 {
+			thingHealth.Reason = HealthStale
+		} else if _, horizonState := prediction.HorizonState(timestamp, now); horizonState != predictions.HorizonOk {
+			thingHealth.Reason = HealthUnusable
+			// Count the unusable prediction regardless of how the thing is classified afterwards.
+			countUnusable(topic)
+		} else if prediction.PredictionQuality <= 0.5 {
+			thingHealth.Reason = HealthBadQuality
+		}
+		if predictionOk && timestampOk && now-timestamp <= 3*60 {
+			quality := prediction.PredictionQuality
+			thingHealth.Quality = &quality
+		}
+		thingHealth.Healthy = thingHealth.Reason == HealthOk
+		health[topic] = thingHealth
+	}
+
+	predictions.TimestampsMutex.Unlock()
+	predictions.CurrentMutex.Unlock()
+	sync.ThingsMutex.Unlock()
+
+	// Compare the health with the usual health at this hour of the week.
+	classifyHealth(health, clock.Now())
+
+	// Tell whether the controller or the prediction service failed.
+	for topic, thingHealth := range health {
+		thingHealth.LastObservationTime = lastObservation(datastreams[topic])
+		if !thingHealth.Healthy && thingHealth.Maintenance == nil {
+			thingHealth.RootCause = rootCause(datastreams[topic], clock.Now())
+		}
+		health[topic] = thingHealth
+	}
+
+	HealthMutex.Lock()
+	Health = health
+	HealthMutex.Unlock()
+}
+
+// Get the health of the thing with the given topic in the last monitor run.
+func GetHealth(topic string) (ThingHealth, bool) {
+	HealthMutex.Lock()
+	defer HealthMutex.Unlock()
+	health, ok := Health[topic]
+	return health, ok
+}
+
+// Get the health of all things in the last monitor run, sorted by topic.
+func healthList() []ThingHealth {
+	HealthMutex.Lock()
+	defer HealthMutex.Unlock()
+	list := make([]ThingHealth, 0, len(Health))
+	for _, health := range Health {
+		list = append(list, health)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Topic < list[j].Topic
+	})
+	return list
+}
@@ -0,0 +1,74 @@
+package status
+
+import (
+	"monitor/clock"
+	"monitor/predictions"
+	"monitor/sync"
+	"testing"
+)
+
+// Replace the things and the current predictions for a test.
+func setPredictions(t *testing.T, things []sync.Thing, current map[string]predictions.Prediction, timestamps map[string]int64) {
+	t.Helper()
+	sync.ThingsMutex.Lock()
+	sync.Things = make(map[string]sync.Thing)
+	for _, thing := range things {
+		sync.Things[thing.Topic()] = thing
+	}
+	sync.ThingsMutex.Unlock()
+	predictions.CurrentMutex.Lock()
+	predictions.TimestampsMutex.Lock()
+	predictions.Current = current
+	predictions.Timestamps = timestamps
+	predictions.TimestampsMutex.Unlock()
+	predictions.CurrentMutex.Unlock()
+}
+
+func TestEvaluateHealth(t *testing.T) {
+	now := clock.Now().Unix()
+	things := []sync.Thing{{Name: "1_1"}, {Name: "1_2"}, {Name: "1_3"}, {Name: "1_4"}, {Name: "1_5"}}
+	current := map[string]predictions.Prediction{
+		"hamburg/1_1": {PredictionQuality: 0.9, Value: make([]int64, 300)},
+		"hamburg/1_2": {PredictionQuality: 0.9, Value: make([]int64, 300)},
+		"hamburg/1_3": {PredictionQuality: 0.9, Value: make([]int64, 10)},
+		"hamburg/1_4": {PredictionQuality: 0.4, Value: make([]int64, 300)},
+	}
+	timestamps := map[string]int64{
+		"hamburg/1_1": now,
+		"hamburg/1_2": now - 4*60,
+		"hamburg/1_3": now,
+		"hamburg/1_4": now,
+	}
+	setPredictions(t, things, current, timestamps)
+
+	before := getUnusableCount("hamburg/1_3")
+	EvaluateHealth()
+
+	expected := map[string]string{
+		"hamburg/1_1": HealthOk,
+		"hamburg/1_2": HealthStale,
+		"hamburg/1_3": HealthUnusable,
+		"hamburg/1_4": HealthBadQuality,
+		"hamburg/1_5": HealthNoPrediction,
+	}
+	for topic, reason := range expected {
+		health, ok := GetHealth(topic)
+		if !ok {
+			t.Errorf("No health for %s", topic)
+			continue
+		}
+		if health.Reason != reason || health.Healthy != (reason == HealthOk) {
+			t.Errorf("Health of %s = %s (healthy %v), want %s", topic, health.Reason, health.Healthy, reason)
+		}
+		if health.Intersection != "1" {
+			t.Errorf("Intersection of %s = %s, want 1", topic, health.Intersection)
+		}
+	}
+	// The unusable prediction is counted once per evaluation, independently of the summary.
+	if got := getUnusableCount("hamburg/1_3"); got != before+1 {
+		t.Errorf("Unusable count = %d, want %d", got, before+1)
+	}
+	if got := getUnusableCount("hamburg/1_2"); got != 0 {
+		t.Errorf("Unusable count of a stale prediction = %d, want 0", got)
+	}
+}
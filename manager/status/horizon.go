@@ -0,0 +1,50 @@
+package status
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A map that counts for each mqtt topic in how many monitor runs the prediction was unusable
+// because its forward horizon was expired or too short.
+var unusableCounts = make(map[string]int)
+
+// A lock for the unusable counts map.
+var unusableCountsMutex = &sync.Mutex{}
+
+// Drop the unusable count of a topic whose prediction state was evicted.
+func forgetUnusable(topic string) {
+	unusableCountsMutex.Lock()
+	defer unusableCountsMutex.Unlock()
+	delete(unusableCounts, topic)
+}
+
+// Increment the number of monitor runs in which the fresh prediction of the topic was unusable.
+// This is counted once per monitor run, when the health is evaluated.
+func countUnusable(topic string) {
+	unusableCountsMutex.Lock()
+	defer unusableCountsMutex.Unlock()
+	unusableCounts[topic]++
+}
+
+// Get the number of monitor runs in which the prediction of the topic was unusable.
+func getUnusableCount(topic string) int {
+	unusableCountsMutex.Lock()
+	defer unusableCountsMutex.Unlock()
+	return unusableCounts[topic]
+}
+
+// Create Prometheus metrics with the total number of unusable predictions and the number of topics
+// with unusable predictions. The counts of each topic are published in the per-traffic-light status.
+func unusableMetrics() []string {
+	unusableCountsMutex.Lock()
+	defer unusableCountsMutex.Unlock()
+	total := 0
+	for _, count := range unusableCounts {
+		total += count
+	}
+	return []string{
+		fmt.Sprintf("prediction_monitor_unusable_predictions_total %d", total),
+		fmt.Sprintf("prediction_monitor_things_with_unusable_predictions %d", len(unusableCounts)),
+	}
+}
@@ -0,0 +1,431 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/clock"
+	"monitor/data"
+	"monitor/env"
+	"monitor/log"
+	"os"
+	"sort"
+	gosync "sync"
+	"time"
+)
+
+const (
+	// A single thing is unhealthy.
+	IncidentScopeThing = "thing"
+	// Most things of an intersection are unhealthy.
+	IncidentScopeIntersection = "intersection"
+	// Most things of the whole system are unhealthy.
+	IncidentScopeSystem = "system"
+)
+
+// All incident scopes.
+var IncidentScopes = []string{IncidentScopeThing, IncidentScopeIntersection, IncidentScopeSystem}
+
+// An outage of a thing, an intersection or the whole system.
+type Incident struct {
+	// A unique id of the incident.
+	Id string `json:"id"`
+	// Whether a "thing", an "intersection" or the "system" is affected.
+	Scope string `json:"scope"`
+	// The topic of the thing, the id of the intersection, or "system".
+	Subject string `json:"subject"`
+	// The unix time at which the incident was opened.
+	Start int64 `json:"start"`
+	// The unix time at which the incident was closed, if it is closed.
+	End *int64 `json:"end"`
+	// The duration of the incident in seconds, up to now if it is still open.
+	Duration int64 `json:"duration"`
+	// The health reason of the affected things when the incident was last updated, e.g. "stale".
+	Reason string `json:"reason"`
+	// The most common root cause of the affected things when the incident was last updated, e.g. "upstream_data".
+	RootCause string `json:"root_cause"`
+	// The names of all things that were unhealthy during the incident.
+	AffectedThings []string `json:"affected_things"`
+}
+
+// The outage statistics of a subject over the retained incidents.
+type OutageStats struct {
+	// Whether the subject is a "thing", an "intersection" or the "system".
+	Scope string `json:"scope"`
+	// The topic of the thing, the id of the intersection, or "system".
+	Subject string `json:"subject"`
+	// The number of incidents, including an open one.
+	NumOutages int `json:"num_outages"`
+	// The mean time to recovery of the closed incidents in seconds, if there are any.
+	Mttr *float64 `json:"mttr"`
+	// The total duration of the incidents in seconds.
+	Downtime int64 `json:"downtime"`
+}
+
+// The incidents that are published as json.
+type IncidentReport struct {
+	// The time of the report.
+	UpdateTime int64 `json:"update_time"`
+	// The incidents that are still open.
+	Open []Incident `json:"open"`
+	// The incidents that were closed within `INCIDENT_RECENT`.
+	RecentlyClosed []Incident `json:"recently_closed"`
+	// The mean time to recovery of the retained closed incidents in seconds, by scope.
+	Mttr map[string]*float64 `json:"mttr"`
+	// The number of retained incidents, by scope.
+	NumOutages map[string]int `json:"num_outages"`
+	// The outage statistics of each subject with at least one retained incident.
+	Outages []OutageStats `json:"outages"`
+}
+
+// All open incidents and the closed incidents within `INCIDENT_RETENTION`, oldest first.
+var incidents = make([]*Incident, 0)
+
+// Whether the persisted incidents were loaded.
+var incidentsLoaded = false
+
+// The time of the first incident update, i.e. the start of the monitor.
+var incidentsStarted time.Time
+
+// How long after the start no incidents are opened, such that things whose predictions
+// were not received yet don't open incidents on each restart.
+var incidentStartupGrace = env.Duration("INCIDENT_STARTUP_GRACE", 5*time.Minute)
+
+// The share of unhealthy things at which an intersection is unhealthy.
+var incidentIntersectionShare = env.Float("INCIDENT_INTERSECTION_SHARE", 1)
+
+// The share of unhealthy things at which the system is unhealthy.
+var incidentSystemShare = env.Float("INCIDENT_SYSTEM_SHARE", 0.5)
+
+// How long closed incidents are kept.
+var incidentRetention = env.Duration("INCIDENT_RETENTION", 30*24*time.Hour)
+
+// How long closed incidents are listed as recently closed.
+var incidentRecent = env.Duration("INCIDENT_RECENT", 24*time.Hour)
+
+// A lock for the incidents.
+var incidentsMutex = &gosync.Mutex{}
+
+// The file under `DATA_PATH` in which the incidents are persisted.
+const incidentsFile = "incidents.json"
+
+// Get the subjects that are currently unhealthy, by scope and subject, with the names of the unhealthy things.
+// An intersection or the system is unhealthy if the share of its unhealthy things reaches
+// `INCIDENT_INTERSECTION_SHARE` or `INCIDENT_SYSTEM_SHARE`. Things in maintenance and things
+// that are expected to be off, e.g. traffic lights switched off at night, are left out.
+func unhealthySubjects() map[string]map[string][]ThingHealth {
+	unhealthy := map[string]map[string][]ThingHealth{
+		IncidentScopeThing:        {},
+		IncidentScopeIntersection: {},
+		IncidentScopeSystem:       {},
+	}
+	numThings := 0
+	numByIntersection := make(map[string]int)
+	unhealthyByIntersection := make(map[string][]ThingHealth)
+	unhealthyThings := make([]ThingHealth, 0)
+	for _, health := range healthList() {
+		if health.Maintenance != nil || health.Classification == ClassificationExpectedOff {
+			continue
+		}
+		numThings++
+		numByIntersection[health.Intersection]++
+		if health.Healthy {
+			continue
+		}
+		unhealthy[IncidentScopeThing][health.Topic] = []ThingHealth{health}
+		unhealthyByIntersection[health.Intersection] = append(unhealthyByIntersection[health.Intersection], health)
+		unhealthyThings = append(unhealthyThings, health)
+	}
+	for intersection, things := range unhealthyByIntersection {
+		if float64(len(things)) >= incidentIntersectionShare*float64(numByIntersection[intersection]) {
+			unhealthy[IncidentScopeIntersection][intersection] = things
+		}
+	}
+	if numThings > 0 && float64(len(unhealthyThings)) >= incidentSystemShare*float64(numThings) {
+		unhealthy[IncidentScopeSystem][IncidentScopeSystem] = unhealthyThings
+	}
+	return unhealthy
+}
+
+// Get the most common health reason and root cause of the given things.
+func mostCommonReason(things []ThingHealth) (string, string) {
+	reasons := make([]string, 0, len(things))
+	rootCauses := make([]string, 0, len(things))
+	for _, thing := range things {
+		reasons = append(reasons, thing.Reason)
+		rootCauses = append(rootCauses, thing.RootCause)
+	}
+	return mostCommon(reasons), mostCommon(rootCauses)
+}
+
+// Get the most common value, preferring the smallest value on a tie.
+func mostCommon(values []string) string {
+	counts := make(map[string]int)
+	result := ""
+	for _, value := range values {
+		counts[value]++
+		if result == "" || counts[value] > counts[result] ||
+			(counts[value] == counts[result] && value < result) {
+			result = value
+		}
+	}
+	return result
+}
+
+// Open an incident for each thing, intersection or the system that became unhealthy,
+// and close the incidents of subjects that recovered. Uses the health of the last monitor run.
+// Within `INCIDENT_STARTUP_GRACE` after the start, open incidents are updated but no new ones are opened.
+// The incidents are only persisted if they changed.
+func updateIncidents() {
+	incidentsMutex.Lock()
+	defer incidentsMutex.Unlock()
+
+	if !incidentsLoaded {
+		loaded := make([]*Incident, 0)
+		if data.Load(incidentsFile, &loaded) {
+			incidents = loaded
+			log.Info.Printf("Loaded %d incidents.\n", len(incidents))
+		}
+		incidentsLoaded = true
+		incidentsStarted = clock.Now()
+	}
+
+	now := clock.Now().Unix()
+	unhealthy := unhealthySubjects()
+	changed := false
+
+	// Update or close the open incidents.
+	open := make(map[string]*Incident)
+	for _, incident := range incidents {
+		if incident.End != nil {
+			continue
+		}
+		things, ok := unhealthy[incident.Scope][incident.Subject]
+		if !ok {
+			end := now
+			incident.End = &end
+			incident.Duration = end - incident.Start
+			log.Info.Printf("Closed %s incident of %s after %ds.\n", incident.Scope, incident.Subject, incident.Duration)
+			changed = true
+			continue
+		}
+		incident.Duration = now - incident.Start
+		reason, rootCause := mostCommonReason(things)
+		if reason != incident.Reason || rootCause != incident.RootCause {
+			incident.Reason, incident.RootCause = reason, rootCause
+			changed = true
+		}
+		for _, thing := range things {
+			if !containsString(incident.AffectedThings, thing.ThingName) {
+				incident.AffectedThings = append(incident.AffectedThings, thing.ThingName)
+				changed = true
+			}
+		}
+		sort.Strings(incident.AffectedThings)
+		open[incident.Scope+"/"+incident.Subject] = incident
+	}
+
+	// Open incidents for newly unhealthy subjects, once the startup grace period is over.
+	inGracePeriod := clock.Now().Before(incidentsStarted.Add(incidentStartupGrace))
+	for _, scope := range IncidentScopes {
+		if inGracePeriod {
+			break
+		}
+		subjects := make([]string, 0, len(unhealthy[scope]))
+		for subject := range unhealthy[scope] {
+			subjects = append(subjects, subject)
+		}
+		sort.Strings(subjects)
+		for _, subject := range subjects {
+			if _, ok := open[scope+"/"+subject]; ok {
+				continue
+			}
+			things := unhealthy[scope][subject]
+			incident := &Incident{
+				Id:             fmt.Sprintf("%s:%s:%d", scope, subject, now),
+				Scope:          scope,
+				Subject:        subject,
+				Start:          now,
+				AffectedThings: make([]string, 0, len(things)),
+			}
+			incident.Reason, incident.RootCause = mostCommonReason(things)
+			for _, thing := range things {
+				incident.AffectedThings = append(incident.AffectedThings, thing.ThingName)
+			}
+			sort.Strings(incident.AffectedThings)
+			incidents = append(incidents, incident)
+			changed = true
+			if scope != IncidentScopeThing {
+				log.Warning.Printf("Opened %s incident of %s with %d affected things.\n", scope, subject, len(things))
+			}
+		}
+	}
+
+	// Drop the closed incidents that are older than the retention.
+	retained := make([]*Incident, 0, len(incidents))
+	for _, incident := range incidents {
+		if incident.End != nil && now-*incident.End > int64(incidentRetention.Seconds()) {
+			changed = true
+			continue
+		}
+		retained = append(retained, incident)
+	}
+	incidents = retained
+
+	if changed {
+		data.Store(incidentsFile, incidents)
+	}
+}
+
+// Compute the outage statistics of each subject over the retained incidents, sorted by scope and subject.
+func outageStats() []OutageStats {
+	byKey := make(map[string]*OutageStats)
+	recovery := make(map[string]int64)
+	recovered := make(map[string]int)
+	for _, incident := range incidents {
+		key := incident.Scope + "/" + incident.Subject
+		stats, ok := byKey[key]
+		if !ok {
+			stats = &OutageStats{Scope: incident.Scope, Subject: incident.Subject}
+			byKey[key] = stats
+		}
+		stats.NumOutages++
+		stats.Downtime += incident.Duration
+		if incident.End != nil {
+			recovery[key] += incident.Duration
+			recovered[key]++
+		}
+	}
+	list := make([]OutageStats, 0, len(byKey))
+	for key, stats := range byKey {
+		if recovered[key] > 0 {
+			mttr := float64(recovery[key]) / float64(recovered[key])
+			stats.Mttr = &mttr
+		}
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Scope != list[j].Scope {
+			return list[i].Scope < list[j].Scope
+		}
+		return list[i].Subject < list[j].Subject
+	})
+	return list
+}
+
+// Compute the mean time to recovery and the number of retained incidents by scope.
+func incidentTotals() (map[string]*float64, map[string]int) {
+	mttr := make(map[string]*float64)
+	numOutages := make(map[string]int)
+	for _, scope := range IncidentScopes {
+		numOutages[scope] = 0
+	}
+	recovery := make(map[string]int64)
+	recovered := make(map[string]int)
+	for _, incident := range incidents {
+		numOutages[incident.Scope]++
+		if incident.End != nil {
+			recovery[incident.Scope] += incident.Duration
+			recovered[incident.Scope]++
+		}
+	}
+	for _, scope := range IncidentScopes {
+		mttr[scope] = nil
+		if recovered[scope] > 0 {
+			value := float64(recovery[scope]) / float64(recovered[scope])
+			mttr[scope] = &value
+		}
+	}
+	return mttr, numOutages
+}
+
+// Update the incidents and write the open and recently closed incidents to json.
+func WriteIncidents() {
+	// Fetch the path under which we will save the json files.
+	staticPath := os.Getenv("STATIC_PATH")
+	if staticPath == "" {
+		panic("STATIC_PATH not set")
+	}
+
+	updateIncidents()
+
+	incidentsMutex.Lock()
+	now := clock.Now().Unix()
+	report := IncidentReport{
+		UpdateTime:     now,
+		Open:           make([]Incident, 0),
+		RecentlyClosed: make([]Incident, 0),
+		Outages:        outageStats(),
+	}
+	report.Mttr, report.NumOutages = incidentTotals()
+	for _, incident := range incidents {
+		if incident.End == nil {
+			report.Open = append(report.Open, *incident)
+		} else if now-*incident.End <= int64(incidentRecent.Seconds()) {
+			report.RecentlyClosed = append(report.RecentlyClosed, *incident)
+		}
+	}
+	incidentsMutex.Unlock()
+
+	reportJson, err := json.Marshal(report)
+	if err != nil {
+		log.Error.Println("Error marshalling incidents:", err)
+		return
+	}
+	ioutil.WriteFile(staticPath+"incidents.json", reportJson, 0644)
+	PushFile(reportJson, "incidents.json")
+}
+
+// Get the outage statistics of each thing over the retained incidents, by topic.
+func thingOutageStats() map[string]OutageStats {
+	incidentsMutex.Lock()
+	defer incidentsMutex.Unlock()
+	byTopic := make(map[string]OutageStats)
+	for _, stats := range outageStats() {
+		if stats.Scope == IncidentScopeThing {
+			byTopic[stats.Subject] = stats
+		}
+	}
+	return byTopic
+}
+
+// Create Prometheus metrics with the open incidents, the mean time to recovery and the outage counts.
+func incidentMetrics() []string {
+	incidentsMutex.Lock()
+	defer incidentsMutex.Unlock()
+
+	numOpen := make(map[string]int)
+	for _, incident := range incidents {
+		if incident.End == nil {
+			numOpen[incident.Scope]++
+		}
+	}
+	mttr, numOutages := incidentTotals()
+	metrics := make([]string, 0)
+	for _, scope := range IncidentScopes {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_open_incidents{scope=\"%s\"} %d", scope, numOpen[scope]))
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_incidents{scope=\"%s\"} %d", scope, numOutages[scope]))
+		if mttr[scope] != nil {
+			metrics = append(metrics, fmt.Sprintf("prediction_monitor_mttr_seconds{scope=\"%s\"} %f", scope, *mttr[scope]))
+		}
+	}
+	// The outages of each thing are published in `incidents.json`, here only the number of affected things.
+	numThingsWithOutages := 0
+	for _, stats := range outageStats() {
+		if stats.Scope == IncidentScopeThing {
+			numThingsWithOutages++
+		}
+	}
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_things_with_outages %d", numThingsWithOutages))
+	return metrics
+}
+
+// Check whether a list of strings contains a value.
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package status
+
+import (
+	"monitor/clock"
+	"os"
+	"testing"
+	"time"
+)
+
+// Replace the health of the last monitor run for a test.
+func setHealth(things []ThingHealth) {
+	HealthMutex.Lock()
+	defer HealthMutex.Unlock()
+	Health = make(map[string]ThingHealth)
+	for _, thing := range things {
+		Health[thing.Topic] = thing
+	}
+}
+
+// Reset the incidents, as if the monitor was started at the given time.
+func resetIncidents(started time.Time, loaded []*Incident) {
+	incidentsMutex.Lock()
+	defer incidentsMutex.Unlock()
+	incidents = loaded
+	incidentsLoaded = true
+	incidentsStarted = started
+}
+
+// Count the open incidents by scope.
+func openIncidents() map[string]int {
+	incidentsMutex.Lock()
+	defer incidentsMutex.Unlock()
+	open := make(map[string]int)
+	for _, incident := range incidents {
+		if incident.End == nil {
+			open[incident.Scope]++
+		}
+	}
+	return open
+}
+
+func TestUpdateIncidents(t *testing.T) {
+	healthy := func(name string) ThingHealth {
+		return ThingHealth{Topic: "hamburg/" + name, ThingName: name, Intersection: "1", Healthy: true, Reason: HealthOk}
+	}
+	unhealthy := func(name string) ThingHealth {
+		return ThingHealth{Topic: "hamburg/" + name, ThingName: name, Intersection: "1", Reason: HealthNoPrediction}
+	}
+	expectedOff := func(name string) ThingHealth {
+		health := unhealthy(name)
+		health.Classification = ClassificationExpectedOff
+		return health
+	}
+	now := clock.Now()
+	openBeforeRestart := func() []*Incident {
+		return []*Incident{{Id: "thing:hamburg/1_1:1", Scope: IncidentScopeThing, Subject: "hamburg/1_1", Start: now.Add(-time.Hour).Unix(),
+			Reason: HealthNoPrediction, AffectedThings: []string{"1_1"}}}
+	}
+
+	tests := []struct {
+		name     string
+		started  time.Time
+		loaded   []*Incident
+		health   []ThingHealth
+		open     map[string]int
+		persists bool
+	}{
+		{"all unhealthy after the start", now, []*Incident{}, []ThingHealth{unhealthy("1_1"), unhealthy("1_2")},
+			map[string]int{}, false},
+		{"all unhealthy after the grace period", now.Add(-10 * time.Minute), []*Incident{}, []ThingHealth{unhealthy("1_1"), unhealthy("1_2")},
+			map[string]int{IncidentScopeThing: 2, IncidentScopeIntersection: 1, IncidentScopeSystem: 1}, true},
+		{"part of an intersection after the grace period", now.Add(-10 * time.Minute), []*Incident{}, []ThingHealth{unhealthy("1_1"), healthy("1_2"), healthy("1_3")},
+			map[string]int{IncidentScopeThing: 1}, true},
+		{"incident from before the restart stays open", now, openBeforeRestart(), []ThingHealth{unhealthy("1_1"), healthy("1_2"), healthy("1_3")},
+			map[string]int{IncidentScopeThing: 1}, false},
+		{"incident from before the restart is closed", now, openBeforeRestart(), []ThingHealth{healthy("1_1")},
+			map[string]int{}, true},
+		{"all healthy", now.Add(-10 * time.Minute), []*Incident{}, []ThingHealth{healthy("1_1")},
+			map[string]int{}, false},
+		{"all expected off", now.Add(-10 * time.Minute), []*Incident{}, []ThingHealth{expectedOff("1_1"), expectedOff("1_2")},
+			map[string]int{}, false},
+		{"expected off things are left out of the shares", now.Add(-10 * time.Minute), []*Incident{},
+			[]ThingHealth{unhealthy("1_1"), expectedOff("1_2"), expectedOff("1_3")},
+			map[string]int{IncidentScopeThing: 1, IncidentScopeIntersection: 1, IncidentScopeSystem: 1}, true},
+		{"incident is closed when the thing is expected off", now, openBeforeRestart(), []ThingHealth{expectedOff("1_1")},
+			map[string]int{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataPath := t.TempDir() + "/"
+			t.Setenv("DATA_PATH", dataPath)
+			resetIncidents(test.started, test.loaded)
+			setHealth(test.health)
+
+			updateIncidents()
+
+			open := openIncidents()
+			for _, scope := range IncidentScopes {
+				if open[scope] != test.open[scope] {
+					t.Errorf("Open %s incidents = %d, want %d", scope, open[scope], test.open[scope])
+				}
+			}
+			_, err := os.Stat(dataPath + incidentsFile)
+			if persisted := err == nil; persisted != test.persists {
+				t.Errorf("Persisted = %v, want %v", persisted, test.persists)
+			}
+		})
+	}
+}
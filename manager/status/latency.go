@@ -0,0 +1,35 @@
+package status
+
+import (
+	"fmt"
+	"monitor/predictions"
+)
+
+// Create Prometheus metrics with the overall latency and skew distributions
+// and the number of predictions with timestamps in the future.
+func latencyMetrics() []string {
+	latency, skew := predictions.OverallLatency()
+	metrics := make([]string, 0)
+	names := []string{"prediction_monitor_latency_seconds", "prediction_monitor_skew_seconds"}
+	for i, distribution := range []predictions.Distribution{latency, skew} {
+		name := names[i]
+		metrics = append(metrics, fmt.Sprintf("%s{quantile=\"0\"} %v", name, distribution.Min))
+		metrics = append(metrics, fmt.Sprintf("%s{quantile=\"0.5\"} %v", name, distribution.Median))
+		metrics = append(metrics, fmt.Sprintf("%s{quantile=\"0.95\"} %v", name, distribution.P95))
+		metrics = append(metrics, fmt.Sprintf("%s{quantile=\"1\"} %v", name, distribution.Max))
+		metrics = append(metrics, fmt.Sprintf("%s_count %d", name, distribution.Count))
+	}
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_future_predictions %d", predictions.CountFuturePredictions()))
+	return metrics
+}
+
+// Create Prometheus metrics with the number of parse failures by the failing part.
+func parseFailureMetrics() []string {
+	totals, numTopics := predictions.TotalParseFailures()
+	metrics := make([]string, 0, len(predictions.ParseFailureTypes)+1)
+	for _, failureType := range predictions.ParseFailureTypes {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_parse_failures_total{part=\"%s\"} %d", failureType, totals[failureType]))
+	}
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_topics_with_parse_failures %d", numTopics))
+	return metrics
+}
@@ -3,11 +3,12 @@ package status
 import (
 	"fmt"
 	"io/ioutil"
+	"monitor/annotations"
+	"monitor/clock"
 	"monitor/log"
 	"monitor/predictions"
 	"monitor/sync"
 	"os"
-	"time"
 
 	geojson "github.com/paulmach/go.geojson"
 )
@@ -21,6 +22,9 @@ func WriteGeoJSONMap() {
 		panic("STATIC_PATH not set")
 	}
 
+	// Measure the size of the prediction state before its maps are locked.
+	memoryMetrics := predictions.MemoryMetrics()
+
 	// Lock resources.
 	sync.ThingsMutex.Lock()
 	defer sync.ThingsMutex.Unlock()
@@ -32,6 +36,7 @@ func WriteGeoJSONMap() {
 	// Write the geojson to the file.
 	locationFeatureCollection := geojson.NewFeatureCollection() // Locations of traffic lights.
 	laneFeatureCollection := geojson.NewFeatureCollection()     // Lanes of traffic lights.
+	lanePartFeatureCollection := geojson.NewFeatureCollection() // Ingress, connection and egress lanes.
 
 	// Create another list that will contain Prometheus metrics for each thing.
 	// In this way we can visualize the metrics in Grafana, on a map.
@@ -43,7 +48,11 @@ func WriteGeoJSONMap() {
 			log.Warning.Printf("Error getting lane for thing %s: %v\n", thing.Name, err)
 			continue
 		}
-		coordinate := lane[0]
+		// Place the traffic light at its stop line, i.e. the end of the ingress lane.
+		coordinate, err := thing.StopLine()
+		if err != nil {
+			coordinate = lane[0]
+		}
 		lat, lng := coordinate[1], coordinate[0]
 
 		// Check if there is a prediction for this thing.
@@ -55,43 +64,121 @@ func WriteGeoJSONMap() {
 		if predictionOk && predictionTimeOk {
 			properties["prediction_available"] = true
 			properties["prediction_quality"] = prediction.PredictionQuality
-			properties["prediction_time_diff"] = time.Now().Unix() - predictionTime
+			properties["prediction_time_diff"] = clock.Now().Unix() - predictionTime
 			properties["prediction_sg_id"] = prediction.SignalGroupId
+			insights := prediction.Analyse(predictionTime, clock.Now().Unix())
+			properties["prediction_has_green"] = insights.HasGreen
+			properties["prediction_next_green_start"] = insights.NextGreenStart
+			properties["prediction_next_green_end"] = insights.NextGreenEnd
+			properties["prediction_green_share"] = insights.GreenShare
+			properties["prediction_cycle_length"] = insights.CycleLength
+			horizon, horizonState := prediction.HorizonState(predictionTime, clock.Now().Unix())
+			properties["prediction_horizon"] = horizon
+			properties["prediction_horizon_state"] = horizonState
+			properties["prediction_usable"] = horizonState == predictions.HorizonOk
 		} else {
 			properties["prediction_available"] = false
 			properties["prediction_quality"] = -1
 			properties["prediction_time_diff"] = 0
 			properties["prediction_sg_id"] = ""
+			properties["prediction_has_green"] = false
+			properties["prediction_next_green_start"] = nil
+			properties["prediction_next_green_end"] = nil
+			properties["prediction_green_share"] = 0
+			properties["prediction_cycle_length"] = nil
+			properties["prediction_horizon"] = nil
+			properties["prediction_horizon_state"] = nil
+			properties["prediction_usable"] = false
+		}
+		properties["prediction_anomalies"] = predictions.Anomalies(thing.Topic())
+		cadence, _ := predictions.GetCadence(thing.Topic(), clock.Now())
+		properties["prediction_silent"] = cadence.Silent
+		timing, _ := predictions.GetTiming(thing.Topic())
+		properties["prediction_in_future"] = timing.InFuture
+		if timing.Timestamp != nil {
+			properties["prediction_latency"] = timing.ReceivedAt.Sub(*timing.Timestamp).Seconds()
+		} else {
+			properties["prediction_latency"] = nil
+		}
+		health, healthOk := GetHealth(thing.Topic())
+		severity, message, _ := riderMessage(thing.Properties.Language, health, healthOk)
+		properties["status_severity"] = severity
+		properties["status_message"] = message
+		properties["prediction_classification"] = health.Classification
+		properties["baseline_availability"] = health.BaselineAvailability
+		properties["baseline_quality"] = health.BaselineQuality
+		if health.RootCause != "" {
+			properties["prediction_root_cause"] = health.RootCause
+		} else {
+			properties["prediction_root_cause"] = nil
+		}
+		properties["maintenance"] = health.Maintenance != nil
+		if health.Maintenance != nil {
+			properties["maintenance_id"] = health.Maintenance.Id
+			properties["maintenance_description"] = health.Maintenance.Description
+		} else {
+			properties["maintenance_id"] = nil
+			properties["maintenance_description"] = nil
+		}
+		if notes := annotations.For(thing, clock.Now()); len(notes) > 0 {
+			properties["annotation_id"] = notes[0].Id
+			properties["annotation"] = notes[0].TextIn(thing.Properties.Language)
+		} else {
+			properties["annotation_id"] = nil
+			properties["annotation"] = nil
 		}
 		// Add thing-related properties.
 		properties["thing_name"] = thing.Name
+		// Deprecated: kept for existing map consumers, use `thing_properties_lane_type` instead.
 		properties["thing_properties_lanetype"] = thing.Properties.LaneType
+		for name, value := range thing.Metadata() {
+			properties["thing_properties_"+name] = value
+		}
 
 		// Make a point feature.
 		location := geojson.NewPointFeature([]float64{lng, lat})
 		location.Properties = properties
+		if bearing, ok := thing.ApproachBearing(); ok {
+			location.Properties = withProperty(properties, "approach_bearing", bearing)
+		}
 		locationFeatureCollection.AddFeature(location)
 
 		// Make a line feature.
 		laneFeature := geojson.NewLineStringFeature(lane)
-		laneFeature.Properties = properties
+		laneFeature.Properties = withProperty(properties, "lane_length", sync.Length(lane))
+		laneFeature.Properties["lane_bearing"] = sync.Bearing(lane[0], lane[len(lane)-1])
 		laneFeatureCollection.AddFeature(laneFeature)
 
+		// Make a typed line feature for each part of the lane.
+		for _, part := range thing.LaneParts() {
+			partFeature := geojson.NewLineStringFeature(part.Coordinates)
+			partFeature.Properties = withProperty(properties, "lane_part", part.Name)
+			partFeature.Properties["lane_length"] = sync.Length(part.Coordinates)
+			first, last := part.Coordinates[0], part.Coordinates[len(part.Coordinates)-1]
+			partFeature.Properties["lane_bearing"] = sync.Bearing(first, last)
+			lanePartFeatureCollection.AddFeature(partFeature)
+		}
+
 		// Make a prometheus metric containing all the properties.
 		metric := "prediction_monitor_prediction{"
 		metric += fmt.Sprintf("lat=\"%v\",lng=\"%v\",", lat, lng)
-		predictionNotTooOld := predictionTimeOk && time.Now().Unix()-predictionTime < 2*60 && time.Now().Unix()-predictionTime > 0
+		predictionNotTooOld := predictionTimeOk && clock.Now().Unix()-predictionTime < 2*60 && clock.Now().Unix()-predictionTime > 0
 		if predictionOk && predictionNotTooOld {
+			_, horizonState := prediction.HorizonState(predictionTime, clock.Now().Unix())
 			metric += fmt.Sprintf("prediction_available=\"%v\",", true)
+			metric += fmt.Sprintf("prediction_usable=\"%v\",", horizonState == predictions.HorizonOk)
 			metric += fmt.Sprintf("prediction_quality=\"%v\",", prediction.PredictionQuality)
-			metric += fmt.Sprintf("prediction_tdiff=\"%v\",", time.Now().Unix()-predictionTime)
+			metric += fmt.Sprintf("prediction_tdiff=\"%v\",", clock.Now().Unix()-predictionTime)
 			metric += fmt.Sprintf("prediction_sgid=\"%v\",", prediction.SignalGroupId)
 		} else {
 			metric += fmt.Sprintf("prediction_available=\"%v\",", false)
+			metric += fmt.Sprintf("prediction_usable=\"%v\",", false)
 			metric += fmt.Sprintf("prediction_quality=\"%v\",", -1)
 			metric += fmt.Sprintf("prediction_tdiff=\"%v\",", 0)
 			metric += fmt.Sprintf("prediction_sgid=\"%v\",", "")
 		}
+		metric += fmt.Sprintf("prediction_silent=\"%v\",", cadence.Silent)
+		metric += fmt.Sprintf("prediction_classification=\"%v\",", health.Classification)
 		metric += fmt.Sprintf("thing_name=\"%v\",", thing.Name)
 		metric += fmt.Sprintf("thing_lanetype=\"%v\",", thing.Properties.LaneType)
 		metric += "}"
@@ -103,6 +190,48 @@ func WriteGeoJSONMap() {
 		metrics = append(metrics, metric)
 	}
 
+	// Add the total number of unusable predictions.
+	metrics = append(metrics, unusableMetrics()...)
+
+	// Add the number of current and detected anomalies for each anomaly type.
+	metrics = append(metrics, anomalyMetrics()...)
+
+	// Add the overall latency and skew distributions.
+	metrics = append(metrics, latencyMetrics()...)
+
+	// Add the number of messages that could not be parsed.
+	metrics = append(metrics, parseFailureMetrics()...)
+
+	// Add the number of data quality issues in the thing catalogue.
+	metrics = append(metrics, qualityMetrics()...)
+
+	// Add the number of subscriptions and the traffic on topics of unknown things.
+	metrics = append(metrics, subscriptionMetrics()...)
+
+	// Add the counts of the reconciliation of things and topics.
+	metrics = append(metrics, reconciliationMetrics()...)
+
+	// Add the open incidents, the mean time to recovery and the outage counts.
+	metrics = append(metrics, incidentMetrics()...)
+
+	// Add the number of things by their classification relative to the baseline.
+	metrics = append(metrics, classificationMetrics()...)
+
+	// Add the number of unhealthy things by root cause.
+	metrics = append(metrics, rootCauseMetrics()...)
+
+	// Add the concurrent outages grouped by their likely common cause.
+	metrics = append(metrics, clusterMetrics()...)
+
+	// Add the availability of the current day and week.
+	metrics = append(metrics, availabilityMetrics()...)
+
+	// Add the size of the prediction state.
+	metrics = append(metrics, memoryMetrics...)
+
+	// Add the number of topics that are silent compared to their own cadence.
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_silent_topics %d", predictions.CountSilentTopics(clock.Now())))
+
 	locationsGeoJson, err := locationFeatureCollection.MarshalJSON()
 	if err != nil {
 		log.Error.Println("Error marshalling geojson:", err)
@@ -119,6 +248,14 @@ func WriteGeoJSONMap() {
 	ioutil.WriteFile(staticPath+"predictions-lanes.geojson", lanesGeoJson, 0644)
 	PushFile(lanesGeoJson, "predictions-lanes.geojson")
 
+	lanePartsGeoJson, err := lanePartFeatureCollection.MarshalJSON()
+	if err != nil {
+		log.Error.Println("Error marshalling geojson:", err)
+		return
+	}
+	ioutil.WriteFile(staticPath+"predictions-lane-parts.geojson", lanePartsGeoJson, 0644)
+	PushFile(lanePartsGeoJson, "predictions-lane-parts.geojson")
+
 	// Write the metrics to a file.
 	metricsString := ""
 	for _, metric := range metrics {
@@ -127,3 +264,13 @@ func WriteGeoJSONMap() {
 	// A txt file to directly display it in the browser without downloading it.
 	ioutil.WriteFile(staticPath+"metrics.txt", []byte(metricsString), 0644)
 }
+
+// Copy the properties and add another property, such that features can share common properties.
+func withProperty(properties map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(properties)+1)
+	for key, v := range properties {
+		copied[key] = v
+	}
+	copied[name] = value
+	return copied
+}
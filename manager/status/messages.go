@@ -0,0 +1,221 @@
+package status
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"io/ioutil"
+	"monitor/env"
+	"monitor/log"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"text/template"
+)
+
+const (
+	// The prediction can be used as usual.
+	SeverityOk = "ok"
+	// The prediction is missing, but that is expected, e.g. at night.
+	SeverityInfo = "info"
+	// The prediction is less reliable or missing for a planned reason.
+	SeverityWarning = "warning"
+	// The prediction is unexpectedly missing.
+	SeverityError = "error"
+)
+
+// The keys of the rider-facing messages with their severity.
+var messageSeverities = map[string]string{
+	"ok":            SeverityOk,
+	"bad_quality":   SeverityWarning,
+	"unavailable":   SeverityError,
+	"upstream_data": SeverityError,
+	"expected_off":  SeverityInfo,
+	"maintenance":   SeverityWarning,
+}
+
+// The translations of the rider-facing messages that are built into the binary, one file per language.
+//
+//go:embed messages/*.json
+var builtinMessages embed.FS
+
+// The translation of the rider-facing messages into a language.
+type messageLocale struct {
+	// The Go time format of the times in the messages, e.g. "02.01. 15:04".
+	TimeFormat string `json:"time_format"`
+	// The text/template of each message by key.
+	Messages map[string]string `json:"messages"`
+
+	// The parsed templates by key.
+	templates map[string]*template.Template
+}
+
+// The values that can be used in the message templates.
+type messageData struct {
+	// The local end time of the maintenance window, if the thing is in maintenance and the window ends.
+	Until string
+}
+
+// The translations by language, e.g. "de".
+var messageLocales map[string]*messageLocale
+
+// The language of the messages for things whose language has no translation.
+var messageDefaultLanguage = strings.ToLower(env.String("MESSAGE_DEFAULT_LANGUAGE", "de"))
+
+// The built-in languages that are used if neither the language of a thing nor the default language
+// has a message, e.g. if `MESSAGE_DEFAULT_LANGUAGE` names a language without translations.
+var messageFallbackLanguages = []string{"de", "en"}
+
+// A lock for the translations.
+var messageLocalesMutex = &gosync.Mutex{}
+
+// Add the translations in the given json files, overriding single messages of known languages.
+func readMessageLocales(locales map[string]*messageLocale, read func(name string) ([]byte, error), names []string) {
+	for _, name := range names {
+		if filepath.Ext(name) != ".json" {
+			continue
+		}
+		language := strings.ToLower(strings.TrimSuffix(filepath.Base(name), ".json"))
+		data, err := read(name)
+		if err != nil {
+			log.Warning.Printf("Could not read messages %s: %v\n", name, err)
+			continue
+		}
+		var loaded messageLocale
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			log.Warning.Printf("Could not parse messages %s: %v\n", name, err)
+			continue
+		}
+		locale, ok := locales[language]
+		if !ok {
+			locale = &messageLocale{Messages: make(map[string]string), templates: make(map[string]*template.Template)}
+			locales[language] = locale
+		}
+		if loaded.TimeFormat != "" {
+			locale.TimeFormat = loaded.TimeFormat
+		}
+		for key, text := range loaded.Messages {
+			parsed, err := template.New(key).Parse(text)
+			if err != nil {
+				log.Warning.Printf("Invalid message %s in %s: %v\n", key, name, err)
+				continue
+			}
+			locale.Messages[key] = text
+			locale.templates[key] = parsed
+		}
+	}
+}
+
+// Get the translations of the rider-facing messages. The built-in translations can be extended
+// and overridden with `<language>.json` files in the directory at `MESSAGES_PATH`.
+func getMessageLocales() map[string]*messageLocale {
+	messageLocalesMutex.Lock()
+	defer messageLocalesMutex.Unlock()
+	if messageLocales != nil {
+		return messageLocales
+	}
+	locales := make(map[string]*messageLocale)
+	entries, err := builtinMessages.ReadDir("messages")
+	if err != nil {
+		panic("could not read the built-in messages: " + err.Error())
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, "messages/"+entry.Name())
+	}
+	readMessageLocales(locales, builtinMessages.ReadFile, names)
+
+	if messagesPath := os.Getenv("MESSAGES_PATH"); messagesPath != "" {
+		entries, err := ioutil.ReadDir(messagesPath)
+		if err != nil {
+			log.Warning.Println("Could not read MESSAGES_PATH:", err)
+		} else {
+			names := make([]string, 0, len(entries))
+			for _, entry := range entries {
+				names = append(names, filepath.Join(messagesPath, entry.Name()))
+			}
+			readMessageLocales(locales, ioutil.ReadFile, names)
+		}
+	}
+	messageLocales = locales
+	return messageLocales
+}
+
+// Get the key of the rider-facing message that describes the health of a thing.
+// A healthy thing in maintenance gets the usual message, since its prediction is available.
+func messageKey(health ThingHealth, healthOk bool) string {
+	switch {
+	case !healthOk:
+		return "unavailable"
+	case health.Healthy:
+		return "ok"
+	case health.Maintenance != nil:
+		return "maintenance"
+	case health.Reason == HealthBadQuality:
+		return "bad_quality"
+	case health.Classification == ClassificationExpectedOff:
+		return "expected_off"
+	case health.RootCause == RootCauseUpstreamData:
+		return "upstream_data"
+	default:
+		return "unavailable"
+	}
+}
+
+// Render a message in a language. Falls back to `MESSAGE_DEFAULT_LANGUAGE` and then to the built-in
+// languages if the language has no such message or it can't be rendered. Returns the message and its language.
+func renderMessage(locales map[string]*messageLocale, language string, key string, health ThingHealth) (string, string) {
+	for _, candidate := range append([]string{language, messageDefaultLanguage}, messageFallbackLanguages...) {
+		locale, ok := locales[candidate]
+		if !ok || locale.templates[key] == nil {
+			continue
+		}
+		data := messageData{}
+		if health.Maintenance != nil && health.Maintenance.End != nil {
+			timeFormat := locale.TimeFormat
+			if timeFormat == "" {
+				timeFormat = "2006-01-02 15:04"
+			}
+			data.Until = health.Maintenance.End.In(availabilityLocation()).Format(timeFormat)
+		}
+		var message bytes.Buffer
+		if err := locale.templates[key].Execute(&message, data); err != nil {
+			log.Warning.Printf("Could not render message %s in %s: %v\n", key, candidate, err)
+			continue
+		}
+		return message.String(), candidate
+	}
+	log.Warning.Printf("No translation of message %s.\n", key)
+	return key, ""
+}
+
+// Pick the language of a thing among the available translations, e.g. "de" for "de-DE".
+// Falls back to `MESSAGE_DEFAULT_LANGUAGE`.
+func messageLanguage(locales map[string]*messageLocale, language string) string {
+	language = strings.ToLower(language)
+	if _, ok := locales[language]; ok {
+		return language
+	}
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		if _, ok := locales[language[:i]]; ok {
+			return language[:i]
+		}
+	}
+	return messageDefaultLanguage
+}
+
+// Get the severity and the rider-facing message about the health of a thing in the language of the thing,
+// and the message in all languages into which it is translated.
+func riderMessage(language string, health ThingHealth, healthOk bool) (string, string, map[string]string) {
+	locales := getMessageLocales()
+	key := messageKey(health, healthOk)
+	all := make(map[string]string, len(locales))
+	for available := range locales {
+		if message, rendered := renderMessage(locales, available, key, health); rendered == available {
+			all[available] = message
+		}
+	}
+	message, _ := renderMessage(locales, messageLanguage(locales, language), key, health)
+	return messageSeverities[key], message, all
+}
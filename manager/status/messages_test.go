@@ -0,0 +1,142 @@
+package status
+
+import (
+	"fmt"
+	"monitor/maintenance"
+	"testing"
+	"time"
+)
+
+// Create translations from in-memory files by name, e.g. `fr.json`.
+func testLocales(files map[string]string) map[string]*messageLocale {
+	locales := make(map[string]*messageLocale)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	readMessageLocales(locales, func(name string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", name)
+		}
+		return []byte(data), nil
+	}, names)
+	return locales
+}
+
+func TestBuiltinMessages(t *testing.T) {
+	end := time.Date(2023, 5, 1, 16, 0, 0, 0, time.UTC)
+	health := ThingHealth{Maintenance: &maintenance.Window{Id: "works", End: &end}}
+	locales := getMessageLocales()
+	for _, language := range messageFallbackLanguages {
+		for key := range messageSeverities {
+			message, rendered := renderMessage(locales, language, key, health)
+			if rendered != language || message == key || message == "" {
+				t.Errorf("Message %s in %s = %q rendered in %q", key, language, message, rendered)
+			}
+		}
+	}
+}
+
+func TestMessageKey(t *testing.T) {
+	window := &maintenance.Window{Id: "works"}
+	tests := []struct {
+		name     string
+		health   ThingHealth
+		healthOk bool
+		want     string
+	}{
+		{"not evaluated", ThingHealth{Healthy: true}, false, "unavailable"},
+		{"healthy", ThingHealth{Healthy: true, Reason: HealthOk}, true, "ok"},
+		{"healthy in maintenance", ThingHealth{Healthy: true, Reason: HealthOk, Maintenance: window}, true, "ok"},
+		{"unhealthy in maintenance", ThingHealth{Reason: HealthNoPrediction, Maintenance: window}, true, "maintenance"},
+		{"bad quality", ThingHealth{Reason: HealthBadQuality}, true, "bad_quality"},
+		{"expected off", ThingHealth{Reason: HealthNoPrediction, Classification: ClassificationExpectedOff}, true, "expected_off"},
+		{"upstream data", ThingHealth{Reason: HealthStale, RootCause: RootCauseUpstreamData}, true, "upstream_data"},
+		{"other outage", ThingHealth{Reason: HealthStale}, true, "unavailable"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := messageKey(test.health, test.healthOk); got != test.want {
+				t.Errorf("messageKey = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderMessage(t *testing.T) {
+	locales := testLocales(map[string]string{
+		"de.json": `{"messages": {"ok": "Prognose verfügbar", "maintenance": "Baustelle{{if .Until}} bis {{.Until}}{{end}}"}, "time_format": "02.01. 15:04"}`,
+		"en.json": `{"messages": {"ok": "Prediction available", "unavailable": "Prediction unavailable"}}`,
+		"fr.json": `{"messages": {"ok": "Prévision disponible", "maintenance": "Travaux {{.Missing}}"}}`,
+	})
+	end := time.Date(2023, 5, 1, 14, 0, 0, 0, time.UTC)
+	maintenanceHealth := ThingHealth{Maintenance: &maintenance.Window{Id: "works", End: &end}}
+	tests := []struct {
+		name            string
+		defaultLanguage string
+		language        string
+		key             string
+		health          ThingHealth
+		want            string
+		rendered        string
+	}{
+		{"language", "de", "en", "ok", ThingHealth{}, "Prediction available", "en"},
+		{"message missing in the language", "de", "fr", "unavailable", ThingHealth{}, "Prediction unavailable", "en"},
+		{"message missing in the default language", "fr", "fr", "unavailable", ThingHealth{}, "Prediction unavailable", "en"},
+		{"default language", "en", "it", "ok", ThingHealth{}, "Prediction available", "en"},
+		{"default language without translations", "it", "it", "ok", ThingHealth{}, "Prognose verfügbar", "de"},
+		{"template that can't be rendered", "fr", "fr", "maintenance", maintenanceHealth, "Baustelle bis 01.05. 16:00", "de"},
+		{"maintenance end in the local time", "de", "de", "maintenance", maintenanceHealth, "Baustelle bis 01.05. 16:00", "de"},
+		{"maintenance until further notice", "de", "de", "maintenance", ThingHealth{Maintenance: &maintenance.Window{Id: "works"}}, "Baustelle", "de"},
+		{"unknown key", "de", "de", "unknown", ThingHealth{}, "unknown", ""},
+	}
+	defer func(previous string) { messageDefaultLanguage = previous }(messageDefaultLanguage)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messageDefaultLanguage = test.defaultLanguage
+			message, rendered := renderMessage(locales, test.language, test.key, test.health)
+			if message != test.want || rendered != test.rendered {
+				t.Errorf("renderMessage = %q in %q, want %q in %q", message, rendered, test.want, test.rendered)
+			}
+		})
+	}
+}
+
+func TestMessageLanguage(t *testing.T) {
+	locales := testLocales(map[string]string{
+		"de.json": `{"messages": {"ok": "Prognose verfügbar"}}`,
+		"en.json": `{"messages": {"ok": "Prediction available"}}`,
+	})
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"en", "en"},
+		{"EN", "en"},
+		{"en-GB", "en"},
+		{"de_AT", "de"},
+		{"fr", "de"},
+		{"", "de"},
+	}
+	for _, test := range tests {
+		t.Run(test.language, func(t *testing.T) {
+			if got := messageLanguage(locales, test.language); got != test.want {
+				t.Errorf("messageLanguage(%q) = %q, want %q", test.language, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRiderMessage(t *testing.T) {
+	severity, message, all := riderMessage("en-US", ThingHealth{Reason: HealthStale, RootCause: RootCauseUpstreamData}, true)
+	if severity != SeverityError {
+		t.Errorf("Severity = %s, want %s", severity, SeverityError)
+	}
+	if message != all["en"] || message == "" {
+		t.Errorf("Message = %q, want the English message %q", message, all["en"])
+	}
+	if all["de"] == "" || all["de"] == all["en"] {
+		t.Errorf("Expected a German message, got %v", all)
+	}
+}
@@ -10,10 +10,31 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
+// Whether the written files are pushed to the workers.
+var pushEnabled = true
+
+// A lock for the push setting.
+var pushMutex = &sync.RWMutex{}
+
+// Stop pushing the written files to the workers, e.g. when replaying a recording.
+func DisablePush() {
+	pushMutex.Lock()
+	defer pushMutex.Unlock()
+	pushEnabled = false
+}
+
 func PushFile(jsonData []byte, filePath string) {
+	pushMutex.RLock()
+	enabled := pushEnabled
+	pushMutex.RUnlock()
+	if !enabled {
+		return
+	}
+
 	WORKER_HOST := os.Getenv("WORKER_HOST")
 	if WORKER_HOST == "" {
 		panic("WORKER_HOST is not set")
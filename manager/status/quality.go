@@ -0,0 +1,41 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/log"
+	"monitor/sync"
+	"os"
+)
+
+// Write the data quality report of the thing catalogue.
+func WriteThingsQuality() {
+	// Fetch the path under which we will save the json files.
+	staticPath := os.Getenv("STATIC_PATH")
+	if staticPath == "" {
+		panic("STATIC_PATH not set")
+	}
+
+	sync.QualityMutex.Lock()
+	reportJson, err := json.Marshal(sync.Quality)
+	sync.QualityMutex.Unlock()
+	if err != nil {
+		log.Error.Println("Error marshalling things quality report:", err)
+		return
+	}
+	ioutil.WriteFile(staticPath+"things-quality.json", reportJson, 0644)
+	PushFile(reportJson, "things-quality.json")
+}
+
+// Create Prometheus metrics with the number of catalogue issues by type.
+func qualityMetrics() []string {
+	sync.QualityMutex.Lock()
+	defer sync.QualityMutex.Unlock()
+	metrics := make([]string, 0, len(sync.IssueTypes)+1)
+	for _, issueType := range sync.IssueTypes {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_thing_issues{type=\"%s\"} %d", issueType, sync.Quality.NumIssues[issueType]))
+	}
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_things_with_issues %d", sync.Quality.NumThingsWithIssues))
+	return metrics
+}
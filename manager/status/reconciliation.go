@@ -0,0 +1,184 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/clock"
+	"monitor/env"
+	"monitor/log"
+	"monitor/predictions"
+	"monitor/sync"
+	"os"
+	"sort"
+	"time"
+)
+
+// A topic with predictions that doesn't belong to any thing.
+type OrphanTopic struct {
+	// The mqtt topic.
+	Topic string `json:"topic"`
+	// The signal group id of the last prediction, if the prediction is stored.
+	SignalGroupId *string `json:"signal_group_id"`
+	// The number of messages on the topic, if counted in wildcard mode.
+	Messages *int `json:"messages"`
+}
+
+// A thing whose predictions name another signal group.
+type SignalGroupMismatch struct {
+	// The name of the thing.
+	ThingName string `json:"thing_name"`
+	// The mqtt topic of the thing.
+	Topic string `json:"topic"`
+	// The signal group id of the last prediction.
+	SignalGroupId string `json:"signal_group_id"`
+}
+
+// The counts of a reconciliation at a point in time.
+type ReconciliationCounts struct {
+	// The unix time of the reconciliation.
+	Time int64 `json:"time"`
+	// The number of topics with predictions but no thing.
+	NumOrphanTopics int `json:"num_orphan_topics"`
+	// The number of things that never received a prediction since startup.
+	NumThingsWithoutPredictions int `json:"num_things_without_predictions"`
+	// The number of things whose predictions name another signal group.
+	NumSignalGroupMismatches int `json:"num_signal_group_mismatches"`
+}
+
+// A reconciliation of the things from the SensorThings API with the topics of the prediction broker.
+type Reconciliation struct {
+	ReconciliationCounts
+	// The topics with predictions but no thing.
+	OrphanTopics []OrphanTopic `json:"orphan_topics"`
+	// The names of the things that never received a prediction since startup.
+	ThingsWithoutPredictions []string `json:"things_without_predictions"`
+	// The things whose predictions name another signal group.
+	SignalGroupMismatches []SignalGroupMismatch `json:"signal_group_mismatches"`
+	// The counts of the previous reconciliations, oldest first.
+	History []ReconciliationCounts `json:"history"`
+}
+
+// The counts of the previous reconciliations, oldest first.
+var reconciliationHistory = make([]ReconciliationCounts, 0)
+
+// The number of previous reconciliations whose counts are kept.
+var maxReconciliationHistory = env.Int("RECONCILIATION_HISTORY", 1440)
+
+// Reconcile the things with the predictions and write the result to json.
+// The counts of the last `RECONCILIATION_HISTORY` runs are kept to track how they change.
+func WriteReconciliation() {
+	// Fetch the path under which we will save the json files.
+	staticPath := os.Getenv("STATIC_PATH")
+	if staticPath == "" {
+		panic("STATIC_PATH not set")
+	}
+
+	// In wildcard mode, messages on unknown topics are counted instead of stored.
+	unknown := predictions.UnknownTopics()
+
+	// Lock resources.
+	sync.ThingsMutex.Lock()
+	predictions.CurrentMutex.Lock()
+	predictions.TimestampsMutex.Lock()
+	reconciliation := reconcile(sync.Things, predictions.Current, predictions.FirstReceived, unknown)
+	predictions.TimestampsMutex.Unlock()
+	predictions.CurrentMutex.Unlock()
+	sync.ThingsMutex.Unlock()
+
+	reconciliation.Time = clock.Now().Unix()
+	reconciliationHistory = appendReconciliationHistory(reconciliationHistory, reconciliation.ReconciliationCounts, maxReconciliationHistory)
+	reconciliation.History = reconciliationHistory
+
+	reconciliationJson, err := json.Marshal(reconciliation)
+	if err != nil {
+		log.Error.Println("Error marshalling reconciliation:", err)
+		return
+	}
+	ioutil.WriteFile(staticPath+"reconciliation.json", reconciliationJson, 0644)
+	PushFile(reconciliationJson, "reconciliation.json")
+}
+
+// Reconcile the things with the current predictions and the topics that received a prediction since startup.
+// The unknown topics are the message counts of topics without thing, if they are counted.
+func reconcile(things map[string]sync.Thing, current map[string]predictions.Prediction,
+	firstReceived map[string]time.Time, unknown map[string]int) Reconciliation {
+	reconciliation := Reconciliation{
+		OrphanTopics:             make([]OrphanTopic, 0),
+		ThingsWithoutPredictions: make([]string, 0),
+		SignalGroupMismatches:    make([]SignalGroupMismatch, 0),
+	}
+
+	for topic, prediction := range current {
+		if _, ok := things[topic]; ok {
+			continue
+		}
+		signalGroupId := prediction.SignalGroupId
+		reconciliation.OrphanTopics = append(reconciliation.OrphanTopics, OrphanTopic{Topic: topic, SignalGroupId: &signalGroupId})
+	}
+	for _, thing := range things {
+		topic := thing.Topic()
+		if _, ok := firstReceived[topic]; !ok {
+			reconciliation.ThingsWithoutPredictions = append(reconciliation.ThingsWithoutPredictions, thing.Name)
+		}
+		if prediction, ok := current[topic]; ok && prediction.SignalGroupId != thing.Name {
+			reconciliation.SignalGroupMismatches = append(reconciliation.SignalGroupMismatches, SignalGroupMismatch{
+				ThingName:     thing.Name,
+				Topic:         topic,
+				SignalGroupId: prediction.SignalGroupId,
+			})
+		}
+	}
+
+	sort.Strings(reconciliation.ThingsWithoutPredictions)
+	sort.Slice(reconciliation.SignalGroupMismatches, func(i, j int) bool {
+		return reconciliation.SignalGroupMismatches[i].ThingName < reconciliation.SignalGroupMismatches[j].ThingName
+	})
+	addUnknownTopics(&reconciliation, unknown)
+	return reconciliation
+}
+
+// Add the message counts of topics without thing to the orphan topics and count the findings.
+func addUnknownTopics(reconciliation *Reconciliation, unknown map[string]int) {
+	orphans := make(map[string]int, len(reconciliation.OrphanTopics))
+	for i, orphan := range reconciliation.OrphanTopics {
+		orphans[orphan.Topic] = i
+	}
+	for topic, count := range unknown {
+		messages := count
+		if i, ok := orphans[topic]; ok {
+			reconciliation.OrphanTopics[i].Messages = &messages
+			continue
+		}
+		reconciliation.OrphanTopics = append(reconciliation.OrphanTopics, OrphanTopic{Topic: topic, Messages: &messages})
+	}
+
+	sort.Slice(reconciliation.OrphanTopics, func(i, j int) bool {
+		return reconciliation.OrphanTopics[i].Topic < reconciliation.OrphanTopics[j].Topic
+	})
+	reconciliation.NumOrphanTopics = len(reconciliation.OrphanTopics)
+	reconciliation.NumThingsWithoutPredictions = len(reconciliation.ThingsWithoutPredictions)
+	reconciliation.NumSignalGroupMismatches = len(reconciliation.SignalGroupMismatches)
+}
+
+// Append the counts of a reconciliation to the history and keep only the last `max` entries.
+func appendReconciliationHistory(history []ReconciliationCounts, counts ReconciliationCounts, max int) []ReconciliationCounts {
+	history = append(history, counts)
+	if max >= 0 && len(history) > max {
+		history = history[len(history)-max:]
+	}
+	return history
+}
+
+// Create Prometheus metrics with the counts of the last reconciliation.
+func reconciliationMetrics() []string {
+	if len(reconciliationHistory) == 0 {
+		return nil
+	}
+	last := reconciliationHistory[len(reconciliationHistory)-1]
+	return []string{
+		fmt.Sprintf("prediction_monitor_orphan_topics %d", last.NumOrphanTopics),
+		fmt.Sprintf("prediction_monitor_things_without_predictions %d", last.NumThingsWithoutPredictions),
+		fmt.Sprintf("prediction_monitor_signal_group_mismatches %d", last.NumSignalGroupMismatches),
+	}
+}
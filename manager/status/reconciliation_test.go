@@ -0,0 +1,170 @@
+package status
+
+import (
+	"fmt"
+	"monitor/predictions"
+	"monitor/sync"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Describe an orphan topic for comparison, e.g. `hamburg/9 sg=9 messages=3`.
+func describeOrphan(orphan OrphanTopic) string {
+	description := orphan.Topic
+	if orphan.SignalGroupId != nil {
+		description += " sg=" + *orphan.SignalGroupId
+	}
+	if orphan.Messages != nil {
+		description += fmt.Sprintf(" messages=%d", *orphan.Messages)
+	}
+	return description
+}
+
+func TestReconcile(t *testing.T) {
+	things := func(names ...string) map[string]sync.Thing {
+		things := make(map[string]sync.Thing)
+		for _, name := range names {
+			thing := sync.Thing{Name: name}
+			things[thing.Topic()] = thing
+		}
+		return things
+	}
+	current := func(signalGroups map[string]string) map[string]predictions.Prediction {
+		current := make(map[string]predictions.Prediction)
+		for topic, signalGroupId := range signalGroups {
+			current[topic] = predictions.Prediction{SignalGroupId: signalGroupId}
+		}
+		return current
+	}
+	received := func(topics ...string) map[string]time.Time {
+		firstReceived := make(map[string]time.Time)
+		for _, topic := range topics {
+			firstReceived[topic] = time.Unix(0, 0)
+		}
+		return firstReceived
+	}
+
+	tests := []struct {
+		name          string
+		things        map[string]sync.Thing
+		current       map[string]predictions.Prediction
+		firstReceived map[string]time.Time
+		unknown       map[string]int
+		orphans       []string
+		without       []string
+		mismatches    []SignalGroupMismatch
+	}{
+		{
+			"consistent",
+			things("1_1", "1_2"),
+			current(map[string]string{"hamburg/1_1": "1_1", "hamburg/1_2": "1_2"}),
+			received("hamburg/1_1", "hamburg/1_2"),
+			nil,
+			[]string{}, []string{}, []SignalGroupMismatch{},
+		},
+		{
+			"orphan topics",
+			things("1_1"),
+			current(map[string]string{"hamburg/1_1": "1_1", "hamburg/9_1": "9_1", "hamburg/8_1": "8_1"}),
+			received("hamburg/1_1", "hamburg/9_1", "hamburg/8_1"),
+			nil,
+			[]string{"hamburg/8_1 sg=8_1", "hamburg/9_1 sg=9_1"}, []string{}, []SignalGroupMismatch{},
+		},
+		{
+			"counted unknown topics",
+			things("1_1"),
+			current(map[string]string{"hamburg/1_1": "1_1", "hamburg/9_1": "9_1"}),
+			received("hamburg/1_1", "hamburg/9_1"),
+			map[string]int{"hamburg/9_1": 3, "other/1": 5},
+			[]string{"hamburg/9_1 sg=9_1 messages=3", "other/1 messages=5"}, []string{}, []SignalGroupMismatch{},
+		},
+		{
+			"things without predictions",
+			things("1_1", "1_3", "1_2"),
+			current(map[string]string{"hamburg/1_1": "1_1"}),
+			received("hamburg/1_1"),
+			nil,
+			[]string{}, []string{"1_2", "1_3"}, []SignalGroupMismatch{},
+		},
+		{
+			// A thing whose prediction was evicted still received a prediction since startup.
+			"evicted prediction",
+			things("1_1"),
+			current(map[string]string{}),
+			received("hamburg/1_1"),
+			nil,
+			[]string{}, []string{}, []SignalGroupMismatch{},
+		},
+		{
+			"signal group mismatches",
+			things("1_1", "1_2", "1_3"),
+			current(map[string]string{"hamburg/1_1": "1_1", "hamburg/1_3": "1_4", "hamburg/1_2": ""}),
+			received("hamburg/1_1", "hamburg/1_2", "hamburg/1_3"),
+			nil,
+			[]string{}, []string{},
+			[]SignalGroupMismatch{
+				{ThingName: "1_2", Topic: "hamburg/1_2", SignalGroupId: ""},
+				{ThingName: "1_3", Topic: "hamburg/1_3", SignalGroupId: "1_4"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reconciliation := reconcile(test.things, test.current, test.firstReceived, test.unknown)
+
+			orphans := make([]string, len(reconciliation.OrphanTopics))
+			for i, orphan := range reconciliation.OrphanTopics {
+				orphans[i] = describeOrphan(orphan)
+			}
+			if !reflect.DeepEqual(orphans, test.orphans) {
+				t.Errorf("orphan topics = %v, want %v", orphans, test.orphans)
+			}
+			if !reflect.DeepEqual(reconciliation.ThingsWithoutPredictions, test.without) {
+				t.Errorf("things without predictions = %v, want %v", reconciliation.ThingsWithoutPredictions, test.without)
+			}
+			if !reflect.DeepEqual(reconciliation.SignalGroupMismatches, test.mismatches) {
+				t.Errorf("signal group mismatches = %v, want %v", reconciliation.SignalGroupMismatches, test.mismatches)
+			}
+			counts := ReconciliationCounts{
+				NumOrphanTopics:             len(test.orphans),
+				NumThingsWithoutPredictions: len(test.without),
+				NumSignalGroupMismatches:    len(test.mismatches),
+			}
+			if reconciliation.ReconciliationCounts != counts {
+				t.Errorf("counts = %+v, want %+v", reconciliation.ReconciliationCounts, counts)
+			}
+		})
+	}
+}
+
+func TestAppendReconciliationHistory(t *testing.T) {
+	history := func(times ...int64) []ReconciliationCounts {
+		counts := make([]ReconciliationCounts, len(times))
+		for i, time := range times {
+			counts[i] = ReconciliationCounts{Time: time}
+		}
+		return counts
+	}
+	tests := []struct {
+		name    string
+		history []ReconciliationCounts
+		max     int
+		want    []ReconciliationCounts
+	}{
+		{"first", history(), 3, history(4)},
+		{"below the maximum", history(1, 2), 3, history(1, 2, 4)},
+		{"at the maximum", history(1, 2, 3), 3, history(2, 3, 4)},
+		{"above the maximum", history(1, 2, 3), 2, history(3, 4)},
+		{"no history", history(1, 2, 3), 0, history()},
+		{"unlimited", history(1, 2, 3), -1, history(1, 2, 3, 4)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := appendReconciliationHistory(test.history, ReconciliationCounts{Time: 4}, test.max)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("appendReconciliationHistory = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package status
+
+import (
+	"fmt"
+	"monitor/env"
+	"monitor/observations"
+	"monitor/sync"
+	"time"
+)
+
+const (
+	// The controller stopped sending signal data, i.e. the source datastreams have no recent observations.
+	RootCauseUpstreamData = "upstream_data"
+	// The controller still sends signal data, but the prediction service doesn't publish usable predictions.
+	RootCausePredictionService = "prediction_service"
+	// The cause can't be told, e.g. because the thing has no source datastreams or observations aren't tracked.
+	RootCauseUnknown = "unknown"
+)
+
+// All root causes.
+var RootCauses = []string{RootCauseUpstreamData, RootCausePredictionService, RootCauseUnknown}
+
+// The age after which the observations of a thing indicate that the controller stopped sending data.
+var observationMaxAge = env.Duration("OBSERVATION_MAX_AGE", 5*time.Minute)
+
+// Get the time of the latest observation of the source datastreams of a thing, if there is one.
+func lastObservation(datastreams []sync.Datastream) *int64 {
+	last, ok := observations.Last(datastreams)
+	if !ok {
+		return nil
+	}
+	unix := last.Unix()
+	return &unix
+}
+
+// Classify why a thing is unhealthy by the observations of its source datastreams.
+// Observations older than `OBSERVATION_MAX_AGE` indicate that the controller stopped sending data.
+func rootCause(datastreams []sync.Datastream, now time.Time) string {
+	if len(datastreams) == 0 {
+		return RootCauseUnknown
+	}
+	started, ok := observations.Started()
+	if !ok {
+		return RootCauseUnknown
+	}
+	last, ok := observations.Last(datastreams)
+	if ok && now.Sub(last) <= observationMaxAge {
+		return RootCausePredictionService
+	}
+	if ok || now.Sub(started) > observationMaxAge {
+		return RootCauseUpstreamData
+	}
+	// No observation was received yet, but the tracking only started recently.
+	return RootCauseUnknown
+}
+
+// Create Prometheus metrics with the number of unhealthy things by root cause and the tracked observations.
+func rootCauseMetrics() []string {
+	counts := make(map[string]int)
+	for _, health := range healthList() {
+		if health.RootCause != "" {
+			counts[health.RootCause]++
+		}
+	}
+	metrics := make([]string, 0, len(RootCauses)+2)
+	for _, cause := range RootCauses {
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_root_cause{cause=\"%s\"} %d", cause, counts[cause]))
+	}
+	received, numDatastreams := observations.Counts()
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_observations_received %d", received))
+	metrics = append(metrics, fmt.Sprintf("prediction_monitor_observed_datastreams %d", numDatastreams))
+	return metrics
+}
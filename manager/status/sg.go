@@ -3,11 +3,13 @@ package status
 import (
 	"encoding/json"
 	"io/ioutil"
+	"monitor/annotations"
+	"monitor/clock"
 	"monitor/log"
+	"monitor/maintenance"
 	"monitor/predictions"
 	"monitor/sync"
 	"os"
-	"time"
 )
 
 // A status summary of all predictions that is written to json.
@@ -16,10 +18,84 @@ type SGStatus struct {
 	StatusUpdateTime int64 `json:"status_update_time"`
 	// The name of the thing.
 	ThingName string `json:"thing_name"`
+	// The published metadata of the thing from the SensorThings API.
+	ThingProperties map[string]interface{} `json:"thing_properties"`
 	// The current prediction quality, if there is a prediction.
 	PredictionQuality *float64 `json:"prediction_quality"`
 	// The unix time of the last prediction, if there is a prediction.
 	PredictionTime *int64 `json:"prediction_time"`
+	// Whether the prediction contains any green phase, if there is a prediction.
+	PredictionHasGreen *bool `json:"prediction_has_green"`
+	// The seconds until the next predicted green phase starts, if there is one.
+	PredictionNextGreenStart *int64 `json:"prediction_next_green_start"`
+	// The seconds until the next predicted green phase ends, if it ends within the prediction.
+	PredictionNextGreenEnd *int64 `json:"prediction_next_green_end"`
+	// The share of predicted seconds that are green, if there is a prediction.
+	PredictionGreenShare *float64 `json:"prediction_green_share"`
+	// The detected cycle length in seconds, if the prediction is periodic.
+	PredictionCycleLength *int64 `json:"prediction_cycle_length"`
+	// The remaining forward horizon of the prediction in seconds, if there is a prediction.
+	PredictionHorizon *int64 `json:"prediction_horizon"`
+	// Whether the horizon of the prediction is "ok", "short" or "expired", if there is a prediction.
+	PredictionHorizonState *string `json:"prediction_horizon_state"`
+	// Whether the prediction can be used, i.e. there is a prediction with a sufficient horizon.
+	PredictionUsable bool `json:"prediction_usable"`
+	// The number of monitor runs since startup in which the prediction was unusable.
+	PredictionUnusableCount int `json:"prediction_unusable_count"`
+	// The anomalies detected in the recent predictions, e.g. "stuck" or "all_red".
+	PredictionAnomalies []string `json:"prediction_anomalies"`
+	// The number of messages per minute on the topic, if a message was received.
+	CadenceRate *float64 `json:"cadence_rate"`
+	// The median gap between two messages in seconds, if a message was received.
+	CadenceMedianGap *float64 `json:"cadence_median_gap"`
+	// The 95th percentile gap between two messages in seconds, if a message was received.
+	CadenceP95Gap *float64 `json:"cadence_p95_gap"`
+	// The mean message size in bytes, if a message was received.
+	CadenceMessageSize *float64 `json:"cadence_message_size"`
+	// Whether the topic is silent, i.e. the current gap far exceeds the learned cadence.
+	Silent bool `json:"silent"`
+	// The unix time at which the last prediction was received, if there is a prediction.
+	PredictionReceivedTime *int64 `json:"prediction_received_time"`
+	// The unix time at which the last prediction was generated, if its timestamp could be parsed.
+	PredictionGeneratedTime *int64 `json:"prediction_generated_time"`
+	// Whether the timestamps of the last prediction lie in the future.
+	PredictionInFuture bool `json:"prediction_in_future"`
+	// The number of predictions with timestamps in the future since startup.
+	PredictionFutureCount int `json:"prediction_future_count"`
+	// The distribution of the recent generation-to-receive latencies in seconds.
+	Latency predictions.Distribution `json:"latency"`
+	// The distribution of the recent offsets of the start time from the receive time in seconds.
+	Skew predictions.Distribution `json:"skew"`
+	// The number of messages on the topic that could not be parsed since startup, by the failing part.
+	ParseFailures map[string]int `json:"parse_failures"`
+	// Whether the state is "ok", "expected_off" or an "unexpected_outage" compared to the usual state at this hour of the week,
+	// or "maintenance" during a planned maintenance window.
+	Classification string `json:"classification"`
+	// The usual share of monitor runs with a healthy prediction at this hour of the week, once learned.
+	BaselineAvailability *float64 `json:"baseline_availability"`
+	// The usual prediction quality at this hour of the week, once learned.
+	BaselineQuality *float64 `json:"baseline_quality"`
+	// The active maintenance window of the thing, if there is one.
+	Maintenance *maintenance.Window `json:"maintenance"`
+	// The notes of the operators on the thing or its intersection, newest first.
+	Annotations []annotations.Annotation `json:"annotations"`
+	// The text of the newest note in the language of the thing, if there is a note.
+	Annotation *string `json:"annotation"`
+	// How much riders are affected by the state of the prediction: "ok", "info", "warning" or "error".
+	StatusSeverity string `json:"status_severity"`
+	// A message for riders about the state of the prediction, in the language of the thing.
+	StatusMessage string `json:"status_message"`
+	// The message for riders in all available languages, e.g. "de" and "en".
+	StatusMessages map[string]string `json:"status_messages"`
+	// Whether the controller stopped sending data ("upstream_data"), the prediction service failed
+	// ("prediction_service") or the cause is "unknown", if the prediction is not healthy.
+	RootCause *string `json:"root_cause"`
+	// The unix time of the latest observation of the signal data of the thing, if there is one.
+	LastObservationTime *int64 `json:"last_observation_time"`
+	// The number of outages of the thing within the incident retention.
+	OutageCount int `json:"outage_count"`
+	// The mean time to recovery of the thing in seconds, if it recovered from an outage.
+	Mttr *float64 `json:"mttr"`
 }
 
 // Write a status file for each signal group.
@@ -30,6 +106,9 @@ func WriteStatusForEachSG() {
 		panic("STATIC_PATH not set")
 	}
 
+	// Get the outage statistics before the resources are locked.
+	outages := thingOutageStats()
+
 	// Lock resources.
 	sync.ThingsMutex.Lock()
 	defer sync.ThingsMutex.Unlock()
@@ -41,22 +120,86 @@ func WriteStatusForEachSG() {
 	for _, thing := range sync.Things {
 		// Create the status summary.
 		status := SGStatus{
-			StatusUpdateTime: time.Now().Unix(),
+			StatusUpdateTime: clock.Now().Unix(),
 			ThingName:        thing.Name,
+			ThingProperties:  thing.Metadata(),
 		}
 
 		// Get the prediction for the signal group.
-		prediction, ok := predictions.Current[thing.Topic()]
-		if ok {
+		prediction, predictionOk := predictions.Current[thing.Topic()]
+		if predictionOk {
 			status.PredictionQuality = &prediction.PredictionQuality
 		}
 
 		// Get the prediction time.
-		timestamp, ok := predictions.Timestamps[thing.Topic()]
-		if ok {
+		timestamp, timestampOk := predictions.Timestamps[thing.Topic()]
+		if timestampOk {
 			status.PredictionTime = &timestamp
 		}
 
+		// Derive the signal-phase insights from the prediction vector.
+		if predictionOk && timestampOk {
+			insights := prediction.Analyse(timestamp, status.StatusUpdateTime)
+			status.PredictionHasGreen = &insights.HasGreen
+			status.PredictionNextGreenStart = insights.NextGreenStart
+			status.PredictionNextGreenEnd = insights.NextGreenEnd
+			status.PredictionGreenShare = &insights.GreenShare
+			status.PredictionCycleLength = insights.CycleLength
+
+			// Check whether the prediction still covers enough seconds ahead.
+			horizon, horizonState := prediction.HorizonState(timestamp, status.StatusUpdateTime)
+			status.PredictionHorizon = &horizon
+			status.PredictionHorizonState = &horizonState
+			status.PredictionUsable = horizonState == predictions.HorizonOk
+		}
+		status.PredictionUnusableCount = getUnusableCount(thing.Topic())
+		status.PredictionAnomalies = predictions.Anomalies(thing.Topic())
+
+		// Get the publishing cadence of the topic.
+		if cadence, ok := predictions.GetCadence(thing.Topic(), clock.Now()); ok {
+			status.CadenceRate = &cadence.Rate
+			status.CadenceMedianGap = &cadence.MedianGap
+			status.CadenceP95Gap = &cadence.P95Gap
+			status.CadenceMessageSize = &cadence.MessageSize
+			status.Silent = cadence.Silent
+		}
+
+		// Get the receive and generation time and the latency of the topic.
+		if timing, ok := predictions.GetTiming(thing.Topic()); ok {
+			receivedTime := timing.ReceivedAt.Unix()
+			status.PredictionReceivedTime = &receivedTime
+			if timing.Timestamp != nil {
+				generatedTime := timing.Timestamp.Unix()
+				status.PredictionGeneratedTime = &generatedTime
+			}
+			status.PredictionInFuture = timing.InFuture
+		}
+		status.PredictionFutureCount = predictions.FutureCount(thing.Topic())
+		status.Latency, status.Skew = predictions.TopicLatency(thing.Topic())
+		status.ParseFailures = predictions.ParseFailures(thing.Topic())
+		health, healthOk := GetHealth(thing.Topic())
+		status.StatusSeverity, status.StatusMessage, status.StatusMessages = riderMessage(thing.Properties.Language, health, healthOk)
+		if healthOk {
+			status.Classification = health.Classification
+			status.BaselineAvailability = health.BaselineAvailability
+			status.BaselineQuality = health.BaselineQuality
+			status.Maintenance = health.Maintenance
+			if health.RootCause != "" {
+				rootCause := health.RootCause
+				status.RootCause = &rootCause
+			}
+			status.LastObservationTime = health.LastObservationTime
+		}
+		status.Annotations = annotations.For(thing, clock.Now())
+		if len(status.Annotations) > 0 {
+			text := status.Annotations[0].TextIn(thing.Properties.Language)
+			status.Annotation = &text
+		}
+		if stats, ok := outages[thing.Topic()]; ok {
+			status.OutageCount = stats.NumOutages
+			status.Mttr = stats.Mttr
+		}
+
 		// Write the status update to a json file.
 		statusJson, err := json.Marshal(status)
 		if err != nil {
@@ -0,0 +1,518 @@
+package status
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"monitor/clock"
+	"monitor/data"
+	"monitor/env"
+	"monitor/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	gosync "sync"
+	"time"
+)
+
+const (
+	// A report of a calendar day.
+	AvailabilityPeriodDay = "day"
+	// A report of an ISO week, starting on Monday.
+	AvailabilityPeriodWeek = "week"
+)
+
+// A count of monitor runs and the monitor runs in which a prediction was available.
+type availabilityCounter struct {
+	// The number of monitor runs.
+	Samples int `json:"samples"`
+	// The number of monitor runs with a fresh, good-quality prediction.
+	Available int `json:"available"`
+}
+
+// Count a monitor run.
+func (c *availabilityCounter) add(available bool) {
+	c.Samples++
+	if available {
+		c.Available++
+	}
+}
+
+// Get the share of monitor runs with a fresh, good-quality prediction, if there was a monitor run.
+func (c availabilityCounter) share() *float64 {
+	if c.Samples == 0 {
+		return nil
+	}
+	share := float64(c.Available) / float64(c.Samples)
+	return &share
+}
+
+// The availability of a thing within a period.
+type thingAvailability struct {
+	availabilityCounter
+	// The intersection of the thing.
+	Intersection string `json:"intersection"`
+	// The lane type of the thing.
+	LaneType string `json:"lane_type"`
+}
+
+// The availability counts of a day or a week.
+type availabilityPeriod struct {
+	// Whether the period is a "day" or a "week".
+	Period string `json:"period"`
+	// The name of the period, e.g. "2023-05-01" or "2023-W18".
+	Name string `json:"name"`
+	// The unix time at which the period starts.
+	Start int64 `json:"start"`
+	// The unix time at which the period ends.
+	End int64 `json:"end"`
+	// The counts of all things.
+	Total availabilityCounter `json:"total"`
+	// The counts by thing name.
+	Things map[string]*thingAvailability `json:"things"`
+	// The counts by intersection.
+	Intersections map[string]*availabilityCounter `json:"intersections"`
+	// The counts by lane type.
+	LaneTypes map[string]*availabilityCounter `json:"lane_types"`
+	// The counts by local hour of the day.
+	Hours [24]availabilityCounter `json:"hours"`
+
+	// Whether the counts changed since the report was last written.
+	dirty bool
+}
+
+// An entry of an availability report.
+type AvailabilityEntry struct {
+	// The thing name, intersection, lane type or hour of the day.
+	Name string `json:"name"`
+	// The intersection of the thing, for things.
+	Intersection string `json:"intersection"`
+	// The lane type of the thing, for things.
+	LaneType string `json:"lane_type"`
+	// The number of monitor runs.
+	Samples int `json:"samples"`
+	// The share of monitor runs with a fresh, good-quality prediction, if there was a monitor run.
+	Availability *float64 `json:"availability"`
+}
+
+// An availability report of a day or a week that is written to json, csv and html.
+type AvailabilityReport struct {
+	// Whether the report covers a "day" or a "week".
+	Period string `json:"period"`
+	// The name of the period, e.g. "2023-05-01" or "2023-W18".
+	Name string `json:"name"`
+	// The unix time at which the period starts.
+	Start int64 `json:"start"`
+	// The unix time at which the period ends.
+	End int64 `json:"end"`
+	// The time of the report.
+	UpdateTime int64 `json:"update_time"`
+	// Whether the period is over, i.e. the report is final.
+	Complete bool `json:"complete"`
+	// The number of monitor runs of all things.
+	Samples int `json:"samples"`
+	// The share of monitor runs of all things with a fresh, good-quality prediction.
+	Availability *float64 `json:"availability"`
+	// The availability of each thing.
+	Things []AvailabilityEntry `json:"things"`
+	// The availability of each intersection.
+	Intersections []AvailabilityEntry `json:"intersections"`
+	// The availability of each lane type.
+	LaneTypes []AvailabilityEntry `json:"lane_types"`
+	// The availability of each local hour of the day.
+	HoursOfDay []AvailabilityEntry `json:"hours_of_day"`
+}
+
+// An entry of the index of all availability reports.
+type AvailabilityReportFiles struct {
+	// Whether the report covers a "day" or a "week".
+	Period string `json:"period"`
+	// The name of the period.
+	Name string `json:"name"`
+	// The unix time at which the period starts.
+	Start int64 `json:"start"`
+	// The path of the json report.
+	Json string `json:"json"`
+	// The path of the csv report.
+	Csv string `json:"csv"`
+	// The path of the html report.
+	Html string `json:"html"`
+}
+
+// The counts of the retained days and weeks, by period and name.
+var availabilityPeriods = make(map[string]*availabilityPeriod)
+
+// Whether the persisted counts were loaded.
+var availabilityLoaded = false
+
+// The time at which the reports were last written.
+var lastAvailabilityReport time.Time
+
+// A lock for the availability counts.
+var availabilityMutex = &gosync.Mutex{}
+
+// The file under `DATA_PATH` in which the availability counts are persisted.
+const availabilityFile = "availability.json"
+
+// The time zone in which days, weeks and hours of the day are reported.
+var slaLocation = loadAvailabilityLocation()
+
+// Get the time zone in which days, weeks and hours of the day are reported.
+func availabilityLocation() *time.Location {
+	return slaLocation
+}
+
+// Load the time zone from `SLA_TIMEZONE`, by default `Europe/Berlin`.
+func loadAvailabilityLocation() *time.Location {
+	name := env.String("SLA_TIMEZONE", "Europe/Berlin")
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Warning.Printf("Invalid SLA_TIMEZONE %s, using UTC: %v\n", name, err)
+		return time.UTC
+	}
+	return location
+}
+
+// Get the day and the week that contain the given time, without counts.
+func periodsAt(t time.Time) []*availabilityPeriod {
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	weekStart := dayStart.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	year, week := t.ISOWeek()
+	return []*availabilityPeriod{
+		{
+			Period: AvailabilityPeriodDay,
+			Name:   dayStart.Format("2006-01-02"),
+			Start:  dayStart.Unix(),
+			End:    dayStart.AddDate(0, 0, 1).Unix(),
+		},
+		{
+			Period: AvailabilityPeriodWeek,
+			Name:   fmt.Sprintf("%d-W%02d", year, week),
+			Start:  weekStart.Unix(),
+			End:    weekStart.AddDate(0, 0, 7).Unix(),
+		},
+	}
+}
+
+// Count the health of each thing in the last monitor run into the current day and week.
+// Things in a planned maintenance window are not counted.
+func recordAvailability(now time.Time) {
+	health := make([]ThingHealth, 0)
+	for _, thing := range healthList() {
+		if thing.Maintenance == nil {
+			health = append(health, thing)
+		}
+	}
+	if len(health) == 0 {
+		return
+	}
+	hour := now.Hour()
+	for _, period := range periodsAt(now) {
+		key := period.Period + "/" + period.Name
+		if existing, ok := availabilityPeriods[key]; ok {
+			period = existing
+		} else {
+			period.Things = make(map[string]*thingAvailability)
+			period.Intersections = make(map[string]*availabilityCounter)
+			period.LaneTypes = make(map[string]*availabilityCounter)
+			availabilityPeriods[key] = period
+		}
+		for _, thing := range health {
+			thingCounts, ok := period.Things[thing.ThingName]
+			if !ok {
+				thingCounts = &thingAvailability{}
+				period.Things[thing.ThingName] = thingCounts
+			}
+			thingCounts.Intersection = thing.Intersection
+			thingCounts.LaneType = thing.LaneType
+			thingCounts.add(thing.Healthy)
+
+			if _, ok := period.Intersections[thing.Intersection]; !ok {
+				period.Intersections[thing.Intersection] = &availabilityCounter{}
+			}
+			period.Intersections[thing.Intersection].add(thing.Healthy)
+			if _, ok := period.LaneTypes[thing.LaneType]; !ok {
+				period.LaneTypes[thing.LaneType] = &availabilityCounter{}
+			}
+			period.LaneTypes[thing.LaneType].add(thing.Healthy)
+			period.Hours[hour].add(thing.Healthy)
+			period.Total.add(thing.Healthy)
+		}
+		period.dirty = true
+	}
+}
+
+// Drop the days older than `SLA_DAYS` and the weeks older than `SLA_WEEKS`.
+func pruneAvailability(now time.Time) {
+	maxAge := map[string]time.Time{
+		AvailabilityPeriodDay:  now.AddDate(0, 0, -env.Int("SLA_DAYS", 35)),
+		AvailabilityPeriodWeek: now.AddDate(0, 0, -7*env.Int("SLA_WEEKS", 10)),
+	}
+	for key, period := range availabilityPeriods {
+		if period.End < maxAge[period.Period].Unix() {
+			delete(availabilityPeriods, key)
+		}
+	}
+}
+
+// Create the report of a day or a week.
+func (period availabilityPeriod) report(now time.Time) AvailabilityReport {
+	report := AvailabilityReport{
+		Period:        period.Period,
+		Name:          period.Name,
+		Start:         period.Start,
+		End:           period.End,
+		UpdateTime:    now.Unix(),
+		Complete:      now.Unix() >= period.End,
+		Samples:       period.Total.Samples,
+		Availability:  period.Total.share(),
+		Things:        make([]AvailabilityEntry, 0, len(period.Things)),
+		Intersections: make([]AvailabilityEntry, 0, len(period.Intersections)),
+		LaneTypes:     make([]AvailabilityEntry, 0, len(period.LaneTypes)),
+		HoursOfDay:    make([]AvailabilityEntry, 0, len(period.Hours)),
+	}
+	for name, counts := range period.Things {
+		report.Things = append(report.Things, AvailabilityEntry{
+			Name:         name,
+			Intersection: counts.Intersection,
+			LaneType:     counts.LaneType,
+			Samples:      counts.Samples,
+			Availability: counts.share(),
+		})
+	}
+	for name, counts := range period.Intersections {
+		report.Intersections = append(report.Intersections, AvailabilityEntry{Name: name, Samples: counts.Samples, Availability: counts.share()})
+	}
+	for name, counts := range period.LaneTypes {
+		report.LaneTypes = append(report.LaneTypes, AvailabilityEntry{Name: name, Samples: counts.Samples, Availability: counts.share()})
+	}
+	for hour, counts := range period.Hours {
+		report.HoursOfDay = append(report.HoursOfDay, AvailabilityEntry{Name: fmt.Sprintf("%02d:00", hour), Samples: counts.Samples, Availability: counts.share()})
+	}
+	for _, entries := range [][]AvailabilityEntry{report.Things, report.Intersections, report.LaneTypes} {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+	}
+	return report
+}
+
+// Encode the report as csv, with one row per thing, intersection, lane type and hour of the day.
+func (report AvailabilityReport) csv() ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	rows := [][]string{{"section", "name", "intersection", "lane_type", "samples", "availability"}}
+	rows = append(rows, []string{"total", report.Name, "", "", strconv.Itoa(report.Samples), formatShare(report.Availability)})
+	sections := []struct {
+		name    string
+		entries []AvailabilityEntry
+	}{
+		{"thing", report.Things},
+		{"intersection", report.Intersections},
+		{"lane_type", report.LaneTypes},
+		{"hour_of_day", report.HoursOfDay},
+	}
+	for _, section := range sections {
+		for _, entry := range section.entries {
+			rows = append(rows, []string{
+				section.name,
+				entry.Name,
+				entry.Intersection,
+				entry.LaneType,
+				strconv.Itoa(entry.Samples),
+				formatShare(entry.Availability),
+			})
+		}
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Format a share with four decimals, or as an empty string if there is none.
+func formatShare(share *float64) string {
+	if share == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*share, 'f', 4, 64)
+}
+
+// A self-contained html page of an availability report.
+var availabilityTemplate = template.Must(template.New("availability").Funcs(template.FuncMap{
+	"percent": func(share *float64) string {
+		if share == nil {
+			return "–"
+		}
+		return fmt.Sprintf("%.1f %%", *share*100)
+	},
+	"width": func(share *float64) string {
+		if share == nil {
+			return "0"
+		}
+		return fmt.Sprintf("%.1f", *share*100)
+	},
+	"time": func(unix int64) string {
+		return time.Unix(unix, 0).In(availabilityLocation()).Format("2006-01-02 15:04 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Prediction availability {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 0.2em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+td.number { text-align: right; }
+.bar { background: #eee; width: 10em; height: 0.8em; }
+.bar div { background: #2a9d8f; height: 100%; }
+</style>
+</head>
+<body>
+<h1>Prediction availability {{.Name}}</h1>
+<p>{{.Period}} from {{time .Start}} to {{time .End}}, updated {{time .UpdateTime}}{{if not .Complete}} (in progress){{end}}.</p>
+<p>Share of monitor runs with a fresh, good-quality prediction: <strong>{{percent .Availability}}</strong> ({{.Samples}} samples).</p>
+{{define "entries"}}
+<table>
+<tr><th>Name</th><th>Samples</th><th>Availability</th><th></th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td class="number">{{.Samples}}</td><td class="number">{{percent .Availability}}</td><td><div class="bar"><div style="width: {{width .Availability}}%"></div></div></td></tr>
+{{end}}</table>
+{{end}}
+<h2>By lane type</h2>
+{{template "entries" .LaneTypes}}
+<h2>By hour of the day</h2>
+{{template "entries" .HoursOfDay}}
+<h2>By intersection</h2>
+{{template "entries" .Intersections}}
+<h2>By thing</h2>
+<table>
+<tr><th>Name</th><th>Intersection</th><th>Lane type</th><th>Samples</th><th>Availability</th><th></th></tr>
+{{range .Things}}<tr><td>{{.Name}}</td><td>{{.Intersection}}</td><td>{{.LaneType}}</td><td class="number">{{.Samples}}</td><td class="number">{{percent .Availability}}</td><td><div class="bar"><div style="width: {{width .Availability}}%"></div></div></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// Write a file to the static directory and push it to the workers.
+func writeStaticFile(staticPath string, name string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(staticPath+name), 0755); err != nil {
+		log.Error.Println("Error creating directory for report:", err)
+		return
+	}
+	ioutil.WriteFile(staticPath+name, data, 0644)
+	PushFile(data, name)
+}
+
+// Count the availability of each thing in the last monitor run and write the reports of the changed days and weeks
+// as json, csv and html every `SLA_REPORT_INTERVAL`. The index of all reports is written to `sla/index.json`.
+func WriteAvailabilityReports() {
+	// Fetch the path under which we will save the json files.
+	staticPath := os.Getenv("STATIC_PATH")
+	if staticPath == "" {
+		panic("STATIC_PATH not set")
+	}
+
+	availabilityMutex.Lock()
+	defer availabilityMutex.Unlock()
+
+	if !availabilityLoaded {
+		loaded := make(map[string]*availabilityPeriod)
+		if data.Load(availabilityFile, &loaded) {
+			availabilityPeriods = loaded
+			for _, period := range availabilityPeriods {
+				period.dirty = true
+			}
+		}
+		availabilityLoaded = true
+	}
+
+	now := clock.Now().In(availabilityLocation())
+	recordAvailability(now)
+	pruneAvailability(now)
+
+	if now.Sub(lastAvailabilityReport) < env.Duration("SLA_REPORT_INTERVAL", 15*time.Minute) {
+		return
+	}
+	lastAvailabilityReport = now
+
+	index := make([]AvailabilityReportFiles, 0, len(availabilityPeriods))
+	for _, period := range availabilityPeriods {
+		base := "sla/" + period.Period + "/" + period.Name
+		index = append(index, AvailabilityReportFiles{
+			Period: period.Period,
+			Name:   period.Name,
+			Start:  period.Start,
+			Json:   base + ".json",
+			Csv:    base + ".csv",
+			Html:   base + ".html",
+		})
+		if !period.dirty {
+			continue
+		}
+		period.dirty = false
+
+		report := period.report(now)
+		reportJson, err := json.Marshal(report)
+		if err != nil {
+			log.Error.Println("Error marshalling availability report:", err)
+			continue
+		}
+		writeStaticFile(staticPath, base+".json", reportJson)
+		reportCsv, err := report.csv()
+		if err != nil {
+			log.Error.Println("Error encoding availability report as csv:", err)
+			continue
+		}
+		writeStaticFile(staticPath, base+".csv", reportCsv)
+		var reportHtml bytes.Buffer
+		if err := availabilityTemplate.Execute(&reportHtml, report); err != nil {
+			log.Error.Println("Error rendering availability report as html:", err)
+			continue
+		}
+		writeStaticFile(staticPath, base+".html", reportHtml.Bytes())
+	}
+	sort.Slice(index, func(i, j int) bool {
+		if index[i].Start != index[j].Start {
+			return index[i].Start > index[j].Start
+		}
+		return index[i].Period < index[j].Period
+	})
+	indexJson, err := json.Marshal(index)
+	if err != nil {
+		log.Error.Println("Error marshalling availability report index:", err)
+		return
+	}
+	writeStaticFile(staticPath, "sla/index.json", indexJson)
+
+	data.Store(availabilityFile, availabilityPeriods)
+}
+
+// Create Prometheus metrics with the availability of the current day and week, overall and by lane type.
+func availabilityMetrics() []string {
+	availabilityMutex.Lock()
+	defer availabilityMutex.Unlock()
+	metrics := make([]string, 0)
+	for _, current := range periodsAt(clock.Now().In(availabilityLocation())) {
+		period, ok := availabilityPeriods[current.Period+"/"+current.Name]
+		if !ok || period.Total.share() == nil {
+			continue
+		}
+		metrics = append(metrics, fmt.Sprintf("prediction_monitor_availability{period=\"%s\"} %f", period.Period, *period.Total.share()))
+		laneTypes := make([]string, 0, len(period.LaneTypes))
+		for laneType := range period.LaneTypes {
+			laneTypes = append(laneTypes, laneType)
+		}
+		sort.Strings(laneTypes)
+		for _, laneType := range laneTypes {
+			if share := period.LaneTypes[laneType].share(); share != nil {
+				metrics = append(metrics, fmt.Sprintf("prediction_monitor_lane_type_availability{period=\"%s\",lane_type=\"%s\"} %f", period.Period, laneType, *share))
+			}
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,60 @@
+package status
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadAvailabilityLocation(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "Europe/Berlin"},
+		{"Europe/Lisbon", "Europe/Lisbon"},
+		{"UTC", "UTC"},
+		{"Mars/Olympus", "UTC"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("SLA_TIMEZONE", test.value)
+			if got := loadAvailabilityLocation().String(); got != test.want {
+				t.Errorf("loadAvailabilityLocation = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPeriodsAt(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		time      time.Time
+		day       string
+		dayHours  float64
+		week      string
+		weekStart time.Time
+	}{
+		{"midweek", time.Date(2023, 5, 3, 12, 0, 0, 0, berlin), "2023-05-03", 24, "2023-W18", time.Date(2023, 5, 1, 0, 0, 0, 0, berlin)},
+		{"monday midnight", time.Date(2023, 5, 1, 0, 0, 0, 0, berlin), "2023-05-01", 24, "2023-W18", time.Date(2023, 5, 1, 0, 0, 0, 0, berlin)},
+		{"sunday night", time.Date(2023, 5, 7, 23, 59, 0, 0, berlin), "2023-05-07", 24, "2023-W18", time.Date(2023, 5, 1, 0, 0, 0, 0, berlin)},
+		{"start of daylight saving time", time.Date(2023, 3, 26, 12, 0, 0, 0, berlin), "2023-03-26", 23, "2023-W12", time.Date(2023, 3, 20, 0, 0, 0, 0, berlin)},
+		{"end of daylight saving time", time.Date(2023, 10, 29, 12, 0, 0, 0, berlin), "2023-10-29", 25, "2023-W43", time.Date(2023, 10, 23, 0, 0, 0, 0, berlin)},
+		{"iso week of the previous year", time.Date(2023, 1, 1, 12, 0, 0, 0, berlin), "2023-01-01", 24, "2022-W52", time.Date(2022, 12, 26, 0, 0, 0, 0, berlin)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			periods := periodsAt(test.time)
+			day, week := periods[0], periods[1]
+			if day.Name != test.day || float64(day.End-day.Start)/3600 != test.dayHours {
+				t.Errorf("Day = %s with %f hours, want %s with %f hours", day.Name, float64(day.End-day.Start)/3600, test.day, test.dayHours)
+			}
+			if week.Name != test.week || week.Start != test.weekStart.Unix() {
+				t.Errorf("Week = %s from %v, want %s from %v", week.Name, time.Unix(week.Start, 0).In(berlin), test.week, test.weekStart)
+			}
+		})
+	}
+}
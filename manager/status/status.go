@@ -1,24 +1,35 @@
 package status
 
 import (
+	"monitor/clock"
 	"monitor/log"
+	"monitor/predictions"
 	"time"
 )
 
 // Continuously log out interesting things.
 func Monitor() {
 	log.Info.Println("Starting monitor...")
+	// Drop the state of evicted topics together with the prediction state.
+	predictions.OnEvict(forgetUnusable)
 	// Wait a bit initially to let the sync service do its job.
-	time.Sleep(20 * time.Second)
+	clock.Sleep(20 * time.Second)
 	for {
 		log.Info.Println("Running monitor...")
 
+		EvaluateHealth()
+		WriteOutageClusters()
 		WriteSummary()
+		WriteIncidents()
+		WriteAvailabilityReports()
+		WriteReconciliation()
 		WriteGeoJSONMap()
 		WriteStatusForEachSG()
+		WriteThingsCatalogue()
+		WriteThingsQuality()
 
 		log.Info.Println("Done running monitor.")
 		// Sleep for 1 minute.
-		time.Sleep(1 * time.Minute)
+		clock.Sleep(1 * time.Minute)
 	}
 }
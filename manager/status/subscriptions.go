@@ -0,0 +1,15 @@
+package status
+
+import (
+	"fmt"
+	"monitor/predictions"
+)
+
+// Create Prometheus metrics with the number of subscriptions and the traffic on unknown topics.
+func subscriptionMetrics() []string {
+	return []string{
+		fmt.Sprintf("prediction_monitor_subscriptions %d", predictions.NumSubscriptions()),
+		fmt.Sprintf("prediction_monitor_unknown_topics %d", len(predictions.UnknownTopics())),
+		fmt.Sprintf("prediction_monitor_unknown_topic_messages_total %d", predictions.UnknownMessages()),
+	}
+}
@@ -3,11 +3,11 @@ package status
 import (
 	"encoding/json"
 	"io/ioutil"
+	"monitor/clock"
 	"monitor/log"
 	"monitor/predictions"
 	"monitor/sync"
 	"os"
-	"time"
 )
 
 // A status summary of all predictions that is written to json.
@@ -18,14 +18,40 @@ type StatusSummary struct {
 	NumThings int `json:"num_things"`
 	// The number of predictions.
 	NumPredictions int `json:"num_predictions"`
-	// The number of predictions with quality <= 0.5.
+	// The number of predictions with quality <= 0.5, without expected darkness.
 	NumBadPredictions int `json:"num_bad_predictions"`
 	// The time of the most recent prediction.
 	MostRecentPredictionTime int64 `json:"most_recent_prediction_time"`
 	// The time of the oldest prediction.
 	OldestPredictionTime int64 `json:"oldest_prediction_time"`
-	// The average prediction quality.
+	// The average prediction quality, without expected darkness.
 	AveragePredictionQuality float64 `json:"average_prediction_quality"`
+	// The number of predictions whose forward horizon is expired or too short.
+	NumUnusablePredictions int `json:"num_unusable_predictions"`
+	// The number of topics whose current gap far exceeds their own publishing cadence.
+	NumSilentTopics int `json:"num_silent_topics"`
+	// The number of topics whose last prediction has timestamps in the future.
+	NumFuturePredictions int `json:"num_future_predictions"`
+	// The distribution of the recent generation-to-receive latencies of all topics in seconds.
+	Latency predictions.Distribution `json:"latency"`
+	// The distribution of the recent offsets of the start time from the receive time of all topics in seconds.
+	Skew predictions.Distribution `json:"skew"`
+	// The number of messages that could not be parsed since startup, by the failing part.
+	ParseFailures map[string]int `json:"parse_failures"`
+	// The number of topics with at least one parse failure since startup.
+	NumTopicsWithParseFailures int `json:"num_topics_with_parse_failures"`
+	// The number of things in a planned maintenance window.
+	NumMaintenance int `json:"num_maintenance"`
+	// The number of things that are unhealthy, but usually are at this hour of the week.
+	NumExpectedOff int `json:"num_expected_off"`
+	// The number of things that are unhealthy, but usually aren't at this hour of the week.
+	NumUnexpectedOutages int `json:"num_unexpected_outages"`
+	// The number of unexpected outages by root cause, e.g. "upstream_data" or "prediction_service".
+	RootCauses map[string]int `json:"root_causes"`
+	// The number of distinct outage events, i.e. clusters of concurrent outages with a likely common cause and isolated outages.
+	NumOutageEvents int `json:"num_outage_events"`
+	// The descriptions of the outage clusters, largest first, e.g. "controller 123 down, 14 signal groups affected".
+	OutageEvents []string `json:"outage_events"`
 }
 
 // Create a summary of the predictions, i.e. whether they are up to date.
@@ -47,12 +73,40 @@ func WriteSummary() {
 
 	numThings := len(sync.Things)
 
+	// Things that are unhealthy at an hour of the week at which they usually are, e.g. switched off at night,
+	// and things in a planned maintenance window are not counted as bad.
+	numMaintenance := 0
+	numExpectedOff := 0
+	numUnexpectedOutages := 0
+	excluded := make(map[string]bool)
+	rootCauses := make(map[string]int, len(RootCauses))
+	for _, cause := range RootCauses {
+		rootCauses[cause] = 0
+	}
+	for _, health := range healthList() {
+		switch health.Classification {
+		case ClassificationMaintenance:
+			numMaintenance++
+			excluded[health.Topic] = true
+		case ClassificationExpectedOff:
+			numExpectedOff++
+			excluded[health.Topic] = true
+		case ClassificationUnexpectedOutage:
+			numUnexpectedOutages++
+			rootCauses[health.RootCause]++
+		}
+	}
+
 	// Filter the predictions such that only predictions are counted that are not older than 3 minutes.
 	// Also count the number of predictions.
 	numPredictions := 0
-	for _, timestamp := range predictions.Timestamps {
-		if time.Now().Unix()-timestamp < 3*60 {
+	numRatedPredictions := 0
+	for topic, timestamp := range predictions.Timestamps {
+		if clock.Now().Unix()-timestamp < 3*60 {
 			numPredictions++
+			if !excluded[topic] {
+				numRatedPredictions++
+			}
 		}
 	}
 
@@ -68,16 +122,25 @@ func WriteSummary() {
 		}
 	}
 
-	// Calculate the average prediction quality and the number of bad predictions.
+	// Calculate the average prediction quality and the number of bad and unusable predictions.
 	var averagePredictionQuality float64 = 0
 	numBadPredictions := 0
-	if numPredictions > 0 {
+	numUnusablePredictions := 0
+	if numRatedPredictions > 0 {
 		var sum float64 = 0
 		for topic, prediction := range predictions.Current {
 			// Only look at predictions that are not older than 3 minutes.
-			if time.Now().Unix()-predictions.Timestamps[topic] > 3*60 {
+			if clock.Now().Unix()-predictions.Timestamps[topic] > 3*60 {
 				continue
 			}
+			// Don't rate predictions of things that are expected to be off or in maintenance.
+			if excluded[topic] {
+				continue
+			}
+			// Check whether the prediction still covers enough seconds ahead.
+			if _, horizonState := prediction.HorizonState(predictions.Timestamps[topic], clock.Now().Unix()); horizonState != predictions.HorizonOk {
+				numUnusablePredictions++
+			}
 			if prediction.PredictionQuality <= 0.5 {
 				numBadPredictions++
 			}
@@ -91,18 +154,43 @@ func WriteSummary() {
 			}
 			sum += prediction.PredictionQuality
 		}
-		averagePredictionQuality = sum / float64(numPredictions)
+		averagePredictionQuality = sum / float64(numRatedPredictions)
 	}
 
+	// Group the outages into events, such that a failed controller is reported once instead of for each signal group.
+	ClustersMutex.Lock()
+	numOutageEvents := len(Clusters.Clusters) + len(Clusters.Isolated)
+	outageEvents := make([]string, 0, len(Clusters.Clusters))
+	for _, cluster := range Clusters.Clusters {
+		outageEvents = append(outageEvents, cluster.Message)
+	}
+	ClustersMutex.Unlock()
+
+	latency, skew := predictions.OverallLatency()
+	parseFailures, numTopicsWithParseFailures := predictions.TotalParseFailures()
+
 	// Write the status update to a json file.
 	summary := StatusSummary{
-		StatusUpdateTime:         time.Now().Unix(),
-		NumThings:                numThings,
-		NumPredictions:           numPredictions,
-		NumBadPredictions:        numBadPredictions,
-		MostRecentPredictionTime: mostRecentPredictionTime,
-		OldestPredictionTime:     oldestPredictionTime,
-		AveragePredictionQuality: averagePredictionQuality,
+		StatusUpdateTime:           clock.Now().Unix(),
+		NumThings:                  numThings,
+		NumPredictions:             numPredictions,
+		NumBadPredictions:          numBadPredictions,
+		MostRecentPredictionTime:   mostRecentPredictionTime,
+		OldestPredictionTime:       oldestPredictionTime,
+		AveragePredictionQuality:   averagePredictionQuality,
+		NumUnusablePredictions:     numUnusablePredictions,
+		NumSilentTopics:            predictions.CountSilentTopics(clock.Now()),
+		NumFuturePredictions:       predictions.CountFuturePredictions(),
+		Latency:                    latency,
+		Skew:                       skew,
+		ParseFailures:              parseFailures,
+		NumTopicsWithParseFailures: numTopicsWithParseFailures,
+		NumMaintenance:             numMaintenance,
+		NumExpectedOff:             numExpectedOff,
+		NumUnexpectedOutages:       numUnexpectedOutages,
+		RootCauses:                 rootCauses,
+		NumOutageEvents:            numOutageEvents,
+		OutageEvents:               outageEvents,
 	}
 
 	// Write the status update to the file.
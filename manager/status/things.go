@@ -0,0 +1,64 @@
+package status
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"monitor/log"
+	"monitor/sync"
+	"os"
+	"sort"
+)
+
+// An entry of the thing catalogue that is written to json.
+type ThingEntry struct {
+	// The name of the thing.
+	ThingName string `json:"thing_name"`
+	// The mqtt topic of the predictions for the thing.
+	Topic string `json:"topic"`
+	// The latitude of the stop line of the thing.
+	Lat float64 `json:"lat"`
+	// The longitude of the stop line of the thing.
+	Lng float64 `json:"lng"`
+	// The published metadata of the thing.
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Write a catalogue of all things with their metadata.
+// Clients can use it to join the monitor data with other traffic light data.
+func WriteThingsCatalogue() {
+	// Fetch the path under which we will save the json files.
+	staticPath := os.Getenv("STATIC_PATH")
+	if staticPath == "" {
+		panic("STATIC_PATH not set")
+	}
+
+	// Lock resources.
+	sync.ThingsMutex.Lock()
+	catalogue := make([]ThingEntry, 0, len(sync.Things))
+	for _, thing := range sync.Things {
+		stopLine, err := thing.StopLine()
+		if err != nil {
+			continue
+		}
+		catalogue = append(catalogue, ThingEntry{
+			ThingName:  thing.Name,
+			Topic:      thing.Topic(),
+			Lat:        stopLine[1],
+			Lng:        stopLine[0],
+			Properties: thing.Metadata(),
+		})
+	}
+	sync.ThingsMutex.Unlock()
+
+	sort.Slice(catalogue, func(i, j int) bool {
+		return catalogue[i].ThingName < catalogue[j].ThingName
+	})
+
+	catalogueJson, err := json.Marshal(catalogue)
+	if err != nil {
+		log.Error.Println("Error marshalling things catalogue:", err)
+		return
+	}
+	ioutil.WriteFile(staticPath+"things.json", catalogueJson, 0644)
+	PushFile(catalogueJson, "things.json")
+}
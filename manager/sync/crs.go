@@ -0,0 +1,221 @@
+package sync
+
+import (
+	"fmt"
+	"math"
+	"monitor/env"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A named coordinate reference system of a GeoJSON object (GeoJSON 2008).
+type Crs struct {
+	Type       string `json:"type"`
+	Properties struct {
+		Name string `json:"name"`
+	} `json:"properties"`
+}
+
+// The EPSG code of WGS84 lon/lat coordinates, as used in the outputs.
+const epsgWGS84 = 4326
+
+// Matches EPSG codes in CRS names like `EPSG:25832`, `urn:ogc:def:crs:EPSG::25832`
+// or `http://www.opengis.net/def/crs/EPSG/0/25832`.
+var epsgPattern = regexp.MustCompile(`(?i)EPSG(?::|::|/0/)(\d+)`)
+
+// Parse the EPSG code from a CRS declaration. `CRS84` is treated as WGS84.
+func parseEpsg(declaration string) (int, bool) {
+	if strings.Contains(strings.ToUpper(declaration), "CRS84") {
+		return epsgWGS84, true
+	}
+	match := epsgPattern.FindStringSubmatch(declaration)
+	if match == nil {
+		return 0, false
+	}
+	code, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+	return code, true
+}
+
+// Get the EPSG code of the coordinates of a location. The CRS is taken from the `crs` member
+// of the geometry or the feature, from the encoding type, or from `SENSORTHINGS_CRS` (default WGS84).
+func (location Location) Epsg() (int, error) {
+	declarations := []string{location.EncodingType}
+	if location.Location.Crs != nil {
+		declarations = append([]string{location.Location.Crs.Properties.Name}, declarations...)
+	}
+	if location.Location.Geometry.Crs != nil {
+		declarations = append([]string{location.Location.Geometry.Crs.Properties.Name}, declarations...)
+	}
+	for _, declaration := range declarations {
+		if code, ok := parseEpsg(declaration); ok {
+			return code, nil
+		}
+	}
+	configured := env.String("SENSORTHINGS_CRS", "EPSG:4326")
+	code, ok := parseEpsg(configured)
+	if !ok {
+		return 0, fmt.Errorf("invalid SENSORTHINGS_CRS: %s", configured)
+	}
+	return code, nil
+}
+
+// Reproject the coordinates of all locations of a thing to WGS84 lon/lat in place.
+// Supported are WGS84 (EPSG:4326), Web Mercator (EPSG:3857) and the UTM zones
+// of ETRS89 (EPSG:25828-25838) and WGS84 (EPSG:32601-32660, EPSG:32701-32760).
+func (thing *Thing) Reproject() error {
+	for i := range thing.Locations {
+		location := &thing.Locations[i]
+		code, err := location.Epsg()
+		if err != nil {
+			return err
+		}
+		transform, err := transformation(code)
+		if err != nil {
+			return fmt.Errorf("location of thing %s: %v", thing.Name, err)
+		}
+		for _, line := range location.Location.Geometry.Coordinates {
+			for _, coordinate := range line {
+				if len(coordinate) < 2 {
+					return fmt.Errorf("location of thing %s has a coordinate with less than two values", thing.Name)
+				}
+				coordinate[0], coordinate[1] = transform(coordinate[0], coordinate[1])
+				if math.Abs(coordinate[0]) > 180 || math.Abs(coordinate[1]) > 90 {
+					return fmt.Errorf("location of thing %s has coordinates outside of EPSG:%d, is SENSORTHINGS_CRS set correctly?", thing.Name, code)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Get the transformation from the given EPSG code to WGS84 lon/lat.
+func transformation(code int) (func(x float64, y float64) (float64, float64), error) {
+	switch {
+	case code == epsgWGS84:
+		return func(x float64, y float64) (float64, float64) { return x, y }, nil
+	case code == 3857:
+		return webMercatorToWGS84, nil
+	case code >= 25828 && code <= 25838:
+		return utmToWGS84(code-25800, true), nil
+	case code >= 32601 && code <= 32660:
+		return utmToWGS84(code-32600, true), nil
+	case code >= 32701 && code <= 32760:
+		return utmToWGS84(code-32700, false), nil
+	}
+	return nil, fmt.Errorf("unsupported coordinate reference system EPSG:%d", code)
+}
+
+// The semi-major axis and flattening of the WGS84 ellipsoid (GRS80 differs negligibly).
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+)
+
+// Convert Web Mercator coordinates to WGS84 lon/lat.
+func webMercatorToWGS84(x float64, y float64) (float64, float64) {
+	lng := x / wgs84A * 180 / math.Pi
+	lat := (2*math.Atan(math.Exp(y/wgs84A)) - math.Pi/2) * 180 / math.Pi
+	return lng, lat
+}
+
+// Get the conversion of UTM coordinates of the given zone to WGS84 lon/lat.
+// The inverse transverse mercator projection follows Snyder, Map Projections (1987).
+func utmToWGS84(zone int, north bool) func(easting float64, northing float64) (float64, float64) {
+	const k0 = 0.9996
+	e2 := wgs84F * (2 - wgs84F)
+	ep2 := e2 / (1 - e2)
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	lng0 := float64((zone-1)*6-180+3) * math.Pi / 180
+
+	return func(easting float64, northing float64) (float64, float64) {
+		x := easting - 500000
+		y := northing
+		if !north {
+			y -= 10000000
+		}
+		m := y / k0
+		mu := m / (wgs84A * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+		phi1 := mu +
+			(3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+			(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+			(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+			(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+		sinPhi1, cosPhi1, tanPhi1 := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+		n1 := wgs84A / math.Sqrt(1-e2*sinPhi1*sinPhi1)
+		t1 := tanPhi1 * tanPhi1
+		c1 := ep2 * cosPhi1 * cosPhi1
+		r1 := wgs84A * (1 - e2) / math.Pow(1-e2*sinPhi1*sinPhi1, 1.5)
+		d := x / (n1 * k0)
+
+		lat := phi1 - (n1*tanPhi1/r1)*(d*d/2-
+			(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+			(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+		lng := lng0 + (d-
+			(1+2*t1+c1)*math.Pow(d, 3)/6+
+			(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120)/cosPhi1
+		return lng * 180 / math.Pi, lat * 180 / math.Pi
+	}
+}
+
+// A WGS84 bounding box `minLng,minLat,maxLng,maxLat`.
+type boundingBox [4]float64
+
+// The service area, or nil if all coordinates are accepted.
+// The service area is configured with `SERVICE_AREA` as a WGS84 bounding box `minLng,minLat,maxLng,maxLat`.
+// An invalid service area stops the manager at startup, instead of dropping things later.
+var serviceArea = loadServiceArea()
+
+// Load the service area from `SERVICE_AREA`.
+func loadServiceArea() *boundingBox {
+	box, err := parseServiceArea(env.List("SERVICE_AREA"))
+	if err != nil {
+		panic(err.Error())
+	}
+	return box
+}
+
+// Parse the bounds of a service area. Returns nil if no bounds are given.
+func parseServiceArea(bounds []string) (*boundingBox, error) {
+	if bounds == nil {
+		return nil, nil
+	}
+	if len(bounds) != 4 {
+		return nil, fmt.Errorf("SERVICE_AREA must contain minLng,minLat,maxLng,maxLat")
+	}
+	var box boundingBox
+	for i, bound := range bounds {
+		value, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SERVICE_AREA: %v", err)
+		}
+		box[i] = value
+	}
+	if box[0] > box[2] || box[1] > box[3] {
+		return nil, fmt.Errorf("invalid SERVICE_AREA: the minimum must not exceed the maximum")
+	}
+	return &box, nil
+}
+
+// Check whether all coordinates of a thing lie within the service area.
+// If no service area is configured, all coordinates are accepted.
+func (thing Thing) InServiceArea() bool {
+	if serviceArea == nil {
+		return true
+	}
+	box := *serviceArea
+	for _, location := range thing.Locations {
+		for _, line := range location.Location.Geometry.Coordinates {
+			for _, coordinate := range line {
+				if coordinate[0] < box[0] || coordinate[1] < box[1] || coordinate[0] > box[2] || coordinate[1] > box[3] {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
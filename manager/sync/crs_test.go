@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Project WGS84 lon/lat to UTM, independently of the inverse projection under test.
+// The forward transverse mercator projection follows Snyder, Map Projections (1987).
+func wgs84ToUtm(zone int, north bool, lng float64, lat float64) (float64, float64) {
+	const k0 = 0.9996
+	e2 := wgs84F * (2 - wgs84F)
+	ep2 := e2 / (1 - e2)
+	phi := lat * math.Pi / 180
+	lambda := lng * math.Pi / 180
+	lambda0 := float64((zone-1)*6-180+3) * math.Pi / 180
+
+	n := wgs84A / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+	t := math.Tan(phi) * math.Tan(phi)
+	c := ep2 * math.Cos(phi) * math.Cos(phi)
+	a := (lambda - lambda0) * math.Cos(phi)
+	m := wgs84A * ((1-e2/4-3*e2*e2/64-5*e2*e2*e2/256)*phi -
+		(3*e2/8+3*e2*e2/32+45*e2*e2*e2/1024)*math.Sin(2*phi) +
+		(15*e2*e2/256+45*e2*e2*e2/1024)*math.Sin(4*phi) -
+		(35*e2*e2*e2/3072)*math.Sin(6*phi))
+
+	easting := 500000 + k0*n*(a+(1-t+c)*math.Pow(a, 3)/6+(5-18*t+t*t+72*c-58*ep2)*math.Pow(a, 5)/120)
+	northing := k0 * (m + n*math.Tan(phi)*(a*a/2+(5-t+9*c+4*c*c)*math.Pow(a, 4)/24+(61-58*t+t*t+600*c-330*ep2)*math.Pow(a, 6)/720))
+	if !north {
+		northing += 10000000
+	}
+	return easting, northing
+}
+
+func TestTransformation(t *testing.T) {
+	tests := []struct {
+		name string
+		epsg int
+		x    float64
+		y    float64
+		lng  float64
+		lat  float64
+	}{
+		{"wgs84 is unchanged", 4326, 9.99, 53.55, 9.99, 53.55},
+		{"web mercator origin", 3857, 0, 0, 0, 0},
+		{"web mercator antimeridian", 3857, 20037508.342789244, 0, 180, 0},
+		{"web mercator maximum latitude", 3857, 0, 20037508.342789244, 0, 85.0511287798},
+		{"etrs89 utm central meridian on the equator", 25832, 500000, 0, 9, 0},
+		{"wgs84 utm central meridian on the equator", 32633, 500000, 0, 15, 0},
+		{"wgs84 utm south central meridian on the equator", 32733, 500000, 10000000, 15, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transform, err := transformation(test.epsg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lng, lat := transform(test.x, test.y)
+			if math.Abs(lng-test.lng) > 1e-8 || math.Abs(lat-test.lat) > 1e-8 {
+				t.Errorf("transform(%f, %f) = %f, %f, want %f, %f", test.x, test.y, lng, lat, test.lng, test.lat)
+			}
+		})
+	}
+}
+
+// Project points across the zones to UTM and back. The results must agree to about a centimetre.
+func TestUtmRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		epsg  int
+		zone  int
+		north bool
+		lng   float64
+		lat   float64
+	}{
+		{"hamburg etrs89", 25832, 32, true, 9.9937, 53.5511},
+		{"hamburg west of the central meridian", 25832, 32, true, 8.5, 53.5},
+		{"hamburg at the zone edge", 25832, 32, true, 11.99, 53.6},
+		{"munich in the neighbouring zone", 25833, 33, true, 11.5761, 48.1372},
+		{"lisbon", 25829, 29, true, -9.1393, 38.7223},
+		{"oslo wgs84", 32632, 32, true, 10.7522, 59.9139},
+		{"near the equator", 32631, 31, true, 4.2, 0.01},
+		{"sydney", 32756, 56, false, 151.2093, -33.8688},
+		{"cape town", 32734, 34, false, 18.4241, -33.9249},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transform, err := transformation(test.epsg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lng, lat := transform(wgs84ToUtm(test.zone, test.north, test.lng, test.lat))
+			if math.Abs(lng-test.lng) > 1e-7 || math.Abs(lat-test.lat) > 1e-7 {
+				t.Errorf("Round trip of %f, %f = %f, %f", test.lng, test.lat, lng, lat)
+			}
+		})
+	}
+}
+
+func TestTransformationUnsupported(t *testing.T) {
+	for _, epsg := range []int{0, 31467, 25827, 25839, 32600, 32661, 32700, 32761} {
+		if _, err := transformation(epsg); err == nil {
+			t.Errorf("Expected EPSG:%d to be unsupported", epsg)
+		}
+	}
+}
+
+func TestParseEpsg(t *testing.T) {
+	tests := []struct {
+		declaration string
+		epsg        int
+		ok          bool
+	}{
+		{"EPSG:25832", 25832, true},
+		{"epsg:25832", 25832, true},
+		{"urn:ogc:def:crs:EPSG::25832", 25832, true},
+		{"http://www.opengis.net/def/crs/EPSG/0/3857", 3857, true},
+		{"urn:ogc:def:crs:OGC:1.3:CRS84", 4326, true},
+		{"application/vnd.geo+json", 0, false},
+		{"", 0, false},
+		{"EPSG:", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.declaration, func(t *testing.T) {
+			epsg, ok := parseEpsg(test.declaration)
+			if epsg != test.epsg || ok != test.ok {
+				t.Errorf("parseEpsg(%q) = %d, %v, want %d, %v", test.declaration, epsg, ok, test.epsg, test.ok)
+			}
+		})
+	}
+}
+
+// Decode a location from its SensorThings JSON representation.
+func locationFromJson(t *testing.T, body string) Location {
+	t.Helper()
+	var location Location
+	if err := json.Unmarshal([]byte(body), &location); err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestEpsg(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		location   string
+		epsg       int
+	}{
+		{"default", "", `{"encodingType": "application/vnd.geo+json"}`, 4326},
+		{"configured", "EPSG:25832", `{"encodingType": "application/vnd.geo+json"}`, 25832},
+		{"encoding type", "EPSG:25832", `{"encodingType": "EPSG:3857"}`, 3857},
+		{"feature crs", "EPSG:25832", `{"encodingType": "EPSG:3857", "location": {"crs": {"type": "name", "properties": {"name": "EPSG:25833"}}}}`, 25833},
+		{"geometry crs", "", `{"location": {"crs": {"type": "name", "properties": {"name": "EPSG:25833"}}, "geometry": {"crs": {"type": "name", "properties": {"name": "urn:ogc:def:crs:EPSG::32632"}}}}}`, 32632},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("SENSORTHINGS_CRS", test.configured)
+			epsg, err := locationFromJson(t, test.location).Epsg()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if epsg != test.epsg {
+				t.Errorf("Epsg = %d, want %d", epsg, test.epsg)
+			}
+		})
+	}
+}
+
+func TestReproject(t *testing.T) {
+	easting, northing := wgs84ToUtm(32, true, 9.9937, 53.5511)
+	tests := []struct {
+		name  string
+		crs   string
+		point []float64
+		ok    bool
+	}{
+		{"utm", "EPSG:25832", []float64{easting, northing}, true},
+		{"wgs84", "EPSG:4326", []float64{9.9937, 53.5511}, true},
+		{"utm coordinates declared as wgs84", "EPSG:4326", []float64{easting, northing}, false},
+		{"unsupported crs", "EPSG:31467", []float64{easting, northing}, false},
+		{"incomplete coordinate", "EPSG:4326", []float64{9.9937}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var thing Thing
+			thing.Name = "123_4"
+			location := Location{EncodingType: test.crs}
+			location.Location.Geometry.Coordinates = [][][]float64{{append([]float64{}, test.point...)}}
+			thing.Locations = []Location{location}
+			err := thing.Reproject()
+			if (err == nil) != test.ok {
+				t.Fatalf("Reproject error = %v, want ok %v", err, test.ok)
+			}
+			if !test.ok {
+				return
+			}
+			coordinate := thing.Locations[0].Location.Geometry.Coordinates[0][0]
+			if math.Abs(coordinate[0]-9.9937) > 1e-7 || math.Abs(coordinate[1]-53.5511) > 1e-7 {
+				t.Errorf("Reproject = %v, want [9.9937 53.5511]", coordinate)
+			}
+		})
+	}
+}
+
+func TestParseServiceArea(t *testing.T) {
+	tests := []struct {
+		name   string
+		bounds []string
+		want   *boundingBox
+		ok     bool
+	}{
+		{"not configured", nil, nil, true},
+		{"valid", []string{"9.7", "53.3", "10.4", "53.8"}, &boundingBox{9.7, 53.3, 10.4, 53.8}, true},
+		{"too few bounds", []string{"9.7", "53.3", "10.4"}, nil, false},
+		{"too many bounds", []string{"9.7", "53.3", "10.4", "53.8", "1"}, nil, false},
+		{"invalid bound", []string{"9.7", "53.3", "10.4", "north"}, nil, false},
+		{"swapped bounds", []string{"10.4", "53.8", "9.7", "53.3"}, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			box, err := parseServiceArea(test.bounds)
+			if (err == nil) != test.ok || !reflect.DeepEqual(box, test.want) {
+				t.Errorf("parseServiceArea = %v, %v, want %v, ok %v", box, err, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestInServiceArea(t *testing.T) {
+	hamburg := &boundingBox{9.7, 53.3, 10.4, 53.8}
+	tests := []struct {
+		name  string
+		area  *boundingBox
+		point []float64
+		in    bool
+	}{
+		{"not configured", nil, []float64{0, 0}, true},
+		{"inside", hamburg, []float64{9.99, 53.55}, true},
+		{"outside", hamburg, []float64{11.57, 48.13}, false},
+		{"on the border", hamburg, []float64{9.7, 53.3}, true},
+	}
+	defer func(previous *boundingBox) { serviceArea = previous }(serviceArea)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serviceArea = test.area
+			var thing Thing
+			location := Location{}
+			location.Location.Geometry.Coordinates = [][][]float64{{test.point}}
+			thing.Locations = []Location{location}
+			if in := thing.InServiceArea(); in != test.in {
+				t.Errorf("InServiceArea = %v, want %v", in, test.in)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"monitor/env"
+)
+
+// A datastream of a thing from the SensorThings API, e.g. the primary signal observations of the controller.
+type Datastream struct {
+	IotId      int    `json:"@iot.id"`
+	Name       string `json:"name"`
+	Properties struct {
+		LayerName string `json:"layerName"`
+	} `json:"properties"`
+}
+
+// The layer names of the datastreams whose observations show that the controller sends signal data.
+var observationLayers = getObservationLayers()
+
+// Get the layer names from `OBSERVATION_LAYERS`, by default `primary_signal`.
+func getObservationLayers() []string {
+	layers := env.List("OBSERVATION_LAYERS")
+	if len(layers) == 0 {
+		return []string{"primary_signal"}
+	}
+	return layers
+}
+
+// Get the datastreams of a thing whose observations show that the controller sends signal data.
+// These are the datastreams with a layer name in `OBSERVATION_LAYERS`, by default `primary_signal`.
+func (thing Thing) SourceDatastreams() []Datastream {
+	datastreams := make([]Datastream, 0)
+	for _, datastream := range thing.Datastreams {
+		for _, layer := range observationLayers {
+			if datastream.Properties.LayerName == layer {
+				datastreams = append(datastreams, datastream)
+				break
+			}
+		}
+	}
+	return datastreams
+}
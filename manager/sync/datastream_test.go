@@ -0,0 +1,62 @@
+package sync
+
+import "testing"
+
+func TestSourceDatastreams(t *testing.T) {
+	var thing Thing
+	for i, layer := range []string{"primary_signal", "signal_program", "detector_car", "primary_signal"} {
+		datastream := Datastream{IotId: i + 1}
+		datastream.Properties.LayerName = layer
+		thing.Datastreams = append(thing.Datastreams, datastream)
+	}
+
+	tests := []struct {
+		name   string
+		layers []string
+		want   []int
+	}{
+		{"default", []string{"primary_signal"}, []int{1, 4}},
+		{"multiple layers", []string{"signal_program", "detector_car"}, []int{2, 3}},
+		{"unknown layer", []string{"cycle_second"}, []int{}},
+	}
+	defer func(previous []string) { observationLayers = previous }(observationLayers)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			observationLayers = test.layers
+			datastreams := thing.SourceDatastreams()
+			if len(datastreams) != len(test.want) {
+				t.Fatalf("SourceDatastreams = %v, want ids %v", datastreams, test.want)
+			}
+			for i, datastream := range datastreams {
+				if datastream.IotId != test.want[i] {
+					t.Errorf("SourceDatastreams[%d] = %d, want %d", i, datastream.IotId, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetObservationLayers(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{"primary_signal"}},
+		{"signal_program", []string{"signal_program"}},
+		{" primary_signal , signal_program ,", []string{"primary_signal", "signal_program"}},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("OBSERVATION_LAYERS", test.value)
+			got := getObservationLayers()
+			if len(got) != len(test.want) {
+				t.Fatalf("getObservationLayers = %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("getObservationLayers = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
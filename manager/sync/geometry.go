@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"fmt"
+	"math"
+)
+
+// The names of the lane parts, in the order of the location geometry.
+var LanePartNames = []string{"ingress", "connection", "egress"}
+
+// A part of the lane of a thing.
+type LanePart struct {
+	// The name of the part: "ingress", "connection" or "egress".
+	Name string
+	// The coordinates of the part as [lng, lat].
+	Coordinates [][]float64
+}
+
+// Get all lane parts of a thing that have coordinates.
+// The location geometry is a MultiLineString of the ingress, connection and egress lane.
+func (thing Thing) LaneParts() []LanePart {
+	parts := make([]LanePart, 0, len(LanePartNames))
+	if len(thing.Locations) == 0 {
+		return parts
+	}
+	lanes := thing.Locations[0].Location.Geometry.Coordinates
+	for i, name := range LanePartNames {
+		if i >= len(lanes) || len(lanes[i]) == 0 {
+			continue
+		}
+		parts = append(parts, LanePart{Name: name, Coordinates: lanes[i]})
+	}
+	return parts
+}
+
+// Get the position of the stop line of a thing as [lng, lat].
+// This is the end of the ingress lane, or the start of the connection lane if there is no ingress lane.
+func (thing Thing) StopLine() ([]float64, error) {
+	if len(thing.Locations) == 0 {
+		return nil, fmt.Errorf("thing %s has no locations", thing.Name)
+	}
+	lanes := thing.Locations[0].Location.Geometry.Coordinates
+	if len(lanes) > 0 && len(lanes[0]) > 0 {
+		return lanes[0][len(lanes[0])-1], nil
+	}
+	if len(lanes) > 1 && len(lanes[1]) > 0 {
+		return lanes[1][0], nil
+	}
+	return nil, fmt.Errorf("thing %s has no stop line", thing.Name)
+}
+
+// Get the bearing of the last segment of the ingress lane in degrees, i.e. the direction
+// from which the traffic approaches the stop line. Returns false if there is no such segment.
+func (thing Thing) ApproachBearing() (float64, bool) {
+	for _, part := range thing.LaneParts() {
+		if part.Name != "ingress" || len(part.Coordinates) < 2 {
+			continue
+		}
+		n := len(part.Coordinates)
+		return Bearing(part.Coordinates[n-2], part.Coordinates[n-1]), true
+	}
+	return 0, false
+}
+
+// The mean earth radius in metres.
+const earthRadius = 6371000.0
+
+// Calculate the distance between two [lng, lat] coordinates in metres.
+func Distance(a []float64, b []float64) float64 {
+	lat1, lat2 := a[1]*math.Pi/180, b[1]*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b[0] - a[0]) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// Calculate the initial bearing from one [lng, lat] coordinate to another in degrees (0-360, 0 = north).
+func Bearing(from []float64, to []float64) float64 {
+	lat1, lat2 := from[1]*math.Pi/180, to[1]*math.Pi/180
+	dLng := (to[0] - from[0]) * math.Pi / 180
+	y := math.Sin(dLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// Calculate the length of a line of [lng, lat] coordinates in metres.
+func Length(line [][]float64) float64 {
+	var length float64 = 0
+	for i := 1; i < len(line); i++ {
+		length += Distance(line[i-1], line[i])
+	}
+	return length
+}
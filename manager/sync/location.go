@@ -10,8 +10,10 @@ type Location struct {
 		Geometry struct {
 			Type        string        `json:"type"` // MultiLineString
 			Coordinates [][][]float64 `json:"coordinates"`
+			Crs         *Crs          `json:"crs,omitempty"`
 		} `json:"geometry"`
 		Name     string `json:"name"`
 		SelfLink string `json:"@iot.selfLink"`
+		Crs      *Crs   `json:"crs,omitempty"`
 	} `json:"location"`
 }
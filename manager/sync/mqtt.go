@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"monitor/env"
+	"monitor/log"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// A change notification of the SensorThings MQTT extension. It contains the created, updated or deleted entity.
+type thingNotification struct {
+	IotId *int   `json:"@iot.id"`
+	Name  string `json:"name"`
+}
+
+// Matches the id in entity topics like `v1.1/Things(42)`.
+var thingTopicPattern = regexp.MustCompile(`Things\((\d+)\)$`)
+
+// Listen for created, updated and deleted things via the MQTT extension of the SensorThings API,
+// if `SENSORTHINGS_MQTT_URL` is set. Each notified thing is fetched again with the configured
+// query and applied immediately. If it was deleted or no longer matches the query, it is removed.
+// Deleted things are notified on `SENSORTHINGS_MQTT_DELETE_TOPIC`, if the server publishes them.
+// Otherwise they remain until the next full sync, every `SENSORTHINGS_SYNC_INTERVAL`.
+func ListenForChanges() {
+	mqttUrl := os.Getenv("SENSORTHINGS_MQTT_URL")
+	if mqttUrl == "" {
+		return
+	}
+	topics := map[string]byte{env.String("SENSORTHINGS_MQTT_TOPIC", "v1.1/Things"): 1}
+	if deleteTopic := os.Getenv("SENSORTHINGS_MQTT_DELETE_TOPIC"); deleteTopic != "" {
+		topics[deleteTopic] = 1
+	}
+	log.Info.Println("Connecting to SensorThings mqtt broker at:", mqttUrl)
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(mqttUrl)
+	mqttUsername := os.Getenv("SENSORTHINGS_MQTT_USERNAME")
+	mqttPassword := os.Getenv("SENSORTHINGS_MQTT_PASSWORD")
+	if mqttUsername != "" && mqttPassword != "" {
+		opts.SetUsername(mqttUsername)
+		opts.SetPassword(mqttPassword)
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true)
+	opts.SetKeepAlive(60 * time.Second)
+	opts.SetPingTimeout(10 * time.Second)
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	opts.SetClientID(fmt.Sprintf("priobike-prediction-monitor-sync-%d", random.Int()))
+	opts.SetOrderMatters(false)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Info.Println("Connected to SensorThings mqtt broker.")
+		// Subscribe again after each reconnect, since the session is not persisted.
+		if sub := client.SubscribeMultiple(topics, onThingChanged); sub.Wait() && sub.Error() != nil {
+			log.Error.Println("Could not subscribe to thing changes:", sub.Error())
+		}
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Warning.Println("Connection to SensorThings mqtt broker lost, reconnecting:", err)
+	})
+
+	client := mqtt.NewClient(opts)
+	// The connection is retried in the background, the periodic sync works without it.
+	client.Connect()
+}
+
+// A callback that is executed when a thing was created, updated or deleted.
+func onThingChanged(client mqtt.Client, msg mqtt.Message) {
+	handleThingNotification(msg.Topic(), msg.Payload())
+}
+
+// Apply the change of the notified thing. The id is taken from the entity in the payload,
+// or from entity topics like `v1.1/Things(42)`. A notification without payload is a deletion.
+func handleThingNotification(topic string, payload []byte) {
+	var notification thingNotification
+	if len(bytes.TrimSpace(payload)) > 0 {
+		if err := json.Unmarshal(payload, &notification); err != nil {
+			log.Warning.Println("Could not parse thing notification:", err)
+			return
+		}
+	}
+	if notification.IotId == nil {
+		match := thingTopicPattern.FindStringSubmatch(topic)
+		if match == nil {
+			log.Warning.Println("Thing notification without id on topic:", topic)
+			return
+		}
+		iotId, err := strconv.Atoi(match[1])
+		if err != nil {
+			log.Warning.Println("Thing notification with invalid id on topic:", topic)
+			return
+		}
+		notification.IotId = &iotId
+	}
+	iotId := *notification.IotId
+
+	if len(bytes.TrimSpace(payload)) == 0 {
+		log.Info.Printf("Thing %d was deleted, removing it.\n", iotId)
+		applyChange(iotId, nil)
+		return
+	}
+
+	thing, err := fetchChangedThing(iotId)
+	if errors.Is(err, errNotFound) {
+		log.Info.Printf("Thing %d (%s) no longer exists, removing it.\n", iotId, notification.Name)
+		applyChange(iotId, nil)
+		return
+	}
+	if err != nil {
+		log.Warning.Printf("Could not fetch changed thing %d: %v\n", iotId, err)
+		return
+	}
+	if thing == nil {
+		log.Info.Printf("Thing %d (%s) was deleted or no longer matches the query, removing it.\n", iotId, notification.Name)
+		applyChange(iotId, nil)
+		return
+	}
+	log.Info.Printf("Thing %d (%s) changed, updating it.\n", iotId, thing.Name)
+	applyChange(iotId, thing)
+}
+
+// Fetch a changed thing again with the query, since the notification doesn't contain
+// the expanded locations and the thing may no longer match the query.
+// Returns nil if the thing was deleted or doesn't match the query. Things with another id are ignored,
+// in case the API doesn't apply the filter.
+func fetchChangedThing(iotId int) (*Thing, error) {
+	things, err := fetchThingsWithFilter(fmt.Sprintf("@iot.id eq %d", iotId))
+	if err != nil {
+		return nil, err
+	}
+	for i := range things {
+		if things[i].IotId == iotId {
+			return &things[i], nil
+		}
+	}
+	if len(things) > 0 {
+		log.Warning.Printf("Fetching thing %d returned %d other things, is the filter supported?\n", iotId, len(things))
+	}
+	return nil, nil
+}
@@ -0,0 +1,223 @@
+package sync
+
+import (
+	"fmt"
+	"monitor/clock"
+	"monitor/env"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The types of data quality issues in the thing catalogue.
+const (
+	// The location can't be reprojected to WGS84.
+	IssueInvalidLocation = "invalid_location"
+	// The thing has no location.
+	IssueMissingLocation = "missing_location"
+	// The location has fewer than three lane parts (ingress, connection, egress).
+	IssueMissingLaneParts = "missing_lane_parts"
+	// A lane part has no length.
+	IssueZeroLengthLane = "zero_length_lane"
+	// A lane part crosses itself.
+	IssueSelfIntersectingLane = "self_intersecting_lane"
+	// A coordinate lies outside of the service area.
+	IssueOutsideServiceArea = "outside_service_area"
+	// Another thing has the same name, so one overwrites the other.
+	IssueDuplicateName = "duplicate_name"
+	// The ingress or egress lane doesn't connect to the connection lane.
+	IssueDisconnectedLanes = "disconnected_lanes"
+	// The info of the thing was not updated for a long time, or the update time is invalid.
+	IssueStaleInfo = "stale_info"
+)
+
+// All issue types, in the order in which they are reported.
+var IssueTypes = []string{
+	IssueInvalidLocation,
+	IssueMissingLocation,
+	IssueMissingLaneParts,
+	IssueZeroLengthLane,
+	IssueSelfIntersectingLane,
+	IssueOutsideServiceArea,
+	IssueDuplicateName,
+	IssueDisconnectedLanes,
+	IssueStaleInfo,
+}
+
+// A data quality issue of a thing in the catalogue.
+type QualityIssue struct {
+	// The name of the thing.
+	ThingName string `json:"thing_name"`
+	// The id of the thing in the SensorThings API.
+	IotId int `json:"iot_id"`
+	// The type of the issue.
+	Type string `json:"type"`
+	// A description of the issue.
+	Message string `json:"message"`
+}
+
+// A data quality report of the thing catalogue.
+type QualityReport struct {
+	// The unix time of the check.
+	CheckTime int64 `json:"check_time"`
+	// The number of checked things.
+	NumThings int `json:"num_things"`
+	// The number of things with at least one issue. Things are counted by name, since the iot id
+	// is not set for things from files, and things with the same name share one topic.
+	NumThingsWithIssues int `json:"num_things_with_issues"`
+	// The number of issues by type.
+	NumIssues map[string]int `json:"num_issues"`
+	// All issues, sorted by thing name.
+	Issues []QualityIssue `json:"issues"`
+}
+
+// The quality report of the last sync.
+var Quality = QualityReport{NumIssues: make(map[string]int), Issues: make([]QualityIssue, 0)}
+
+// A lock for the quality report.
+var QualityMutex = &sync.Mutex{}
+
+// Create a new quality issue of a thing.
+func newQualityIssue(thing Thing, issueType string, message string) QualityIssue {
+	return QualityIssue{ThingName: thing.Name, IotId: thing.IotId, Type: issueType, Message: message}
+}
+
+// Check the quality of the catalogue and store the report. Known issues can be passed in,
+// e.g. for things that could not be reprojected and are therefore not contained in the catalogue.
+func checkQuality(things []Thing, known []QualityIssue) {
+	maxLaneGap := env.Float("THINGS_MAX_LANE_GAP", 5)
+	maxInfoAge := env.Duration("THINGS_MAX_INFO_AGE", 365*24*time.Hour)
+	now := clock.Now()
+
+	issues := append(make([]QualityIssue, 0), known...)
+	names := make(map[string]int)
+	for _, thing := range things {
+		names[thing.Name]++
+	}
+
+	for _, thing := range things {
+		if names[thing.Name] > 1 {
+			issues = append(issues, newQualityIssue(thing, IssueDuplicateName,
+				fmt.Sprintf("%d things are named %s", names[thing.Name], thing.Name)))
+		}
+		if !thing.InServiceArea() {
+			issues = append(issues, newQualityIssue(thing, IssueOutsideServiceArea, "coordinates outside of the service area"))
+		}
+		issues = append(issues, checkInfoAge(thing, now, maxInfoAge)...)
+		issues = append(issues, checkLanes(thing, maxLaneGap)...)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].ThingName < issues[j].ThingName
+	})
+	report := QualityReport{
+		CheckTime: now.Unix(),
+		NumThings: len(things),
+		NumIssues: make(map[string]int),
+		Issues:    issues,
+	}
+	for _, issueType := range IssueTypes {
+		report.NumIssues[issueType] = 0
+	}
+	thingsWithIssues := make(map[string]bool)
+	for _, issue := range issues {
+		report.NumIssues[issue.Type]++
+		thingsWithIssues[issue.ThingName] = true
+	}
+	report.NumThingsWithIssues = len(thingsWithIssues)
+
+	QualityMutex.Lock()
+	Quality = report
+	QualityMutex.Unlock()
+}
+
+// Check whether the info of the thing was updated within the given age.
+func checkInfoAge(thing Thing, now time.Time, maxAge time.Duration) []QualityIssue {
+	if thing.Properties.InfoLastUpdated == "" {
+		return []QualityIssue{newQualityIssue(thing, IssueStaleInfo, "info last updated is missing")}
+	}
+	updated, err := time.Parse(time.RFC3339, thing.Properties.InfoLastUpdated)
+	if err != nil {
+		return []QualityIssue{newQualityIssue(thing, IssueStaleInfo, "info last updated is invalid: "+err.Error())}
+	}
+	if now.Sub(updated) > maxAge {
+		return []QualityIssue{newQualityIssue(thing, IssueStaleInfo,
+			fmt.Sprintf("info last updated %s", thing.Properties.InfoLastUpdated))}
+	}
+	return nil
+}
+
+// Check the geometry of the lane parts of the thing.
+func checkLanes(thing Thing, maxGap float64) []QualityIssue {
+	if len(thing.Locations) == 0 {
+		return []QualityIssue{newQualityIssue(thing, IssueMissingLocation, "thing has no locations")}
+	}
+	issues := make([]QualityIssue, 0)
+	lanes := thing.Locations[0].Location.Geometry.Coordinates
+	if len(lanes) < len(LanePartNames) {
+		issues = append(issues, newQualityIssue(thing, IssueMissingLaneParts,
+			fmt.Sprintf("location has %d of %d lane parts", len(lanes), len(LanePartNames))))
+	}
+	for i, lane := range lanes {
+		name := fmt.Sprintf("lane part %d", i)
+		if i < len(LanePartNames) {
+			name = LanePartNames[i] + " lane"
+		}
+		if Length(lane) == 0 {
+			issues = append(issues, newQualityIssue(thing, IssueZeroLengthLane, name+" has zero length"))
+		}
+		if selfIntersects(lane) {
+			issues = append(issues, newQualityIssue(thing, IssueSelfIntersectingLane, name+" intersects itself"))
+		}
+	}
+	// The ingress lane must end where the connection lane starts, and the egress lane must start where it ends.
+	if len(lanes) >= 3 && len(lanes[0]) > 0 && len(lanes[1]) > 0 && len(lanes[2]) > 0 {
+		ingressEnd, connectionStart := lanes[0][len(lanes[0])-1], lanes[1][0]
+		connectionEnd, egressStart := lanes[1][len(lanes[1])-1], lanes[2][0]
+		if gap := Distance(ingressEnd, connectionStart); gap > maxGap {
+			issues = append(issues, newQualityIssue(thing, IssueDisconnectedLanes,
+				fmt.Sprintf("ingress lane ends %.1fm from the connection lane", gap)))
+		}
+		if gap := Distance(connectionEnd, egressStart); gap > maxGap {
+			issues = append(issues, newQualityIssue(thing, IssueDisconnectedLanes,
+				fmt.Sprintf("egress lane starts %.1fm from the connection lane", gap)))
+		}
+	}
+	return issues
+}
+
+// Check whether any two non-adjacent segments of a line intersect.
+// The coordinates are treated as planar, which is sufficient at the scale of a lane.
+func selfIntersects(line [][]float64) bool {
+	for i := 0; i+1 < len(line); i++ {
+		for j := i + 2; j+1 < len(line); j++ {
+			// The first and last segment of a closed line share a point, which is no intersection.
+			if i == 0 && j+2 == len(line) && samePoint(line[0], line[len(line)-1]) {
+				continue
+			}
+			if segmentsIntersect(line[i], line[i+1], line[j], line[j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check whether two coordinates are identical.
+func samePoint(a []float64, b []float64) bool {
+	return a[0] == b[0] && a[1] == b[1]
+}
+
+// Check whether the segments p1-p2 and p3-p4 intersect.
+func segmentsIntersect(p1 []float64, p2 []float64, p3 []float64, p4 []float64) bool {
+	d1 := orientation(p3, p4, p1)
+	d2 := orientation(p3, p4, p2)
+	d3 := orientation(p1, p2, p3)
+	d4 := orientation(p1, p2, p4)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// Get the orientation of the point c relative to the line a-b (positive: left, negative: right).
+func orientation(a []float64, b []float64, c []float64) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
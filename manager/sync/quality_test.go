@@ -0,0 +1,95 @@
+package sync
+
+import (
+	"monitor/clock"
+	"testing"
+	"time"
+)
+
+// Build a thing with the given name and iot id whose lane parts are connected and up to date.
+func qualityThing(name string, iotId int, lanes [][][]float64) Thing {
+	var thing Thing
+	thing.Name = name
+	thing.IotId = iotId
+	thing.Properties.InfoLastUpdated = clock.Now().Format(time.RFC3339)
+	if lanes != nil {
+		location := Location{}
+		location.Location.Geometry.Coordinates = lanes
+		thing.Locations = []Location{location}
+	}
+	return thing
+}
+
+func TestCheckQuality(t *testing.T) {
+	connected := [][][]float64{
+		{{9.9900, 53.5500}, {9.9910, 53.5500}},
+		{{9.9910, 53.5500}, {9.9920, 53.5500}},
+		{{9.9920, 53.5500}, {9.9930, 53.5500}},
+	}
+	tests := []struct {
+		name             string
+		things           []Thing
+		thingsWithIssues int
+		issues           map[string]int
+	}{
+		{"no issues", []Thing{qualityThing("1_1", 1, connected)}, 0, map[string]int{}},
+		{"things from files without iot ids", []Thing{
+			qualityThing("1_1", 0, nil),
+			qualityThing("1_2", 0, nil),
+			qualityThing("1_3", 0, connected),
+		}, 2, map[string]int{IssueMissingLocation: 2}},
+		{"duplicate names share a topic", []Thing{
+			qualityThing("1_1", 1, connected),
+			qualityThing("1_1", 2, connected),
+		}, 1, map[string]int{IssueDuplicateName: 2}},
+		{"missing lane parts", []Thing{qualityThing("1_1", 1, connected[:2])}, 1, map[string]int{IssueMissingLaneParts: 1}},
+		{"disconnected lanes", []Thing{qualityThing("1_1", 1, [][][]float64{
+			connected[0],
+			{{9.9911, 53.5500}, {9.9920, 53.5500}},
+			connected[2],
+		})}, 1, map[string]int{IssueDisconnectedLanes: 1}},
+		{"zero length and self intersecting lanes", []Thing{qualityThing("1_1", 1, [][][]float64{
+			connected[0],
+			{{9.9910, 53.5500}, {9.9930, 53.5500}, {9.9930, 53.5510}, {9.9920, 53.5490}, {9.9920, 53.5500}},
+			{{9.9920, 53.5500}, {9.9920, 53.5500}},
+		})}, 1, map[string]int{IssueSelfIntersectingLane: 1, IssueZeroLengthLane: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkQuality(test.things, nil)
+			QualityMutex.Lock()
+			report := Quality
+			QualityMutex.Unlock()
+			if report.NumThingsWithIssues != test.thingsWithIssues {
+				t.Errorf("NumThingsWithIssues = %d, want %d: %+v", report.NumThingsWithIssues, test.thingsWithIssues, report.Issues)
+			}
+			for _, issueType := range IssueTypes {
+				if report.NumIssues[issueType] != test.issues[issueType] {
+					t.Errorf("NumIssues[%s] = %d, want %d", issueType, report.NumIssues[issueType], test.issues[issueType])
+				}
+			}
+		})
+	}
+}
+
+func TestSelfIntersects(t *testing.T) {
+	tests := []struct {
+		name string
+		line [][]float64
+		want bool
+	}{
+		{"empty", [][]float64{}, false},
+		{"straight", [][]float64{{0, 0}, {1, 0}, {2, 0}}, false},
+		{"zigzag", [][]float64{{0, 0}, {1, 1}, {2, 0}, {3, 1}}, false},
+		{"loop", [][]float64{{0, 0}, {2, 0}, {2, 1}, {1, -1}}, true},
+		{"closed ring", [][]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}, false},
+		{"figure eight", [][]float64{{0, 0}, {1, 1}, {1, 0}, {0, 1}, {0, 0}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := selfIntersects(test.line); got != test.want {
+				t.Errorf("selfIntersects = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"monitor/env"
+	"monitor/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A source from which the thing catalogue is loaded.
+type Source interface {
+	// Fetch all things of the catalogue. Returns the things fetched until an error occurred, if any.
+	Fetch() ([]Thing, error)
+	// Watch the source and notify the channel when it changed. Blocks forever.
+	Watch(changed chan<- struct{})
+}
+
+// Create the source that is configured with `THINGS_SOURCE`:
+// `sensorthings` (default) fetches the things from the SensorThings API,
+// `file` loads them from the file or directory at `THINGS_PATH`.
+func NewSource() Source {
+	switch kind := env.String("THINGS_SOURCE", "sensorthings"); kind {
+	case "sensorthings":
+		return SensorThingsSource{}
+	case "file":
+		path := os.Getenv("THINGS_PATH")
+		if path == "" {
+			panic("THINGS_PATH is not set")
+		}
+		return FileSource{Path: path}
+	default:
+		panic("Unknown THINGS_SOURCE: " + kind)
+	}
+}
+
+// A source that fetches the things from the SensorThings API.
+type SensorThingsSource struct{}
+
+// Fetch all pages of the things from the SensorThings API.
+func (source SensorThingsSource) Fetch() ([]Thing, error) {
+	return fetchThings()
+}
+
+// Changes of the SensorThings API are applied directly via its MQTT extension, if configured.
+// A full sync is therefore only needed periodically as a consistency backstop.
+func (source SensorThingsSource) Watch(changed chan<- struct{}) {
+	ListenForChanges()
+	select {}
+}
+
+// A source that loads the things from a local file or all `.json` and `.geojson` files of a directory.
+// Each file can contain a thing, a list of things, a things response of the SensorThings API
+// or a GeoJSON FeatureCollection whose features carry the thing properties.
+type FileSource struct {
+	// The path of the file or directory.
+	Path string
+}
+
+// Load all things from the file or directory.
+func (source FileSource) Fetch() ([]Thing, error) {
+	files, err := source.files()
+	if err != nil {
+		return nil, err
+	}
+	things := make([]Thing, 0)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return things, err
+		}
+		decoded, err := decodeThings(data)
+		if err != nil {
+			return things, fmt.Errorf("could not decode %s: %v", file, err)
+		}
+		things = append(things, decoded...)
+	}
+	return things, nil
+}
+
+// Poll the files every `THINGS_WATCH_INTERVAL` and notify the channel when one of them changed.
+func (source FileSource) Watch(changed chan<- struct{}) {
+	interval := env.Duration("THINGS_WATCH_INTERVAL", 10*time.Second)
+	last := source.signature()
+	for {
+		time.Sleep(interval)
+		current := source.signature()
+		if current == last {
+			continue
+		}
+		last = current
+		log.Info.Println("Things file changed:", source.Path)
+		select {
+		case changed <- struct{}{}:
+		default: // A reload is already pending.
+		}
+	}
+}
+
+// Get the sorted catalogue files of the source.
+func (source FileSource) files() ([]string, error) {
+	info, err := os.Stat(source.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{source.Path}, nil
+	}
+	entries, err := ioutil.ReadDir(source.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".json") || strings.HasSuffix(entry.Name(), ".geojson") {
+			files = append(files, filepath.Join(source.Path, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Get a signature of the names, sizes and modification times of the files, to detect changes.
+func (source FileSource) signature() string {
+	files, err := source.files()
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	signature := ""
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		signature += fmt.Sprintf("%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return signature
+}
+
+// A GeoJSON feature collection whose features carry the thing properties.
+type thingFeatureCollection struct {
+	Type     string         `json:"type"`
+	Crs      *Crs           `json:"crs,omitempty"`
+	Features []thingFeature `json:"features"`
+}
+
+// A GeoJSON feature with the lanes of a thing as geometry and the thing properties.
+type thingFeature struct {
+	Type     string          `json:"type"`
+	Id       interface{}     `json:"id"`
+	Geometry json.RawMessage `json:"geometry"`
+	// The properties contain the thing properties and optionally `name`, `description` and `@iot.id`.
+	Properties json.RawMessage `json:"properties"`
+}
+
+// Decode things from json in any of the supported formats.
+func decodeThings(data []byte) ([]Thing, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var things []Thing
+		err := json.Unmarshal(data, &things)
+		return things, err
+	}
+
+	var probe struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	switch {
+	case probe.Type == "FeatureCollection":
+		var collection thingFeatureCollection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, err
+		}
+		things := make([]Thing, 0, len(collection.Features))
+		for _, feature := range collection.Features {
+			thing, err := feature.thing(collection.Crs)
+			if err != nil {
+				return things, err
+			}
+			things = append(things, thing)
+		}
+		return things, nil
+	case probe.Type == "Feature":
+		var feature thingFeature
+		if err := json.Unmarshal(data, &feature); err != nil {
+			return nil, err
+		}
+		thing, err := feature.thing(nil)
+		return []Thing{thing}, err
+	case probe.Value != nil:
+		var response ThingsResponse
+		err := json.Unmarshal(data, &response)
+		return response.Value, err
+	default:
+		var thing Thing
+		err := json.Unmarshal(data, &thing)
+		return []Thing{thing}, err
+	}
+}
+
+// Convert the feature to a thing with a single location.
+func (feature thingFeature) thing(crs *Crs) (Thing, error) {
+	var thing Thing
+	if err := json.Unmarshal(feature.Properties, &thing.Properties); err != nil {
+		return thing, err
+	}
+	var identity struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		IotId       int    `json:"@iot.id"`
+	}
+	if err := json.Unmarshal(feature.Properties, &identity); err != nil {
+		return thing, err
+	}
+	thing.Name = identity.Name
+	thing.Description = identity.Description
+	thing.IotId = identity.IotId
+	if thing.Name == "" && feature.Id != nil {
+		thing.Name = fmt.Sprint(feature.Id)
+	}
+	if thing.Name == "" {
+		return thing, fmt.Errorf("feature has no name")
+	}
+
+	location := Location{Description: thing.Name, EncodingType: "application/geo+json"}
+	location.Location.Type = "Feature"
+	location.Location.Name = thing.Name
+	location.Location.Crs = crs
+	if err := json.Unmarshal(feature.Geometry, &location.Location.Geometry); err != nil {
+		return thing, err
+	}
+	thing.Locations = []Location{location}
+	return thing, nil
+}
@@ -0,0 +1,241 @@
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The lanes of a thing as a GeoJSON geometry.
+const testGeometry = `{"type":"MultiLineString","coordinates":[[[9.99,53.55],[9.991,53.551]],[[9.991,53.551],[9.992,53.552]]]}`
+
+// A thing in the format of the SensorThings API.
+const testThing = `{
+	"@iot.id": 1,
+	"name": "123_4",
+	"description": "Signal group 4",
+	"properties": {"laneType": "Radfahrer", "trafficLightsID": "123"},
+	"Locations": [{"location": {"type": "Feature", "geometry": ` + testGeometry + `}}]
+}`
+
+// A summary of a decoded thing, to compare it with the expected result.
+type decodedThing struct {
+	iotId        int
+	name         string
+	laneType     string
+	intersection string
+	lanes        int
+	crs          string
+}
+
+// Summarize the decoded things.
+func summarize(things []Thing) []decodedThing {
+	summaries := make([]decodedThing, len(things))
+	for i, thing := range things {
+		summaries[i] = decodedThing{
+			iotId:        thing.IotId,
+			name:         thing.Name,
+			laneType:     thing.Properties.LaneType,
+			intersection: thing.Intersection(),
+		}
+		if len(thing.Locations) > 0 {
+			summaries[i].lanes = len(thing.Locations[0].Location.Geometry.Coordinates)
+			if crs := thing.Locations[0].Location.Crs; crs != nil {
+				summaries[i].crs = crs.Properties.Name
+			}
+		}
+	}
+	return summaries
+}
+
+func TestDecodeThings(t *testing.T) {
+	thing := decodedThing{iotId: 1, name: "123_4", laneType: "Radfahrer", intersection: "123", lanes: 2}
+	tests := []struct {
+		name string
+		data string
+		want []decodedThing
+	}{
+		{"single thing", testThing, []decodedThing{thing}},
+		{"array", `[` + testThing + `,` + testThing + `]`, []decodedThing{thing, thing}},
+		{"empty array", `[]`, []decodedThing{}},
+		{"sensorthings response", `{"@iot.count": 1, "value": [` + testThing + `]}`, []decodedThing{thing}},
+		{"leading whitespace", "\n\t [" + testThing + `]`, []decodedThing{thing}},
+		{
+			"feature",
+			`{"type": "Feature", "geometry": ` + testGeometry + `,
+				"properties": {"@iot.id": 1, "name": "123_4", "laneType": "Radfahrer", "trafficLightsID": "123"}}`,
+			[]decodedThing{thing},
+		},
+		{
+			"feature named by its id",
+			`{"type": "Feature", "id": "456_1", "geometry": ` + testGeometry + `, "properties": {"laneType": "KFZ"}}`,
+			[]decodedThing{{name: "456_1", laneType: "KFZ", intersection: "456", lanes: 2}},
+		},
+		{
+			"feature collection",
+			`{"type": "FeatureCollection",
+				"crs": {"type": "name", "properties": {"name": "EPSG:25832"}},
+				"features": [
+					{"type": "Feature", "geometry": ` + testGeometry + `, "properties": {"@iot.id": 1, "name": "123_4", "laneType": "Radfahrer", "trafficLightsID": "123"}},
+					{"type": "Feature", "id": 7, "geometry": ` + testGeometry + `, "properties": {}}
+				]}`,
+			[]decodedThing{
+				{iotId: 1, name: "123_4", laneType: "Radfahrer", intersection: "123", lanes: 2, crs: "EPSG:25832"},
+				{name: "7", intersection: "7", lanes: 2, crs: "EPSG:25832"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			things, err := decodeThings([]byte(test.data))
+			if err != nil {
+				t.Fatalf("decodeThings failed: %v", err)
+			}
+			got := summarize(things)
+			if len(got) != len(test.want) {
+				t.Fatalf("decodeThings = %+v, want %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("thing %d = %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeThingsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ``},
+		{"not json", `things`},
+		{"truncated array", `[` + testThing},
+		{"feature without name", `{"type": "Feature", "geometry": ` + testGeometry + `, "properties": {}}`},
+		{"feature with invalid geometry", `{"type": "Feature", "id": 1, "geometry": {"coordinates": "none"}, "properties": {}}`},
+		{"feature collection without names", `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": ` + testGeometry + `, "properties": {}}]}`},
+		{"invalid response", `{"value": {"name": "123_4"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if things, err := decodeThings([]byte(test.data)); err == nil {
+				t.Errorf("decodeThings = %+v, want an error", summarize(things))
+			}
+		})
+	}
+}
+
+// Write the files with the given contents to the directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileSourceFetch(t *testing.T) {
+	other := `{"type": "Feature", "id": "456_1", "geometry": ` + testGeometry + `, "properties": {}}`
+	tests := []struct {
+		name  string
+		files map[string]string
+		path  string
+		want  []string
+		ok    bool
+	}{
+		{"single file", map[string]string{"things.json": `[` + testThing + `]`}, "things.json", []string{"123_4"}, true},
+		{
+			"directory in name order",
+			map[string]string{"b.geojson": other, "a.json": testThing, "notes.txt": "not a catalogue"},
+			"",
+			[]string{"123_4", "456_1"},
+			true,
+		},
+		{"empty directory", map[string]string{}, "", []string{}, true},
+		{"missing path", map[string]string{}, "missing.json", nil, false},
+		{
+			"invalid file",
+			map[string]string{"a.json": testThing, "b.json": `{`},
+			"",
+			[]string{"123_4"},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.files)
+			// Subdirectories are ignored.
+			if err := os.Mkdir(filepath.Join(dir, "archive.json"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			things, err := FileSource{Path: filepath.Join(dir, test.path)}.Fetch()
+			if (err == nil) != test.ok {
+				t.Fatalf("Fetch error = %v, want ok %v", err, test.ok)
+			}
+			// The things fetched until the error are returned.
+			if len(things) != len(test.want) {
+				t.Fatalf("Fetch = %+v, want %v", summarize(things), test.want)
+			}
+			for i, thing := range things {
+				if thing.Name != test.want[i] {
+					t.Errorf("thing %d = %s, want %s", i, thing.Name, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileSourceSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, dir string)
+		changed bool
+	}{
+		{"unchanged", func(t *testing.T, dir string) {}, false},
+		{"ignored file added", func(t *testing.T, dir string) {
+			writeFiles(t, dir, map[string]string{"notes.txt": "ignored"})
+		}, false},
+		{"content changed", func(t *testing.T, dir string) {
+			writeFiles(t, dir, map[string]string{"a.json": `[` + testThing + `,` + testThing + `]`})
+		}, true},
+		{"modified", func(t *testing.T, dir string) {
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes(filepath.Join(dir, "a.json"), later, later); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"file added", func(t *testing.T, dir string) {
+			writeFiles(t, dir, map[string]string{"b.geojson": testThing})
+		}, true},
+		{"file removed", func(t *testing.T, dir string) {
+			if err := os.Remove(filepath.Join(dir, "a.json")); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"directory removed", func(t *testing.T, dir string) {
+			if err := os.RemoveAll(dir); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "things")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(t, dir, map[string]string{"a.json": testThing})
+			source := FileSource{Path: dir}
+			before := source.signature()
+			test.change(t, dir)
+			if changed := source.signature() != before; changed != test.changed {
+				t.Errorf("signature changed = %v, want %v", changed, test.changed)
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package sync
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"monitor/env"
 	"monitor/log"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,72 +21,213 @@ type ThingsResponse struct {
 	NextUri *string `json:"@iot.nextLink"`
 }
 
+// The error of a request for things that don't exist (anymore).
+var errNotFound = errors.New("not found")
+
 // A map that contains all things by their prediction mqtt topic.
 var Things = make(map[string]Thing)
 
 // A lock for the things map.
 var ThingsMutex = &sync.Mutex{}
 
-// Periodically sync the things from the SensorThings API.
+// A counter that is incremented whenever the things map changed. Protected by the things lock.
+var version = 0
+
+// Get the version of the things map, to detect changes without comparing all things.
+func Version() int {
+	ThingsMutex.Lock()
+	defer ThingsMutex.Unlock()
+	return version
+}
+
+// Periodically sync the things from the configured source, every `SENSORTHINGS_SYNC_INTERVAL`.
+// Sources that can detect changes, e.g. local files, trigger an immediate sync.
+// The full sync also removes deleted things whose deletion was not notified.
 func Run() {
+	interval := env.Duration("SENSORTHINGS_SYNC_INTERVAL", 1*time.Hour)
+	if interval <= 0 {
+		log.Warning.Printf("Invalid SENSORTHINGS_SYNC_INTERVAL %v, using 1h\n", interval)
+		interval = 1 * time.Hour
+	}
+	source := NewSource()
+	changed := make(chan struct{}, 1)
+	go source.Watch(changed)
+
 	for {
 		log.Info.Println("Syncing things...")
 
-		// Get the SensorThings api base url from the environment.
-		baseUrl := os.Getenv("SENSORTHINGS_URL")
-		if baseUrl == "" {
-			panic("SENSORTHINGS_URL is not set")
+		// Fetch all things from the source. If this fails midway, e.g. on a page of the
+		// SensorThings API, the fetched things are added without removing any existing thing.
+		things, err := source.Fetch()
+		if err != nil {
+			log.Warning.Println("Could not sync things:", err)
 		}
+		apply(things, err == nil)
 
-		// Get the SensorThings query from the environment.
-		query := os.Getenv("SENSORTHINGS_QUERY")
-		if query == "" {
-			panic("SENSORTHINGS_QUERY is not set")
+		ThingsMutex.Lock()
+		log.Info.Printf("Synced %d things", len(Things))
+		ThingsMutex.Unlock()
+
+		// Sleep until the next sync or until the source changed.
+		select {
+		case <-time.After(interval):
+		case <-changed:
 		}
+	}
+}
 
-		// Fetch all pages of the SensorThings query.
-		var pageUrl = baseUrl + "Things?%24filter=" + url.QueryEscape(query)
-		for {
-			resp, err := http.Get(pageUrl)
-			if err != nil {
-				log.Warning.Println("Could not sync things:", err)
-				break
-			}
-			defer resp.Body.Close()
-
-			body, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				log.Warning.Println("Could not sync things:", err)
-				break
-			}
-
-			var thingsResponse ThingsResponse
-			if err := json.Unmarshal(body, &thingsResponse); err != nil {
-				log.Warning.Println("Could not sync things:", err)
-				break
-			}
-
-			for _, thing := range thingsResponse.Value {
-				// Validate that the thing has a lane.
-				_, err := thing.Lane()
-				if err != nil {
-					log.Warning.Printf("Error getting lane for thing %s: %v\n", thing.Name, err)
-					continue
-				}
-				ThingsMutex.Lock()
-				Things[thing.Topic()] = thing
-				ThingsMutex.Unlock()
-			}
-
-			if thingsResponse.NextUri == nil {
-				break
-			}
-			pageUrl = *thingsResponse.NextUri
+// Fetch all pages of the things from the SensorThings API.
+// Returns the things fetched until an error occurred, if any.
+func fetchThings() ([]Thing, error) {
+	return fetchThingsWithFilter("")
+}
+
+// Fetch all pages of the things from the SensorThings API that additionally match the filter.
+// The filter is combined with the configured query, e.g. `@iot.id eq 42`.
+func fetchThingsWithFilter(filter string) ([]Thing, error) {
+	// Get the SensorThings api base url from the environment.
+	baseUrl := os.Getenv("SENSORTHINGS_URL")
+	if baseUrl == "" {
+		panic("SENSORTHINGS_URL is not set")
+	}
+
+	// Get the SensorThings query from the environment.
+	query := os.Getenv("SENSORTHINGS_QUERY")
+	if query == "" {
+		panic("SENSORTHINGS_QUERY is not set")
+	}
+
+	things := make([]Thing, 0)
+	pageUrl, err := thingsUrl(baseUrl, query, filter)
+	if err != nil {
+		return things, err
+	}
+	for {
+		resp, err := http.Get(pageUrl)
+		if err != nil {
+			return things, err
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return things, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return things, errNotFound
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return things, fmt.Errorf("unexpected response status: %s", resp.Status)
 		}
 
-		log.Info.Printf("Synced %d things", len(Things))
+		var thingsResponse ThingsResponse
+		if err := json.Unmarshal(body, &thingsResponse); err != nil {
+			return things, err
+		}
+		things = append(things, thingsResponse.Value...)
+
+		if thingsResponse.NextUri == nil {
+			return things, nil
+		}
+		pageUrl = *thingsResponse.NextUri
+	}
+}
 
-		// Sleep for 1 hour.
-		time.Sleep(1 * time.Hour)
+// Build the url of the things that match the query and the additional filter.
+// The query is a filter expression, optionally followed by further query options,
+// e.g. `properties/laneType eq 'Radfahrer'&$expand=Locations,Datastreams`.
+// The filter is combined with the filter expression of the query, which is parenthesized
+// such that an `or` in the query doesn't bypass the filter.
+func thingsUrl(baseUrl string, query string, filter string) (string, error) {
+	expression, options := query, ""
+	if i := strings.Index(query, "&"); i >= 0 {
+		expression, options = query[:i], query[i+1:]
+	}
+	if filter != "" {
+		expression = filter + " and (" + expression + ")"
+	}
+	pageUrl := baseUrl + "Things?%24filter=" + url.QueryEscape(expression)
+	if options != "" {
+		values, err := url.ParseQuery(options)
+		if err != nil {
+			return "", err
+		}
+		pageUrl += "&" + values.Encode()
+	}
+	return pageUrl, nil
+}
+
+// Validate the fetched things, check the quality of the catalogue and add the valid things.
+// If the things are complete, things that are no longer contained are removed.
+func apply(things []Thing, complete bool) {
+	reprojected := make([]Thing, 0, len(things))
+	issues := make([]QualityIssue, 0)
+	for _, thing := range things {
+		// Reproject the location to WGS84, if it is given in another reference system.
+		if err := thing.Reproject(); err != nil {
+			log.Warning.Printf("Error reprojecting location of thing %s: %v\n", thing.Name, err)
+			issues = append(issues, newQualityIssue(thing, IssueInvalidLocation, err.Error()))
+			continue
+		}
+		reprojected = append(reprojected, thing)
+	}
+
+	// Check the quality of the catalogue before invalid things are filtered out.
+	checkQuality(reprojected, issues)
+
+	valid := make(map[string]Thing)
+	for _, thing := range reprojected {
+		// Validate that the thing lies within the service area.
+		if !thing.InServiceArea() {
+			log.Warning.Printf("Thing %s lies outside of the service area\n", thing.Name)
+			continue
+		}
+		// Validate that the thing has a lane.
+		if _, err := thing.Lane(); err != nil {
+			log.Warning.Printf("Error getting lane for thing %s: %v\n", thing.Name, err)
+			continue
+		}
+		valid[thing.Topic()] = thing
+	}
+
+	ThingsMutex.Lock()
+	defer ThingsMutex.Unlock()
+	version++
+	if complete {
+		Things = valid
+		return
+	}
+	for topic, thing := range valid {
+		Things[topic] = thing
+	}
+}
+
+// Apply a change of a single thing, identified by its id. If the thing is nil,
+// it was deleted or no longer matches the query, and is removed.
+func applyChange(iotId int, thing *Thing) {
+	if thing != nil {
+		// Validate the thing like in a full sync.
+		if err := thing.Reproject(); err != nil {
+			log.Warning.Printf("Error reprojecting location of thing %s: %v\n", thing.Name, err)
+			thing = nil
+		} else if !thing.InServiceArea() {
+			log.Warning.Printf("Thing %s lies outside of the service area\n", thing.Name)
+			thing = nil
+		} else if _, err := thing.Lane(); err != nil {
+			log.Warning.Printf("Error getting lane for thing %s: %v\n", thing.Name, err)
+			thing = nil
+		}
+	}
+
+	ThingsMutex.Lock()
+	defer ThingsMutex.Unlock()
+	version++
+	// Remove the previous version of the thing, its name and thus its topic may have changed.
+	for topic, existing := range Things {
+		if existing.IotId == iotId {
+			delete(Things, topic)
+		}
+	}
+	if thing != nil {
+		Things[thing.Topic()] = *thing
 	}
 }
@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestThingsUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		filter  string
+		want    url.Values
+		wantErr bool
+	}{
+		{"query only", "properties/laneType eq 'Radfahrer'", "",
+			url.Values{"$filter": {"properties/laneType eq 'Radfahrer'"}}, false},
+		{"filter", "properties/laneType eq 'Radfahrer'", "@iot.id eq 42",
+			url.Values{"$filter": {"@iot.id eq 42 and (properties/laneType eq 'Radfahrer')"}}, false},
+		{"filter with or in the query", "properties/laneType eq 'Radfahrer' or properties/laneType eq 'KFZ'", "@iot.id eq 42",
+			url.Values{"$filter": {"@iot.id eq 42 and (properties/laneType eq 'Radfahrer' or properties/laneType eq 'KFZ')"}}, false},
+		{"expand", "properties/laneType eq 'Radfahrer'&$expand=Locations,Datastreams", "",
+			url.Values{"$filter": {"properties/laneType eq 'Radfahrer'"}, "$expand": {"Locations,Datastreams"}}, false},
+		{"filter and expand", "properties/laneType eq 'Radfahrer'&$expand=Locations,Datastreams", "@iot.id eq 42",
+			url.Values{"$filter": {"@iot.id eq 42 and (properties/laneType eq 'Radfahrer')"}, "$expand": {"Locations,Datastreams"}}, false},
+		{"invalid options", "properties/laneType eq 'Radfahrer'&$expand=%zz", "", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pageUrl, err := thingsUrl("http://localhost/v1.1/", test.query, test.filter)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("thingsUrl error = %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			parsed, err := url.Parse(pageUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Path != "/v1.1/Things" {
+				t.Errorf("Path = %s, want /v1.1/Things", parsed.Path)
+			}
+			if got := parsed.Query(); got.Encode() != test.want.Encode() {
+				t.Errorf("Query = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchChangedThing(t *testing.T) {
+	tests := []struct {
+		name     string
+		returned []int
+		found    bool
+	}{
+		{"matches", []int{42}, true},
+		{"no longer matches the query", []int{}, false},
+		{"filter ignored by the api", []int{1, 2, 3}, false},
+		{"filter ignored by the api with the thing", []int{1, 42, 3}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				things := make([]Thing, len(test.returned))
+				for i, iotId := range test.returned {
+					things[i].IotId = iotId
+					things[i].Name = "thing"
+				}
+				json.NewEncoder(w).Encode(ThingsResponse{Value: things})
+			}))
+			defer server.Close()
+			t.Setenv("SENSORTHINGS_URL", server.URL+"/")
+			t.Setenv("SENSORTHINGS_QUERY", "properties/laneType eq 'Radfahrer'")
+
+			thing, err := fetchChangedThing(42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (thing != nil) != test.found {
+				t.Fatalf("fetchChangedThing = %v, want found %v", thing, test.found)
+			}
+			if thing != nil && thing.IotId != 42 {
+				t.Errorf("IotId = %d, want 42", thing.IotId)
+			}
+		})
+	}
+}
+
+func TestHandleThingNotification(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+		// The status and the things of the response when the thing is fetched again.
+		status   int
+		returned []string
+		fetched  bool
+		want     []string
+	}{
+		{"deleted without payload", "v1.1/Things(42)", "", http.StatusOK, nil, false, []string{"hamburg/other"}},
+		{"deleted with whitespace payload", "v1.1/Things(42)", " \n", http.StatusOK, nil, false, []string{"hamburg/other"}},
+		{"deleted entity", "v1.1/Things", `{"@iot.id": 42, "name": "changed"}`, http.StatusOK, []string{}, true, []string{"hamburg/other"}},
+		{"no longer exists", "v1.1/Things(42)", `{"name": "changed"}`, http.StatusNotFound, nil, true, []string{"hamburg/other"}},
+		{"updated", "v1.1/Things", `{"@iot.id": 42, "name": "changed"}`, http.StatusOK, []string{"changed"}, true, []string{"hamburg/changed", "hamburg/other"}},
+		{"updated on entity topic", "v1.1/Things(42)", `{"name": "changed"}`, http.StatusOK, []string{"changed"}, true, []string{"hamburg/changed", "hamburg/other"}},
+		{"fetch failed", "v1.1/Things", `{"@iot.id": 42}`, http.StatusInternalServerError, nil, true, []string{"hamburg/other", "hamburg/thing"}},
+		{"without id", "v1.1/Things", ``, http.StatusOK, nil, false, []string{"hamburg/other", "hamburg/thing"}},
+		{"invalid payload", "v1.1/Things(42)", `{`, http.StatusOK, nil, false, []string{"hamburg/other", "hamburg/thing"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fetched := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fetched = true
+				if test.status != http.StatusOK {
+					w.WriteHeader(test.status)
+					return
+				}
+				things := make([]Thing, len(test.returned))
+				for i, name := range test.returned {
+					things[i] = testLaneThing(42, name)
+				}
+				json.NewEncoder(w).Encode(ThingsResponse{Value: things})
+			}))
+			defer server.Close()
+			t.Setenv("SENSORTHINGS_URL", server.URL+"/")
+			t.Setenv("SENSORTHINGS_QUERY", "properties/laneType eq 'Radfahrer'")
+
+			ThingsMutex.Lock()
+			previous := Things
+			Things = map[string]Thing{
+				"hamburg/thing": testLaneThing(42, "thing"),
+				"hamburg/other": testLaneThing(7, "other"),
+			}
+			ThingsMutex.Unlock()
+			defer func() {
+				ThingsMutex.Lock()
+				Things = previous
+				ThingsMutex.Unlock()
+			}()
+
+			handleThingNotification(test.topic, []byte(test.payload))
+
+			if fetched != test.fetched {
+				t.Errorf("fetched = %v, want %v", fetched, test.fetched)
+			}
+			ThingsMutex.Lock()
+			got := make([]string, 0, len(Things))
+			for topic := range Things {
+				got = append(got, topic)
+			}
+			ThingsMutex.Unlock()
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("things = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// Create a thing with a connection lane, such that it passes the validation.
+func testLaneThing(iotId int, name string) Thing {
+	thing := Thing{IotId: iotId, Name: name}
+	location := Location{}
+	location.Location.Geometry.Coordinates = [][][]float64{
+		{{9.99, 53.55}, {9.991, 53.551}},
+		{{9.991, 53.551}, {9.992, 53.552}},
+	}
+	thing.Locations = []Location{location}
+	return thing
+}
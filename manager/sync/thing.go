@@ -1,6 +1,10 @@
 package sync
 
-import "fmt"
+import (
+	"fmt"
+	"monitor/env"
+	"strings"
+)
 
 // A thing from the SensorThings API.
 type Thing struct {
@@ -20,11 +24,13 @@ type Thing struct {
 		InfoLastUpdated string   `json:"infoLastUpdated"`
 		TrafficLightsID string   `json:"trafficLightsID"`
 	} `json:"properties"`
-	SelfLink  string     `json:"@iot.selfLink"`
-	Locations []Location `json:"Locations"`
+	SelfLink    string       `json:"@iot.selfLink"`
+	Locations   []Location   `json:"Locations"`
+	Datastreams []Datastream `json:"Datastreams"`
 }
 
 // Get the lane of a thing. This is the connection lane of the thing.
+// See `LaneParts` for all parts of the lane.
 func (thing Thing) Lane() ([][]float64, error) {
 	if len(thing.Locations) == 0 {
 		return nil, fmt.Errorf("thing %s has no locations", thing.Name)
@@ -44,3 +50,65 @@ func (thing Thing) Lane() ([][]float64, error) {
 func (thing Thing) Topic() string {
 	return fmt.Sprintf("hamburg/%s", thing.Name)
 }
+
+// Get the id of the intersection of a thing. This is the id of its traffic lights controller,
+// or the part of the name before the signal group, e.g. `123` for `123_4`.
+func (thing Thing) Intersection() string {
+	if thing.Properties.TrafficLightsID != "" {
+		return thing.Properties.TrafficLightsID
+	}
+	if i := strings.Index(thing.Name, "_"); i > 0 {
+		return thing.Name[:i]
+	}
+	return thing.Name
+}
+
+// The names of all thing properties that can be published.
+var MetadataNames = []string{
+	"iot_id",
+	"description",
+	"topic",
+	"asset_id",
+	"connection_id",
+	"ingress_lane_id",
+	"egress_lane_id",
+	"traffic_lights_id",
+	"owner_thing",
+	"keywords",
+	"lane_type",
+	"language",
+	"info_last_updated",
+}
+
+// The allowlist of published thing properties, or nil if all are published.
+var publishedProperties = env.List("THING_PROPERTIES")
+
+// Get the metadata of a thing that should be published, by the property name.
+// Which properties are published can be configured with `THING_PROPERTIES`, by default all are.
+func (thing Thing) Metadata() map[string]interface{} {
+	all := map[string]interface{}{
+		"iot_id":            thing.IotId,
+		"description":       thing.Description,
+		"topic":             thing.Properties.Topic,
+		"asset_id":          thing.Properties.AssetID,
+		"connection_id":     thing.Properties.ConnectionID,
+		"ingress_lane_id":   thing.Properties.IngressLaneID,
+		"egress_lane_id":    thing.Properties.EgressLaneID,
+		"traffic_lights_id": thing.Properties.TrafficLightsID,
+		"owner_thing":       thing.Properties.OwnerThing,
+		"keywords":          thing.Properties.Keywords,
+		"lane_type":         thing.Properties.LaneType,
+		"language":          thing.Properties.Language,
+		"info_last_updated": thing.Properties.InfoLastUpdated,
+	}
+	if publishedProperties == nil {
+		return all
+	}
+	metadata := make(map[string]interface{})
+	for _, name := range publishedProperties {
+		if value, ok := all[name]; ok {
+			metadata[name] = value
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	var thing Thing
+	thing.IotId = 42
+	thing.Properties.LaneType = "Radfahrer"
+	thing.Properties.TrafficLightsID = "123"
+
+	tests := []struct {
+		name      string
+		allowlist []string
+		want      map[string]interface{}
+	}{
+		{"allowlist", []string{"iot_id", "lane_type"}, map[string]interface{}{"iot_id": 42, "lane_type": "Radfahrer"}},
+		{"unknown names are ignored", []string{"traffic_lights_id", "secret"}, map[string]interface{}{"traffic_lights_id": "123"}},
+		{"empty allowlist", []string{}, map[string]interface{}{}},
+	}
+	defer func(previous []string) { publishedProperties = previous }(publishedProperties)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			publishedProperties = test.allowlist
+			if got := thing.Metadata(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Metadata = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	publishedProperties = nil
+	if got := thing.Metadata(); len(got) != len(MetadataNames) {
+		t.Errorf("Expected all %d properties without an allowlist, got %v", len(MetadataNames), got)
+	}
+}
+
+func TestIntersection(t *testing.T) {
+	tests := []struct {
+		name            string
+		thingName       string
+		trafficLightsId string
+		want            string
+	}{
+		{"traffic lights id", "123_4", "456", "456"},
+		{"name prefix", "123_4", "", "123"},
+		{"name without signal group", "123", "", "123"},
+		{"leading underscore", "_4", "", "_4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var thing Thing
+			thing.Name = test.thingName
+			thing.Properties.TrafficLightsID = test.trafficLightsId
+			if got := thing.Intersection(); got != test.want {
+				t.Errorf("Intersection = %q, want %q", got, test.want)
+			}
+		})
+	}
+}